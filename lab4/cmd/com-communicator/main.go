@@ -1,11 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"log"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/container"
 
-	"oks/internal/serialterminal"
+	"oks/internal/profile"
 	"oks/internal/ui"
 )
 
@@ -15,26 +17,31 @@ func main() {
 	myWindow.Resize(fyne.NewSize(800, 700))
 	myWindow.SetFullScreen(true)
 
-	terminal1 := serialterminal.New("/dev/ttys001")
-	terminal2 := serialterminal.New("/dev/ttys002")
+	profilesPath := profile.DefaultPath()
+	profiles, err := profile.Load(profilesPath)
+	if err != nil {
+		log.Printf("Ignoring profiles: %v", err)
+		profiles = &profile.File{}
+	}
 
-	ui1 := ui.New(terminal1, myWindow)
-	ui2 := ui.New(terminal2, myWindow)
+	workspace := ui.NewWorkspace(myWindow, profilesPath, profiles)
+	for _, name := range profiles.Startup {
+		p, _ := profiles.Get(name)
+		workspace.Add("", p)
+	}
 
-	tabs := container.NewAppTabs(
-		container.NewTabItem("Port 1", ui1.Layout()),
-		container.NewTabItem("Port 2", ui2.Layout()),
-	)
+	// Without startup profiles the window opens the two ports of a socat
+	// pair, as it always has.
+	if len(profiles.Startup) == 0 {
+		for i, port := range []string{"/dev/ttys001", "/dev/ttys002"} {
+			p := profile.Default()
+			p.Transport.Port = port
+			workspace.Add(fmt.Sprintf("Port %d", i+1), p)
+		}
+	}
 
-	myWindow.SetContent(tabs)
+	myWindow.SetContent(workspace.Content())
 	myWindow.ShowAndRun()
 
-	err := terminal1.Disconnect()
-	if err != nil {
-		return
-	}
-	err = terminal2.Disconnect()
-	if err != nil {
-		return
-	}
+	workspace.Close()
 }
@@ -5,6 +5,9 @@ go 1.25
 require (
 	fyne.io/fyne/v2 v2.6.3
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	github.com/yuin/gopher-lua v1.1.2
+	golang.org/x/term v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -39,5 +42,4 @@ require (
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,227 @@
+package bytefmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mode is how received and sent bytes are shown.
+type Mode int
+
+const (
+	ModeText Mode = iota
+	ModeHex
+	ModeBinary
+	ModeHexdump
+)
+
+var modeNames = []string{"Text", "Hex", "Binary", "Hexdump"}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return "unknown"
+	}
+	return modeNames[m]
+}
+
+// ModeNames lists the display modes in order, for selects.
+func ModeNames() []string {
+	return append([]string(nil), modeNames...)
+}
+
+func ParseMode(name string) (Mode, error) {
+	for i, n := range modeNames {
+		if strings.EqualFold(n, name) {
+			return Mode(i), nil
+		}
+	}
+	return ModeText, fmt.Errorf("unknown display mode %q", name)
+}
+
+// Format renders data in the given mode. Hexdump lines look like hexdump -C:
+// offset, 16 bytes in two groups of eight and the printable ASCII.
+func Format(data []byte, mode Mode) string {
+	switch mode {
+	case ModeHex:
+		return groups(data, "%02X")
+	case ModeBinary:
+		return groups(data, "%08b")
+	case ModeHexdump:
+		return hexdump(data)
+	default:
+		return string(data)
+	}
+}
+
+func groups(data []byte, format string) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf(format, b)
+	}
+	return strings.Join(parts, " ")
+}
+
+func hexdump(data []byte) string {
+	var b strings.Builder
+	for offset := 0; offset < len(data); offset += 16 {
+		end := offset + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[offset:end]
+
+		fmt.Fprintf(&b, "%08x ", offset)
+		for i := 0; i < 16; i++ {
+			if i == 8 {
+				b.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(&b, " %02x", line[i])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteString("  |")
+		for _, c := range line {
+			if c >= 0x20 && c < 0x7F {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteString("|\n")
+	}
+	fmt.Fprintf(&b, "%08x", len(data))
+	return b.String()
+}
+
+// InputMode is how typed input is turned into bytes.
+type InputMode int
+
+const (
+	InputText InputMode = iota
+	InputHex
+	InputEscaped
+)
+
+var inputModeNames = []string{"Text", "Hex", "C escapes"}
+
+func (m InputMode) String() string {
+	if m < 0 || int(m) >= len(inputModeNames) {
+		return "unknown"
+	}
+	return inputModeNames[m]
+}
+
+func InputModeNames() []string {
+	return append([]string(nil), inputModeNames...)
+}
+
+func ParseInputMode(name string) (InputMode, error) {
+	for i, n := range inputModeNames {
+		if strings.EqualFold(n, name) {
+			return InputMode(i), nil
+		}
+	}
+	return InputText, fmt.Errorf("unknown input mode %q", name)
+}
+
+// Parse turns input into bytes. Hex accepts pairs of digits separated by
+// spaces, colons, commas or dashes, each optionally prefixed with 0x.
+// C escapes are \n \r \t \a \b \f \v \0 \\ \" \' \xHH and up to three octal
+// digits.
+func Parse(input string, mode InputMode) ([]byte, error) {
+	switch mode {
+	case InputHex:
+		return parseHex(input)
+	case InputEscaped:
+		return parseEscaped(input)
+	default:
+		return []byte(input), nil
+	}
+}
+
+func parseHex(input string) ([]byte, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == ':' || r == ',' || r == '-'
+	})
+
+	var out []byte
+	for _, field := range fields {
+		digits := field
+		if len(digits) > 2 && (digits[:2] == "0x" || digits[:2] == "0X") {
+			digits = digits[2:]
+		}
+		if len(digits)%2 != 0 {
+			return nil, fmt.Errorf("hex %q has an odd number of digits", field)
+		}
+		for i := 0; i < len(digits); i += 2 {
+			v, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex byte %q in %q", digits[i:i+2], field)
+			}
+			out = append(out, byte(v))
+		}
+	}
+	return out, nil
+}
+
+var simpleEscapes = map[byte]byte{
+	'n': '\n', 'r': '\r', 't': '\t', 'a': '\a', 'b': '\b', 'f': '\f', 'v': '\v',
+	'\\': '\\', '"': '"', '\'': '\'', '?': '?',
+}
+
+func parseEscaped(input string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+
+		i++
+		if i >= len(input) {
+			return nil, fmt.Errorf("escape at the end of the input")
+		}
+		c = input[i]
+
+		if v, ok := simpleEscapes[c]; ok {
+			out = append(out, v)
+			continue
+		}
+
+		switch {
+		case c == 'x':
+			end := i + 1
+			for end < len(input) && end < i+3 && isHexDigit(input[end]) {
+				end++
+			}
+			if end == i+1 {
+				return nil, fmt.Errorf("\\x without hex digits at offset %d", i-1)
+			}
+			v, _ := strconv.ParseUint(input[i+1:end], 16, 8)
+			out = append(out, byte(v))
+			i = end - 1
+		case c >= '0' && c <= '7':
+			end := i
+			for end < len(input) && end < i+3 && input[end] >= '0' && input[end] <= '7' {
+				end++
+			}
+			v, _ := strconv.ParseUint(input[i:end], 8, 16)
+			if v > 0xFF {
+				return nil, fmt.Errorf("octal escape \\%s does not fit in a byte", input[i:end])
+			}
+			out = append(out, byte(v))
+			i = end - 1
+		default:
+			return nil, fmt.Errorf("unknown escape \\%c at offset %d", c, i-1)
+		}
+	}
+	return out, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
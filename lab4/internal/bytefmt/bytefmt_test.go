@@ -0,0 +1,78 @@
+package bytefmt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFormatModes(t *testing.T) {
+	data := []byte{'H', 'i', 0x0E, 0xFF}
+
+	cases := map[Mode]string{
+		ModeText:   "Hi\x0e\xff",
+		ModeHex:    "48 69 0E FF",
+		ModeBinary: "01001000 01101001 00001110 11111111",
+	}
+	for mode, want := range cases {
+		if got := Format(data, mode); got != want {
+			t.Errorf("Expected %s to give %q, got %q", mode, want, got)
+		}
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	data := []byte("0123456789abcdef\x0eX")
+	want := "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+		"00000010  0e 58                                             |.X|\n" +
+		"00000012"
+	if got := Format(data, ModeHexdump); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestParseHex(t *testing.T) {
+	got, err := Parse("0x0E 01:02,ff-A0 0d0a", InputHex)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []byte{0x0E, 0x01, 0x02, 0xFF, 0xA0, 0x0D, 0x0A}; !bytes.Equal(got, want) {
+		t.Errorf("Expected % X, got % X", want, got)
+	}
+
+	for _, bad := range []string{"0E 1", "zz", "0x"} {
+		if _, err := Parse(bad, InputHex); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestParseEscaped(t *testing.T) {
+	got, err := Parse(`flag\x0e\016\0end\n\\\"`, InputEscaped)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := []byte("flag\x0e\x0e\x00end\n\\\""); !bytes.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	for _, bad := range []string{`trailing\`, `\q`, `\xZZ`, `\777`} {
+		if _, err := Parse(bad, InputEscaped); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestModeNamesRoundTrip(t *testing.T) {
+	for _, name := range ModeNames() {
+		mode, err := ParseMode(name)
+		if err != nil || mode.String() != name {
+			t.Errorf("Expected %s to round-trip, got %s (%v)", name, mode, err)
+		}
+	}
+	for _, name := range InputModeNames() {
+		mode, err := ParseInputMode(name)
+		if err != nil || mode.String() != name {
+			t.Errorf("Expected %s to round-trip, got %s (%v)", name, mode, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Link types of the two capture interfaces. Wireshark leaves the user DLTs
+// to a dissector configured per site.
+const (
+	LinkTypeRaw   uint16 = 147 // DLT_USER0: bytes as they crossed the port
+	LinkTypeFrame uint16 = 148 // DLT_USER1: destuffed frames
+)
+
+// Interface IDs in the order the interface description blocks are written.
+const (
+	InterfaceRaw   uint32 = 0
+	InterfaceFrame uint32 = 1
+)
+
+const (
+	blockSectionHeader  uint32 = 0x0A0D0D0A
+	blockInterface      uint32 = 0x00000001
+	blockEnhancedPacket uint32 = 0x00000006
+	byteOrderMagic      uint32 = 0x1A2B3C4D
+
+	optionEnd     uint16 = 0
+	optionComment uint16 = 1
+	optionName    uint16 = 2 // if_name
+	optionFlags   uint16 = 2 // epb_flags
+	optionApp     uint16 = 4 // shb_userappl
+
+	snapLength = 0xFFFF
+)
+
+// Direction says whether a packet was read from the port or written to it.
+type Direction int
+
+const (
+	Inbound Direction = iota
+	Outbound
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "in"
+	}
+	return "out"
+}
+
+// epb_flags keeps the direction in its two lowest bits.
+func (d Direction) flags() uint32 {
+	if d == Inbound {
+		return 1
+	}
+	return 2
+}
+
+// Frame is a decoded frame. It is stored as address, control, data and FCS,
+// the order they have on the wire.
+type Frame struct {
+	Address byte
+	Control byte
+	Data    []byte
+	FCS     byte
+	Comment string
+}
+
+// Encode returns the bytes of the frame as they are stored in a packet block
+// of the frame interface.
+func (f Frame) Encode() []byte {
+	b := make([]byte, 0, 3+len(f.Data))
+	b = append(b, f.Address, f.Control)
+	b = append(b, f.Data...)
+	return append(b, f.FCS)
+}
+
+// Writer writes one pcapng section with a raw byte interface and a frame
+// interface. It is safe for concurrent use.
+type Writer struct {
+	mutex  sync.Mutex
+	out    *bufio.Writer
+	closer io.Closer
+	err    error
+}
+
+// Create starts a capture file at path, replacing an existing one.
+func Create(path, port string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture %s: %v", path, err)
+	}
+	w, err := NewWriter(f, port)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWriter writes the section header and interface descriptions to out.
+// port names both interfaces so captures of several ports can be told apart.
+// If out is an io.Closer, Close closes it.
+func NewWriter(out io.Writer, port string) (*Writer, error) {
+	w := &Writer{out: bufio.NewWriter(out)}
+	if closer, ok := out.(io.Closer); ok {
+		w.closer = closer
+	}
+
+	var options []byte
+	options = appendOption(options, optionApp, []byte("oks com"))
+	options = appendOption(options, optionEnd, nil)
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:], 1)
+	binary.LittleEndian.PutUint16(body[6:], 0)
+	binary.LittleEndian.PutUint64(body[8:], ^uint64(0))
+	w.block(blockSectionHeader, append(body, options...))
+
+	w.interfaceBlock(LinkTypeRaw, port+" raw")
+	w.interfaceBlock(LinkTypeFrame, port+" frames")
+
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) interfaceBlock(linkType uint16, name string) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], linkType)
+	binary.LittleEndian.PutUint32(body[4:], snapLength)
+	body = appendOption(body, optionName, []byte(name))
+	body = appendOption(body, optionEnd, nil)
+	w.block(blockInterface, body)
+}
+
+// WriteRaw records bytes read from or written to the port.
+func (w *Writer) WriteRaw(ts time.Time, direction Direction, data []byte) error {
+	return w.packet(InterfaceRaw, ts, direction, data, "")
+}
+
+// WriteFrame records a decoded frame.
+func (w *Writer) WriteFrame(ts time.Time, direction Direction, frame Frame) error {
+	return w.packet(InterfaceFrame, ts, direction, frame.Encode(), frame.Comment)
+}
+
+func (w *Writer) packet(iface uint32, ts time.Time, direction Direction, data []byte, comment string) error {
+	if len(data) > snapLength {
+		data = data[:snapLength]
+	}
+
+	micros := uint64(ts.UnixMicro())
+	body := make([]byte, 20, 20+len(data)+32)
+	binary.LittleEndian.PutUint32(body[0:], iface)
+	binary.LittleEndian.PutUint32(body[4:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(micros))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(data)))
+	body = append(body, pad(data)...)
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, direction.flags())
+	body = appendOption(body, optionFlags, flags)
+	if comment != "" {
+		body = appendOption(body, optionComment, []byte(comment))
+	}
+	body = appendOption(body, optionEnd, nil)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.block(blockEnhancedPacket, body)
+	return w.flush()
+}
+
+// Close flushes the capture and closes the underlying file.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err := w.flush()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+		w.closer = nil
+	}
+	if w.err == nil {
+		w.err = fmt.Errorf("capture closed")
+	}
+	return err
+}
+
+func (w *Writer) block(blockType uint32, body []byte) {
+	length := uint32(12 + len(body))
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:], blockType)
+	binary.LittleEndian.PutUint32(header[4:], length)
+	trailer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(trailer, length)
+
+	w.out.Write(header)
+	w.out.Write(body)
+	w.out.Write(trailer)
+}
+
+func (w *Writer) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.out.Flush(); err != nil {
+		w.err = fmt.Errorf("failed to write capture: %v", err)
+	}
+	return w.err
+}
+
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint16(header[0:], code)
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(value)))
+	return append(append(b, header...), pad(value)...)
+}
+
+func pad(b []byte) []byte {
+	if len(b)%4 == 0 {
+		return b
+	}
+	return append(append([]byte(nil), b...), make([]byte, 4-len(b)%4)...)
+}
@@ -0,0 +1,95 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+type block struct {
+	blockType uint32
+	body      []byte
+}
+
+func readBlocks(t *testing.T, data []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("Expected a complete block, got %d trailing bytes", len(data))
+		}
+		length := binary.LittleEndian.Uint32(data[4:])
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("Invalid block length %d", length)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[length-4:]); trailer != length {
+			t.Fatalf("Expected trailing length %d, got %d", length, trailer)
+		}
+		blocks = append(blocks, block{binary.LittleEndian.Uint32(data), data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+func TestWriterProducesPcapng(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "loopback:a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ts := time.Unix(1700000000, 123456000)
+	w.WriteRaw(ts, Outbound, []byte{0x0E, 0x01, 0x02})
+	w.WriteFrame(ts, Inbound, Frame{Address: 0x01, Control: 0x00, Data: []byte("hi"), FCS: 0x5A, Comment: "corrected"})
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected close error: %v", err)
+	}
+
+	blocks := readBlocks(t, buf.Bytes())
+	if len(blocks) != 5 {
+		t.Fatalf("Expected section, 2 interfaces and 2 packets, got %d blocks", len(blocks))
+	}
+	if blocks[0].blockType != blockSectionHeader || binary.LittleEndian.Uint32(blocks[0].body) != byteOrderMagic {
+		t.Errorf("Expected a little-endian section header first")
+	}
+	for i, want := range []uint16{LinkTypeRaw, LinkTypeFrame} {
+		b := blocks[1+i]
+		if b.blockType != blockInterface || binary.LittleEndian.Uint16(b.body) != want {
+			t.Errorf("Expected interface %d with link type %d", i, want)
+		}
+	}
+
+	raw, frame := blocks[3].body, blocks[4].body
+	if binary.LittleEndian.Uint32(raw[0:]) != InterfaceRaw || binary.LittleEndian.Uint32(frame[0:]) != InterfaceFrame {
+		t.Errorf("Expected packets on the raw and frame interfaces")
+	}
+	micros := uint64(binary.LittleEndian.Uint32(raw[4:]))<<32 | uint64(binary.LittleEndian.Uint32(raw[8:]))
+	if micros != uint64(ts.UnixMicro()) {
+		t.Errorf("Expected timestamp %d, got %d", ts.UnixMicro(), micros)
+	}
+	if length := binary.LittleEndian.Uint32(raw[12:]); length != 3 {
+		t.Errorf("Expected 3 captured bytes, got %d", length)
+	}
+	// 3 data bytes padded to 4, then the epb_flags option.
+	if flags := binary.LittleEndian.Uint32(raw[28:]); binary.LittleEndian.Uint16(raw[24:]) != optionFlags || flags != 2 {
+		t.Errorf("Expected outbound epb_flags, got %d", flags)
+	}
+
+	payload := frame[20 : 20+binary.LittleEndian.Uint32(frame[12:])]
+	if !bytes.Equal(payload, []byte{0x01, 0x00, 'h', 'i', 0x5A}) {
+		t.Errorf("Expected address, control, data and FCS, got % X", payload)
+	}
+	if !bytes.Contains(frame, []byte("corrected")) {
+		t.Error("Expected the frame comment to be stored")
+	}
+}
+
+func TestWriteAfterCloseFails(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, "p")
+	w.Close()
+	if err := w.WriteRaw(time.Now(), Inbound, []byte{1}); err == nil {
+		t.Error("Expected writing to a closed capture to fail")
+	}
+}
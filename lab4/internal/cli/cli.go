@@ -0,0 +1,724 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oks/internal/capture"
+	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/filetransfer"
+	"oks/internal/pipeline"
+	"oks/internal/profile"
+	"oks/internal/replay"
+	"oks/internal/serialterminal"
+	"oks/internal/stack"
+	"oks/internal/tui"
+	"oks/internal/txqueue"
+	"oks/internal/xmodem"
+
+	"golang.org/x/term"
+)
+
+const (
+	exitOK          = 0
+	exitLinkFailure = 1
+	exitUsage       = 2
+)
+
+type options struct {
+	port          string
+	dataBits      int
+	parity        string
+	stopBits      int
+	address       int
+	stack         string
+	mac           string
+	emulation     bool
+	busyProb      float64
+	collisionProb float64
+	detection     string
+	slotTime      time.Duration
+	jamDuration   time.Duration
+	tokenHold     time.Duration
+	noise         bool
+	compression   string
+	pskFile       string
+	psk           string
+	format        string
+	listen        bool
+	linger        time.Duration
+	verbose       bool
+	ui            string
+	queueDepth    int
+	queuePolicy   string
+	sendFile      string
+	saveDir       string
+	maxFileSize   int64
+	chunkSize     int
+	protocol      string
+	receive       bool
+	output        string
+	capture       string
+	record        string
+	replay        string
+	replaySpeed   float64
+	profile       string
+	profiles      string
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("com-cli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	fs.StringVar(&opts.port, "port", "/dev/ttys001", "serial port, or loopback:<name> for a shared in-process medium")
+	fs.IntVar(&opts.dataBits, "databits", 8, "data bits per character (5-8)")
+	fs.StringVar(&opts.parity, "parity", "N", "parity: N, E, O, M or S")
+	fs.IntVar(&opts.stopBits, "stopbits", 1, "stop bits: 1 or 2")
+	fs.IntVar(&opts.address, "address", -1, "station address (default derived from the port name)")
+	fs.StringVar(&opts.stack, "stack", stack.Default.Name, "protocol stack: raw, stuffed, stuffed+crc or stuffed+crc+csmacd (or lab1-lab4)")
+	fs.StringVar(&opts.mac, "mac", "csmacd", "medium access control: csmacd or token")
+	fs.BoolVar(&opts.emulation, "emulation", true, "emulate busy channel, collisions and token loss")
+	fs.Float64Var(&opts.busyProb, "busy-prob", 0.25, "emulated busy channel probability")
+	fs.Float64Var(&opts.collisionProb, "collision-prob", 0.75, "emulated collision probability")
+	fs.StringVar(&opts.detection, "detection", "emulated", "collision detection: emulated or echo")
+	fs.DurationVar(&opts.slotTime, "slot-time", csmacd.DefaultSlotTime, "CSMA/CD slot time")
+	fs.DurationVar(&opts.jamDuration, "jam", csmacd.DefaultJamDuration, "CSMA/CD jam signal duration")
+	fs.DurationVar(&opts.tokenHold, "token-hold", 500*time.Millisecond, "token holding time")
+	fs.BoolVar(&opts.noise, "noise", true, "simulate bit corruption of outgoing frames")
+	fs.StringVar(&opts.compression, "compression", "none", "payload compression: none or deflate (payloads that do not shrink are sent as they are)")
+	fs.StringVar(&opts.pskFile, "psk-file", "", "encrypt and authenticate frames with the pre-shared key in this file")
+	fs.StringVar(&opts.format, "format", "text", "output format for received frames: text, hex or json")
+	fs.BoolVar(&opts.listen, "listen", false, "only print received frames, do not read stdin")
+	fs.DurationVar(&opts.linger, "linger", time.Second, "how long to keep receiving after stdin is exhausted")
+	fs.BoolVar(&opts.verbose, "v", false, "log protocol details to stderr")
+	fs.IntVar(&opts.queueDepth, "queue-depth", txqueue.DefaultDepth, "transmit queue depth")
+	fs.StringVar(&opts.queuePolicy, "queue-policy", "block", "when the transmit queue is full: block or drop-oldest")
+	fs.StringVar(&opts.sendFile, "send-file", "", "send this file instead of stdin lines")
+	fs.StringVar(&opts.saveDir, "save-dir", "", "save received files into this directory (default: only report them)")
+	fs.Int64Var(&opts.maxFileSize, "max-file-size", filetransfer.DefaultMaxFileSize, "largest framed file accepted, in bytes")
+	fs.IntVar(&opts.chunkSize, "chunk-size", filetransfer.DefaultChunkSize, "file transfer payload bytes per frame")
+	fs.StringVar(&opts.protocol, "protocol", "framed", "file transfer protocol: framed, xmodem, xmodem-crc, xmodem-1k or ymodem")
+	fs.BoolVar(&opts.receive, "receive", false, "receive one XMODEM file or a YMODEM batch into -save-dir, then exit")
+	fs.StringVar(&opts.output, "output", "received.bin", "file name for an XMODEM receive, which carries no name")
+	fs.StringVar(&opts.capture, "capture", "", "record port traffic and decoded frames into this pcapng file")
+	fs.StringVar(&opts.record, "record", "", "record every chunk read from the port with its timing into this JSON Lines file")
+	fs.StringVar(&opts.replay, "replay", "", "read from a recording made with -record instead of the port; implies -listen")
+	fs.Float64Var(&opts.replaySpeed, "replay-speed", 1, "replay speed factor, 0 replays without delays")
+	fs.StringVar(&opts.ui, "ui", "line", "interface: line (stdin/stdout) or tui (full-screen panels)")
+	fs.StringVar(&opts.profile, "profile", "", "start from this named profile; flags given explicitly override it")
+	fs.StringVar(&opts.profiles, "profiles", "", "profiles file (default $OKS_PROFILES, ./profiles.yaml or the user config directory)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if opts.profile != "" {
+		if err := applyProfile(fs, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.dataBits < 5 || opts.dataBits > 8 {
+		return nil, fmt.Errorf("invalid -databits %d: must be 5-8", opts.dataBits)
+	}
+	if len(opts.parity) != 1 || !strings.Contains("NEOMS", strings.ToUpper(opts.parity)) {
+		return nil, fmt.Errorf("invalid -parity %q: must be N, E, O, M or S", opts.parity)
+	}
+	if opts.stopBits != 1 && opts.stopBits != 2 {
+		return nil, fmt.Errorf("invalid -stopbits %d: must be 1 or 2", opts.stopBits)
+	}
+	if opts.address > 0xFF {
+		return nil, fmt.Errorf("invalid -address %d: must fit in a byte", opts.address)
+	}
+	config, err := stack.Parse(opts.stack)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -stack: %v", err)
+	}
+	if opts.mac != "csmacd" && opts.mac != "token" {
+		return nil, fmt.Errorf("invalid -mac %q: must be csmacd or token", opts.mac)
+	}
+	if opts.compression != "none" && opts.compression != "deflate" {
+		return nil, fmt.Errorf("invalid -compression %q: must be none or deflate", opts.compression)
+	}
+	if opts.pskFile != "" {
+		data, err := os.ReadFile(opts.pskFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -psk-file: %v", err)
+		}
+		opts.psk = strings.TrimSpace(string(data))
+	}
+	if opts.psk != "" && len(opts.psk) < pipeline.MinPSKLength {
+		return nil, fmt.Errorf("invalid pre-shared key: must be at least %d characters", pipeline.MinPSKLength)
+	}
+	if opts.psk != "" && !config.Stuffing {
+		return nil, fmt.Errorf("a pre-shared key needs frames, the %s stack has none", config.Name)
+	}
+	if opts.detection != "emulated" && opts.detection != "echo" {
+		return nil, fmt.Errorf("invalid -detection %q: must be emulated or echo", opts.detection)
+	}
+	if opts.format != "text" && opts.format != "hex" && opts.format != "json" {
+		return nil, fmt.Errorf("invalid -format %q: must be text, hex or json", opts.format)
+	}
+	if opts.queueDepth < 1 {
+		return nil, fmt.Errorf("invalid -queue-depth %d: must be at least 1", opts.queueDepth)
+	}
+	if opts.queuePolicy != "block" && opts.queuePolicy != "drop-oldest" {
+		return nil, fmt.Errorf("invalid -queue-policy %q: must be block or drop-oldest", opts.queuePolicy)
+	}
+	if opts.chunkSize < 1 || opts.chunkSize > filetransfer.MaxChunkSize {
+		return nil, fmt.Errorf("invalid -chunk-size %d: must be 1-%d", opts.chunkSize, filetransfer.MaxChunkSize)
+	}
+	switch opts.protocol {
+	case "framed", "xmodem", "xmodem-crc", "xmodem-1k", "ymodem":
+	default:
+		return nil, fmt.Errorf("invalid -protocol %q: must be framed, xmodem, xmodem-crc, xmodem-1k or ymodem", opts.protocol)
+	}
+	if opts.receive && opts.protocol == "framed" {
+		return nil, fmt.Errorf("-receive needs an XMODEM or YMODEM -protocol, framed files are received automatically")
+	}
+	if opts.sendFile != "" && opts.protocol == "framed" && !config.Stuffing {
+		return nil, fmt.Errorf("-send-file needs frames, use -protocol xmodem or ymodem with the %s stack", config.Name)
+	}
+	if opts.maxFileSize < 0 {
+		return nil, fmt.Errorf("invalid -max-file-size %d: must not be negative", opts.maxFileSize)
+	}
+	if opts.receive && opts.saveDir == "" {
+		return nil, fmt.Errorf("-receive needs -save-dir")
+	}
+	if opts.replaySpeed < 0 {
+		return nil, fmt.Errorf("invalid -replay-speed %v: must not be negative", opts.replaySpeed)
+	}
+	if opts.replay != "" {
+		opts.listen = true
+	}
+	if opts.ui != "line" && opts.ui != "tui" {
+		return nil, fmt.Errorf("invalid -ui %q: must be line or tui", opts.ui)
+	}
+
+	return opts, nil
+}
+
+// applyProfile copies the named profile into every option that was not set
+// on the command line.
+func applyProfile(fs *flag.FlagSet, opts *options) error {
+	path := opts.profiles
+	if path == "" {
+		path = profile.DefaultPath()
+	}
+	f, err := profile.Load(path)
+	if err != nil {
+		return err
+	}
+	p, err := f.Get(opts.profile)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, path)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	apply := func(name string, fn func()) {
+		if !set[name] {
+			fn()
+		}
+	}
+
+	apply("port", func() { opts.port = p.Transport.Port })
+	apply("databits", func() { opts.dataBits = p.Framing.DataBits })
+	apply("parity", func() { opts.parity = p.Framing.Parity })
+	apply("stopbits", func() { opts.stopBits = p.Framing.StopBits })
+	if p.Station.Address != nil {
+		apply("address", func() { opts.address = *p.Station.Address })
+	}
+	apply("stack", func() { opts.stack = p.Stack })
+	apply("mac", func() { opts.mac = p.MAC.Strategy })
+	apply("emulation", func() { opts.emulation = p.MAC.Emulation })
+	apply("busy-prob", func() { opts.busyProb = p.MAC.BusyProbability })
+	apply("collision-prob", func() { opts.collisionProb = p.MAC.CollisionProbability })
+	apply("detection", func() { opts.detection = p.MAC.Detection })
+	apply("slot-time", func() { opts.slotTime = p.MAC.SlotTime })
+	apply("jam", func() { opts.jamDuration = p.MAC.Jam })
+	apply("token-hold", func() { opts.tokenHold = p.MAC.TokenHold })
+	apply("noise", func() { opts.noise = p.Noise.Enabled })
+	apply("compression", func() { opts.compression = p.Compression })
+	apply("psk-file", func() { opts.pskFile = p.PSKFile })
+	apply("queue-depth", func() { opts.queueDepth = p.Queue.Depth })
+	apply("queue-policy", func() { opts.queuePolicy = p.Queue.Policy })
+	return nil
+}
+
+func configure(terminal *serialterminal.SerialTerminal, opts *options) {
+	if config, err := stack.Parse(opts.stack); err == nil {
+		terminal.SetStack(config)
+	}
+	terminal.SetDataBits(opts.dataBits)
+	terminal.SetFraming(strings.ToUpper(opts.parity)[0], opts.stopBits)
+	if opts.address >= 0 {
+		terminal.SetStationAddress(byte(opts.address))
+	}
+	terminal.SetCSMAEmulation(opts.emulation)
+	terminal.SetTokenEmulation(opts.emulation)
+	terminal.SetCSMAProbabilities(opts.busyProb, opts.collisionProb)
+	terminal.SetCSMATiming(opts.slotTime, opts.jamDuration)
+	terminal.SetTokenHoldingTime(opts.tokenHold)
+	terminal.SetNoiseEnabled(opts.noise)
+	terminal.SetCompression(opts.compression == "deflate")
+	if err := terminal.SetPSK(opts.psk); err != nil {
+		log.Printf("Encryption: %v", err)
+	}
+	if opts.detection == "echo" {
+		terminal.SetCSMADetectionMode(csmacd.DetectionEcho)
+	}
+	if opts.mac == "token" {
+		terminal.SetMACMode(serialterminal.MACTokenRing)
+	}
+	terminal.SetQueueDepth(opts.queueDepth)
+	terminal.SetMaxFileSize(opts.maxFileSize)
+	if opts.queuePolicy == "drop-oldest" {
+		terminal.SetQueuePolicy(txqueue.PolicyDropOldest)
+	}
+}
+
+// Run is the headless communicator. It sends every stdin line as a packet,
+// prints received frames to stdout and returns the process exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	if opts.verbose {
+		log.SetOutput(stderr)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	terminal := serialterminal.New(opts.port)
+	configure(terminal, opts)
+
+	if opts.capture != "" {
+		w, err := capture.Create(opts.capture, opts.port)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		terminal.SetCapture(w)
+		defer func() {
+			terminal.SetCapture(nil)
+			if err := w.Close(); err != nil {
+				fmt.Fprintln(stderr, err)
+			}
+		}()
+	}
+
+	if opts.record != "" {
+		r, err := replay.Create(opts.record)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		terminal.SetRecorder(r)
+		defer func() {
+			terminal.SetRecorder(nil)
+			if err := r.Close(); err != nil {
+				fmt.Fprintln(stderr, err)
+			}
+		}()
+	}
+
+	if opts.replay != "" {
+		chunks, err := replay.Load(opts.replay)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		transport := replay.NewTransport(chunks, opts.replaySpeed)
+		terminal.SetTransport(transport)
+		go func() {
+			select {
+			case <-transport.Done():
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-time.After(opts.linger):
+			case <-ctx.Done():
+			}
+			stop()
+		}()
+	}
+
+	if opts.ui == "tui" {
+		return runTUI(ctx, terminal, stdin, stdout, stderr)
+	}
+
+	sub := terminal.Subscribe(1024)
+	linkFailed := make(chan error, 1)
+	printed := make(chan struct{})
+	printer := &framePrinter{out: stdout, format: opts.format}
+	go func() {
+		defer close(printed)
+		for e := range sub.Events() {
+			if ev, ok := e.(events.LinkStateChanged); ok && ev.State == events.LinkError {
+				select {
+				case linkFailed <- ev.Err:
+				default:
+				}
+				continue
+			}
+			if ev, ok := e.(events.FileReceived); ok {
+				saveFile(ev, opts.saveDir, stderr)
+				continue
+			}
+			printer.print(e)
+		}
+	}()
+
+	if err := terminal.Connect(); err != nil {
+		fmt.Fprintln(stderr, err)
+		sub.Close()
+		return exitLinkFailure
+	}
+
+	code := exitOK
+	if err := session(ctx, terminal, opts, stdin, linkFailed); err != nil {
+		fmt.Fprintln(stderr, err)
+		code = exitLinkFailure
+	}
+
+	if err := terminal.Disconnect(); err != nil {
+		fmt.Fprintln(stderr, err)
+		code = exitLinkFailure
+	}
+	sub.Close()
+	<-printed
+
+	return code
+}
+
+// runTUI hands the terminal to the full-screen interface. The port is opened
+// from the UI, so a failing port is reported there rather than as an exit code.
+func runTUI(ctx context.Context, st *serialterminal.SerialTerminal, stdin io.Reader, stdout, stderr io.Writer) int {
+	app := tui.New(st, stdin, stdout)
+
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		state, err := term.MakeRaw(int(f.Fd()))
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		defer term.Restore(int(f.Fd()), state)
+	}
+	if f, ok := stdout.(*os.File); ok {
+		if width, height, err := term.GetSize(int(f.Fd())); err == nil {
+			app.SetSize(width, height)
+		}
+	}
+
+	code := exitOK
+	if err := app.Run(ctx); err != nil {
+		fmt.Fprintln(stderr, err)
+		code = exitLinkFailure
+	}
+	if st.IsConnected() {
+		if err := st.Disconnect(); err != nil {
+			fmt.Fprintln(stderr, err)
+			code = exitLinkFailure
+		}
+	}
+	return code
+}
+
+func session(ctx context.Context, terminal *serialterminal.SerialTerminal, opts *options, stdin io.Reader, linkFailed <-chan error) error {
+	if opts.listen {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-linkFailed:
+			return fmt.Errorf("link failure: %v", err)
+		}
+	}
+
+	if opts.receive {
+		return receiveRaw(ctx, terminal, opts)
+	}
+	if opts.sendFile != "" && opts.protocol != "framed" {
+		return sendRaw(ctx, terminal, opts)
+	}
+	if opts.sendFile != "" {
+		return sendFile(ctx, terminal, opts, linkFailed)
+	}
+
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	// Lines are queued as fast as the transmit queue accepts them; results
+	// are collected in order so a failed frame stops the session.
+	pending := make(chan (<-chan error), opts.queueDepth)
+	sendFailed := make(chan error, 1)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for result := range pending {
+			if err := <-result; err != nil && ctx.Err() == nil {
+				select {
+				case sendFailed <- err:
+				default:
+				}
+			}
+		}
+	}()
+	defer func() {
+		if pending != nil {
+			close(pending)
+			<-sent
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-linkFailed:
+			return fmt.Errorf("link failure: %v", err)
+		case err := <-sendFailed:
+			return fmt.Errorf("send failed: %v", err)
+		case line, ok := <-lines:
+			if !ok {
+				if err := <-readErr; err != nil {
+					return fmt.Errorf("reading stdin: %v", err)
+				}
+				close(pending)
+				<-sent
+				pending = nil
+				select {
+				case err := <-sendFailed:
+					return fmt.Errorf("send failed: %v", err)
+				default:
+				}
+				return linger(ctx, opts.linger, linkFailed)
+			}
+			if line == "" {
+				continue
+			}
+			result, err := terminal.EnqueueMessage(ctx, line)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("send failed: %v", err)
+			}
+			pending <- result
+		}
+	}
+}
+
+func sendFile(ctx context.Context, terminal *serialterminal.SerialTerminal, opts *options, linkFailed <-chan error) error {
+	data, err := os.ReadFile(opts.sendFile)
+	if err != nil {
+		return fmt.Errorf("reading file: %v", err)
+	}
+
+	started := time.Now()
+	if err := terminal.SendFile(ctx, opts.sendFile, data, opts.chunkSize); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("file transfer failed: %v", err)
+	}
+	elapsed := time.Since(started)
+	log.Printf("File %s sent: %d bytes in %v (%.1f B/s)", opts.sendFile, len(data), elapsed.Round(time.Millisecond),
+		float64(len(data))/elapsed.Seconds())
+
+	return linger(ctx, opts.linger, linkFailed)
+}
+
+func xmodemOptions(protocol string) xmodem.Options {
+	opts := xmodem.Options{
+		Progress: func(p xmodem.Progress) {
+			log.Printf("%s: %d/%d bytes", p.Name, p.Done, p.Total)
+		},
+	}
+	switch protocol {
+	case "xmodem":
+		opts.Mode = xmodem.ModeChecksum
+	case "xmodem-crc":
+		opts.Mode = xmodem.ModeCRC
+	default:
+		opts.Mode = xmodem.Mode1K
+	}
+	return opts
+}
+
+func sendRaw(ctx context.Context, terminal *serialterminal.SerialTerminal, opts *options) error {
+	data, err := os.ReadFile(opts.sendFile)
+	if err != nil {
+		return fmt.Errorf("reading file: %v", err)
+	}
+
+	err = terminal.RawSession(func(rw io.ReadWriter) error {
+		if opts.protocol == "ymodem" {
+			return xmodem.SendBatch(ctx, rw, []xmodem.File{{Name: opts.sendFile, Data: data}}, xmodemOptions(opts.protocol))
+		}
+		return xmodem.Send(ctx, rw, data, xmodemOptions(opts.protocol))
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%s transfer failed: %v", opts.protocol, err)
+	}
+	return nil
+}
+
+func receiveRaw(ctx context.Context, terminal *serialterminal.SerialTerminal, opts *options) error {
+	var files []xmodem.File
+	err := terminal.RawSession(func(rw io.ReadWriter) error {
+		if opts.protocol == "ymodem" {
+			received, err := xmodem.ReceiveBatch(ctx, rw, xmodemOptions(opts.protocol))
+			files = received
+			return err
+		}
+		data, err := xmodem.Receive(ctx, rw, xmodemOptions(opts.protocol))
+		if err == nil {
+			files = []xmodem.File{{Name: opts.output, Data: data}}
+		}
+		return err
+	})
+
+	for _, f := range files {
+		path := filepath.Join(opts.saveDir, filepath.Base(f.Name))
+		if err := os.WriteFile(path, f.Data, 0o644); err != nil {
+			return fmt.Errorf("saving %s: %v", path, err)
+		}
+		log.Printf("Received %s (%d bytes)", path, len(f.Data))
+	}
+
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%s receive failed: %v", opts.protocol, err)
+	}
+	return nil
+}
+
+// saveFile reports a finished incoming transfer on stderr and, when a
+// directory is given, writes the file there under its base name.
+func saveFile(ev events.FileReceived, dir string, stderr io.Writer) {
+	if ev.Err != nil {
+		fmt.Fprintf(stderr, "file transfer from 0x%02X failed: %v\n", ev.Source, ev.Err)
+		return
+	}
+	if dir == "" {
+		fmt.Fprintf(stderr, "received file %s (%d bytes), not saved without -save-dir\n", ev.Name, len(ev.Data))
+		return
+	}
+
+	path := filepath.Join(dir, filepath.Base(ev.Name))
+	if err := os.WriteFile(path, ev.Data, 0o644); err != nil {
+		fmt.Fprintf(stderr, "saving %s: %v\n", path, err)
+		return
+	}
+	fmt.Fprintf(stderr, "received file %s (%d bytes)\n", path, len(ev.Data))
+}
+
+func linger(ctx context.Context, d time.Duration, linkFailed <-chan error) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	case err := <-linkFailed:
+		return fmt.Errorf("link failure: %v", err)
+	}
+	return nil
+}
+
+type framePrinter struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	format string
+}
+
+type frameRecord struct {
+	Time     time.Time `json:"time"`
+	Status   string    `json:"status"`
+	Address  byte      `json:"address"`
+	Control  byte      `json:"control"`
+	Data     string    `json:"data"`
+	Hex      string    `json:"hex"`
+	Received string    `json:"received,omitempty"`
+	FCS      uint8     `json:"fcs"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+func (p *framePrinter) print(e events.Event) {
+	var rec frameRecord
+	switch ev := e.(type) {
+	case events.FrameReceived:
+		rec = frameRecord{Status: "ok", Address: ev.Address, Control: ev.Control, Data: ev.Data, FCS: ev.FCS}
+	case events.FrameCorrected:
+		rec = frameRecord{Status: "corrected", Address: ev.Address, Control: ev.Control, Data: ev.Corrected, Received: ev.Received, FCS: ev.FCS}
+	case events.FrameDropped:
+		if p.format != "json" {
+			return
+		}
+		rec = frameRecord{Status: "dropped", Address: ev.Address, Control: ev.Control, Data: ev.Data, FCS: ev.FCS, Reason: ev.Reason}
+	case events.FrameMalformed:
+		if p.format != "json" {
+			return
+		}
+		rec = frameRecord{Status: "malformed", Data: string(ev.Raw), Reason: ev.Reason}
+	case events.StrayBytes:
+		if p.format != "json" {
+			return
+		}
+		rec = frameRecord{Status: "stray", Data: string(ev.Data)}
+	default:
+		return
+	}
+	rec.Time = e.Timestamp()
+	rec.Hex = hex.EncodeToString([]byte(rec.Data))
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	switch p.format {
+	case "hex":
+		fmt.Fprintln(p.out, rec.Hex)
+	case "json":
+		line, _ := json.Marshal(rec)
+		fmt.Fprintln(p.out, string(line))
+	default:
+		fmt.Fprintln(p.out, rec.Data)
+	}
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oks/internal/events"
+	"oks/internal/serialterminal"
+)
+
+func TestSendsStdinLinesAndPrintsFrames(t *testing.T) {
+	peer := serialterminal.New("loopback:cli-test")
+	peer.SetCSMAEmulation(false)
+	peer.SetNoiseEnabled(false)
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer peer.Disconnect()
+	rx := peer.Subscribe(64)
+	defer rx.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-port", "loopback:cli-test", "-emulation=false", "-noise=false", "-format", "json", "-linger", "500ms"}
+	done := make(chan int, 1)
+	go func() { done <- Run(args, strings.NewReader("hello\n"), &stdout, &stderr) }()
+
+	timeout := time.After(time.Second)
+	for received := false; !received; {
+		select {
+		case e := <-rx.Events():
+			if ev, ok := e.(events.FrameReceived); ok {
+				if ev.Data != "hello" {
+					t.Errorf("Expected peer to receive %q, got %q", "hello", ev.Data)
+				}
+				received = true
+			}
+		case <-timeout:
+			t.Fatal("Expected the peer to receive the stdin line")
+		}
+	}
+	if err := peer.SendMessage("hello back"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if code := <-done; code != exitOK {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	var rec frameRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatalf("Expected a JSON frame record on stdout, got %q: %v", stdout.String(), err)
+	}
+	if rec.Data != "hello back" || rec.Status != "ok" || rec.Hex != "68656c6c6f206261636b" {
+		t.Errorf("Unexpected frame record: %+v", rec)
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	peer := serialterminal.New("loopback:cli-file")
+	peer.SetCSMAEmulation(false)
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer peer.Disconnect()
+	rx := peer.Subscribe(256)
+	defer rx.Close()
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	content := strings.Repeat("line of notes\n", 20)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-port", "loopback:cli-file", "-emulation=false", "-noise=false", "-send-file", path, "-linger", "100ms"}
+	if code := Run(args, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-rx.Events():
+			if ev, ok := e.(events.FileReceived); ok {
+				if ev.Err != nil || ev.Name != "notes.txt" || string(ev.Data) != content {
+					t.Errorf("Expected notes.txt intact, got %s (%d bytes, err %v)", ev.Name, len(ev.Data), ev.Err)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the peer to receive the file")
+		}
+	}
+}
+
+func TestYMODEMBetweenTwoRuns(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "firmware.hex")
+	content := strings.Repeat(":10010000214601360121470136007EFE09D2190140\n", 30)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	saveDir := filepath.Join(dir, "in")
+	if err := os.Mkdir(saveDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	port := []string{"-port", "loopback:cli-ymodem", "-protocol", "ymodem"}
+	received := make(chan int, 1)
+	go func() {
+		var stdout, stderr bytes.Buffer
+		received <- Run(append(port, "-receive", "-save-dir", saveDir), strings.NewReader(""), &stdout, &stderr)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	var stdout, stderr bytes.Buffer
+	if code := Run(append(port, "-send-file", path), strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected the sender to exit with 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if code := <-received; code != exitOK {
+		t.Fatalf("Expected the receiver to exit with 0, got %d", code)
+	}
+
+	got, err := os.ReadFile(filepath.Join(saveDir, "firmware.hex"))
+	if err != nil || string(got) != content {
+		t.Errorf("Expected firmware.hex saved intact, got %d bytes, err %v", len(got), err)
+	}
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	peer := serialterminal.New("loopback:cli-record")
+	peer.SetCSMAEmulation(false)
+	peer.SetNoiseEnabled(false)
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer peer.Disconnect()
+
+	recording := filepath.Join(t.TempDir(), "session.jsonl")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		peer.SendMessage("recorded")
+	}()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-port", "loopback:cli-record", "-emulation=false", "-record", recording, "-linger", "600ms"}
+	if code := Run(args, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "recorded") {
+		t.Fatalf("Expected the live run to print the frame, got %q", stdout.String())
+	}
+
+	var replayed bytes.Buffer
+	args = []string{"-replay", recording, "-replay-speed", "0", "-emulation=false", "-linger", "100ms"}
+	if code := Run(args, strings.NewReader(""), &replayed, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if replayed.String() != stdout.String() {
+		t.Errorf("Expected the replay to print %q, got %q", stdout.String(), replayed.String())
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if code := Run([]string{"-format", "xml"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for a bad flag value, got %d", code)
+	}
+
+	if code := Run([]string{"-receive"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for -receive without a protocol, got %d", code)
+	}
+
+	if code := Run([]string{"-queue-policy", "random"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for an unknown queue policy, got %d", code)
+	}
+
+	if code := Run([]string{"-stack", "lab1", "-send-file", "report.pdf"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for a framed file transfer over the raw stack, got %d", code)
+	}
+
+	if code := Run([]string{"-psk-file", "/nonexistent/psk"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for a missing key file, got %d", code)
+	}
+
+	if code := Run([]string{"-capture", "/nonexistent/dir/trace.pcapng"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for an unwritable capture file, got %d", code)
+	}
+
+	if code := Run([]string{"-profiles", "/nonexistent/profiles.yaml", "-profile", "missing"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("Expected usage exit code for an unknown profile, got %d", code)
+	}
+
+	if code := Run([]string{"-port", "/nonexistent/tty"}, strings.NewReader(""), &stdout, &stderr); code != exitLinkFailure {
+		t.Errorf("Expected link failure exit code for a missing port, got %d", code)
+	}
+}
+
+func TestProfileWithOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yaml")
+	data := "profiles:\n  - name: bench\n    transport:\n      port: loopback:bench\n    mac:\n      strategy: token\n      busy_probability: 0.5\n    station:\n      address: 7\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := parseFlags([]string{"-profiles", path, "-profile", "bench", "-mac", "csmacd"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opts.port != "loopback:bench" || opts.busyProb != 0.5 || opts.address != 7 {
+		t.Errorf("Expected the profile's port, probability and address, got %s, %v, %d", opts.port, opts.busyProb, opts.address)
+	}
+	if opts.mac != "csmacd" {
+		t.Errorf("Expected -mac to override the profile, got %s", opts.mac)
+	}
+	if opts.dataBits != 8 {
+		t.Errorf("Expected settings missing from the profile to keep their defaults, got %d data bits", opts.dataBits)
+	}
+}
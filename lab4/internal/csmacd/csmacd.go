@@ -1,6 +1,7 @@
 package csmacd
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -15,16 +16,49 @@ const (
 	ChannelCollision
 )
 
+// DetectionMode selects how collisions are discovered: by rolling
+// collisionProbability, or by comparing the transmitter's own echo with what
+// was written, as on a half-duplex RS-485 bus.
+type DetectionMode int
+
+const (
+	DetectionEmulated DetectionMode = iota
+	DetectionEcho
+)
+
+// JamPattern is written on the line after an echo mismatch, 32 bits as in
+// IEEE 802.3. It contains no frame flag.
+var JamPattern = []byte{0xAA, 0xAA, 0xAA, 0xAA}
+
+// IEEE 802.3 limits: a frame is dropped after MaxAttempts collisions and the
+// backoff window stops growing after BackoffLimit collisions. MaxDeferrals
+// bounds how often a frame waits for a busy channel, which 802.3 leaves to
+// the station.
+const (
+	MaxAttempts  = 16
+	BackoffLimit = 10
+	MaxDeferrals = 100
+
+	DefaultSlotTime    = 51200 * time.Nanosecond
+	DefaultJamDuration = 3200 * time.Nanosecond
+)
+
+var ErrExcessiveCollisions = errors.New("excessive collisions, transmission aborted")
+
+var ErrExcessiveDeferrals = errors.New("channel busy for too long, transmission aborted")
+
 type CSMACD struct {
 	channelState         ChannelState
 	channelMutex         sync.RWMutex
 	collisionCount       int
 	busyCount            int
 	totalAttempts        int
-	backoffAttempts      int
-	maxBackoff           int
+	backoffCount         int
+	slotTime             time.Duration
+	jamDuration          time.Duration
 	jamSignal            bool
 	emulationEnabled     bool
+	detectionMode        DetectionMode
 	busyProbability      float64
 	collisionProbability float64
 	onStateChange        func(ChannelState)
@@ -35,7 +69,8 @@ type CSMACD struct {
 func NewCSMACD() *CSMACD {
 	return &CSMACD{
 		channelState:         ChannelIdle,
-		maxBackoff:           10,
+		slotTime:             DefaultSlotTime,
+		jamDuration:          DefaultJamDuration,
 		emulationEnabled:     true,
 		busyProbability:      0.25,
 		collisionProbability: 0.75,
@@ -46,14 +81,66 @@ func NewCSMACD() *CSMACD {
 }
 
 func (c *CSMACD) SetEmulationEnabled(enabled bool) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
 	c.emulationEnabled = enabled
 }
 
+func (c *CSMACD) GetEmulationEnabled() bool {
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return c.emulationEnabled
+}
+
 func (c *CSMACD) SetProbabilities(busyProb, collisionProb float64) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
 	c.busyProbability = busyProb
 	c.collisionProbability = collisionProb
 }
 
+func (c *CSMACD) GetProbabilities() (busyProb, collisionProb float64) {
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return c.busyProbability, c.collisionProbability
+}
+
+func (c *CSMACD) SetDetectionMode(mode DetectionMode) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
+	c.detectionMode = mode
+}
+
+func (c *CSMACD) GetDetectionMode() DetectionMode {
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return c.detectionMode
+}
+
+func (c *CSMACD) SetSlotTime(slotTime time.Duration) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
+	c.slotTime = slotTime
+}
+
+func (c *CSMACD) GetSlotTime() time.Duration {
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return c.slotTime
+}
+
+func (c *CSMACD) SetJamDuration(jamDuration time.Duration) {
+	c.channelMutex.Lock()
+	defer c.channelMutex.Unlock()
+	c.jamDuration = jamDuration
+}
+
+func (c *CSMACD) GetJamDuration() time.Duration {
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return c.jamDuration
+}
+
 func (c *CSMACD) SetCallbacks(onStateChange func(ChannelState), onCollision func(), onChannelBusy func()) {
 	c.onStateChange = onStateChange
 	c.onCollision = onCollision
@@ -74,12 +161,12 @@ func (c *CSMACD) GetStatistics() (collisions, busy, totalAttempts int) {
 
 func (c *CSMACD) ListenToChannel() bool {
 	c.channelMutex.Lock()
-	defer c.channelMutex.Unlock()
 
 	c.totalAttempts++
 
 	if c.channelState == ChannelBusy {
 		c.busyCount++
+		c.channelMutex.Unlock()
 		c.onChannelBusy()
 		return false
 	}
@@ -95,52 +182,118 @@ func (c *CSMACD) ListenToChannel() bool {
 			c.channelMutex.Unlock()
 		}()
 
+		c.channelMutex.Unlock()
+		c.onChannelBusy()
 		return false
 	}
 
+	c.channelMutex.Unlock()
 	return true
 }
 
 func (c *CSMACD) DetectCollision() bool {
 	c.channelMutex.Lock()
-	defer c.channelMutex.Unlock()
+	if c.detectionMode != DetectionEmulated || !c.emulationEnabled || rand.Float64() >= c.collisionProbability {
+		c.channelMutex.Unlock()
+		return false
+	}
+	c.markCollision()
+	c.channelMutex.Unlock()
 
-	if c.emulationEnabled && rand.Float64() < c.collisionProbability {
-		c.channelState = ChannelCollision
-		c.collisionCount++
-		c.backoffAttempts++
+	c.onCollision()
+	return true
+}
 
-		go func() {
-			time.Sleep(time.Duration(rand.Intn(100)+50) * time.Millisecond)
-			c.channelMutex.Lock()
-			c.channelState = ChannelIdle
-			c.channelMutex.Unlock()
-		}()
+// ReportCollision records a collision observed on the line itself, such as an
+// echo that differs from the transmitted byte.
+func (c *CSMACD) ReportCollision() {
+	c.channelMutex.Lock()
+	c.markCollision()
+	c.channelMutex.Unlock()
 
-		return true
-	}
+	c.onCollision()
+}
+
+func (c *CSMACD) markCollision() {
+	c.channelState = ChannelCollision
+	c.collisionCount++
 
-	return false
+	go func() {
+		time.Sleep(time.Duration(rand.Intn(100)+50) * time.Millisecond)
+		c.channelMutex.Lock()
+		if c.channelState == ChannelCollision {
+			c.channelState = ChannelIdle
+		}
+		c.channelMutex.Unlock()
+	}()
 }
 
-func (c *CSMACD) CalculateBackoffDelay() time.Duration {
-	attempts := c.backoffAttempts
-	if attempts > c.maxBackoff {
-		attempts = c.maxBackoff
+// CalculateBackoffDelay picks r slot times with r uniform in [0, 2^k - 1],
+// where k is the collision count truncated to BackoffLimit.
+func (c *CSMACD) CalculateBackoffDelay(collisions int) time.Duration {
+	k := collisions
+	if k > BackoffLimit {
+		k = BackoffLimit
+	}
+	if k < 0 {
+		k = 0
 	}
 
-	slotTime := 51 * time.Microsecond
-	backoffWindow := (1 << attempts) - 1
+	slotTime := c.GetSlotTime()
+	backoffWindow := (1 << k) - 1
 	randomDelay := rand.Intn(backoffWindow + 1)
-	delay := time.Duration(randomDelay) * slotTime
 
-	return delay
+	return time.Duration(randomDelay) * slotTime
 }
 
-func (c *CSMACD) ResetBackoff() {
-	c.channelMutex.Lock()
-	defer c.channelMutex.Unlock()
-	c.backoffAttempts = 0
+// FrameBackoff tracks the collisions of a single frame, so that concurrent
+// senders never share an attempt counter.
+type FrameBackoff struct {
+	csma       *CSMACD
+	collisions int
+	deferrals  int
+}
+
+func (c *CSMACD) NewFrame() *FrameBackoff {
+	return &FrameBackoff{csma: c}
+}
+
+func (f *FrameBackoff) Collisions() int {
+	return f.collisions
+}
+
+func (f *FrameBackoff) Attempts() int {
+	return f.collisions + 1
+}
+
+func (f *FrameBackoff) Deferrals() int {
+	return f.deferrals
+}
+
+// Defer records that the frame found the channel busy, or returns
+// ErrExcessiveDeferrals once it has done so MaxDeferrals times.
+func (f *FrameBackoff) Defer() error {
+	f.deferrals++
+	if f.deferrals >= MaxDeferrals {
+		return ErrExcessiveDeferrals
+	}
+	return nil
+}
+
+// Collision records a collision of the frame and returns how long to back off
+// before the next attempt, or ErrExcessiveCollisions once MaxAttempts
+// collisions have happened.
+func (f *FrameBackoff) Collision() (time.Duration, error) {
+	f.collisions++
+	if f.collisions >= MaxAttempts {
+		return 0, ErrExcessiveCollisions
+	}
+
+	f.csma.channelMutex.Lock()
+	f.csma.backoffCount++
+	f.csma.channelMutex.Unlock()
+
+	return f.csma.CalculateBackoffDelay(f.collisions), nil
 }
 
 func (c *CSMACD) StartTransmission() bool {
@@ -167,8 +320,9 @@ func (c *CSMACD) SendJamSignal() {
 	defer c.channelMutex.Unlock()
 
 	c.jamSignal = true
+	jamDuration := c.jamDuration
 	go func() {
-		time.Sleep(4 * time.Microsecond)
+		time.Sleep(jamDuration)
 		c.channelMutex.Lock()
 		c.jamSignal = false
 		c.channelMutex.Unlock()
@@ -195,7 +349,8 @@ func (c *CSMACD) GetStateString() string {
 }
 
 func (c *CSMACD) GetStatisticsString() string {
-	collisions, busy, total := c.GetStatistics()
-	return fmt.Sprintf("Collisions: %d | Busy: %d | Total Attempts: %d | Backoff Attempts: %d",
-		collisions, busy, total, c.backoffAttempts)
+	c.channelMutex.RLock()
+	defer c.channelMutex.RUnlock()
+	return fmt.Sprintf("Collisions: %d | Busy: %d | Total Attempts: %d | Backoffs: %d",
+		c.collisionCount, c.busyCount, c.totalAttempts, c.backoffCount)
 }
@@ -1,6 +1,7 @@
 package csmacd
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -63,7 +64,7 @@ func TestCollisionDetection(t *testing.T) {
 func TestBackoffCalculation(t *testing.T) {
 	csma := NewCSMACD()
 
-	delay := csma.CalculateBackoffDelay()
+	delay := csma.CalculateBackoffDelay(1)
 	if delay < 0 {
 		t.Errorf("Expected backoff delay to be non-negative, got %v", delay)
 	}
@@ -73,6 +74,66 @@ func TestBackoffCalculation(t *testing.T) {
 	}
 }
 
+func TestBackoffWindowTruncated(t *testing.T) {
+	csma := NewCSMACD()
+	csma.SetSlotTime(time.Millisecond)
+
+	for _, collisions := range []int{1, 3, 10, 15} {
+		k := collisions
+		if k > BackoffLimit {
+			k = BackoffLimit
+		}
+		limit := time.Duration((1<<k)-1) * time.Millisecond
+
+		for i := 0; i < 200; i++ {
+			delay := csma.CalculateBackoffDelay(collisions)
+			if delay < 0 || delay > limit {
+				t.Fatalf("Expected delay after %d collisions within [0, %v], got %v", collisions, limit, delay)
+			}
+			if delay%time.Millisecond != 0 {
+				t.Fatalf("Expected delay to be a whole number of slots, got %v", delay)
+			}
+		}
+	}
+}
+
+func TestExcessiveCollisions(t *testing.T) {
+	csma := NewCSMACD()
+	frame := csma.NewFrame()
+
+	for i := 1; i < MaxAttempts; i++ {
+		if _, err := frame.Collision(); err != nil {
+			t.Fatalf("Expected collision %d to be retried, got %v", i, err)
+		}
+	}
+
+	_, err := frame.Collision()
+	if !errors.Is(err, ErrExcessiveCollisions) {
+		t.Errorf("Expected ErrExcessiveCollisions after %d collisions, got %v", MaxAttempts, err)
+	}
+
+	if other := csma.NewFrame(); other.Collisions() != 0 {
+		t.Errorf("Expected a new frame to start without collisions, got %d", other.Collisions())
+	}
+}
+
+func TestExcessiveDeferrals(t *testing.T) {
+	frame := NewCSMACD().NewFrame()
+
+	for i := 1; i < MaxDeferrals; i++ {
+		if err := frame.Defer(); err != nil {
+			t.Fatalf("Expected deferral %d to be retried, got %v", i, err)
+		}
+	}
+
+	if err := frame.Defer(); !errors.Is(err, ErrExcessiveDeferrals) {
+		t.Errorf("Expected ErrExcessiveDeferrals after %d deferrals, got %v", MaxDeferrals, err)
+	}
+	if frame.Attempts() != 1 {
+		t.Errorf("Expected deferrals not to count as attempts, got %d", frame.Attempts())
+	}
+}
+
 func TestStatistics(t *testing.T) {
 	csma := NewCSMACD()
 	csma.SetEmulationEnabled(false)
@@ -0,0 +1,240 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"oks/internal/packet"
+)
+
+// Event is anything published by a terminal. Subscribers switch on the
+// concrete type.
+type Event interface {
+	Timestamp() time.Time
+}
+
+type Stamp struct {
+	At time.Time
+}
+
+func (s Stamp) Timestamp() time.Time {
+	return s.At
+}
+
+func Now() Stamp {
+	return Stamp{At: time.Now()}
+}
+
+type FrameSent struct {
+	Stamp
+	Address  byte
+	Control  byte
+	Data     string
+	FCS      uint8
+	Attempts int
+	// Raw is what went onto the line: the stuffed frame with its flags, or
+	// the line with its CRLF on the raw stack.
+	Raw   []byte
+	Info  string
+	Trace *packet.FrameTrace
+	// Steps says what every pipeline stage did, one line per stage.
+	Steps string
+}
+
+type FrameReceived struct {
+	Stamp
+	Address byte
+	Control byte
+	Data    string
+	FCS     uint8
+	Raw     []byte
+	Trace   *packet.FrameTrace
+	Steps   string
+}
+
+// FrameCorrected carries a frame whose single bit error the FCS repaired. Bit
+// is the repaired data bit, counted from the first bit of data.
+type FrameCorrected struct {
+	Stamp
+	Address   byte
+	Control   byte
+	Received  string
+	Corrected string
+	FCS       uint8
+	Bit       int
+	Raw       []byte
+	Trace     *packet.FrameTrace
+	Steps     string
+}
+
+type FrameDropped struct {
+	Stamp
+	Address byte
+	Control byte
+	Data    string
+	FCS     uint8
+	Reason  string
+	Raw     []byte
+	Trace   *packet.FrameTrace
+	Steps   string
+}
+
+// FrameMalformed is what arrived between two flags when it does not destuff
+// into a frame. Raw holds the bytes as received, flags included.
+type FrameMalformed struct {
+	Stamp
+	Raw    []byte
+	Reason string
+}
+
+// StrayBytes are bytes the receiver discarded outside any frame.
+type StrayBytes struct {
+	Stamp
+	Data []byte
+}
+
+type Collision struct {
+	Stamp
+	Attempt int
+}
+
+type Backoff struct {
+	Stamp
+	Attempt int
+	Delay   time.Duration
+}
+
+type ChannelBusy struct {
+	Stamp
+	Attempt int
+}
+
+type LinkState int
+
+const (
+	LinkDown LinkState = iota
+	LinkUp
+	LinkError
+)
+
+func (s LinkState) String() string {
+	switch s {
+	case LinkDown:
+		return "down"
+	case LinkUp:
+		return "up"
+	case LinkError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+type LinkStateChanged struct {
+	Stamp
+	Port   string
+	State  LinkState
+	Status string
+	Err    error
+}
+
+type TokenArrived struct {
+	Stamp
+	Station byte
+}
+
+type TokenDeparted struct {
+	Stamp
+	Station byte
+}
+
+type TokenLost struct {
+	Stamp
+	Monitor byte
+}
+
+type TransferProgress struct {
+	Stamp
+	Sending    bool
+	Name       string
+	Done       int64
+	Total      int64
+	Throughput float64
+}
+
+// FileReceived ends an incoming transfer. Err is set when the file could not
+// be reassembled or failed its checksum; Data is only valid without it.
+type FileReceived struct {
+	Stamp
+	Source byte
+	Name   string
+	Data   []byte
+	Err    error
+}
+
+// Bus fans events out to every subscriber. Publishing never blocks: a
+// subscriber that falls behind loses events and can see how many.
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	bus     *Bus
+	events  chan Event
+	mutex   sync.Mutex
+	dropped int
+	closed  bool
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[*Subscription]struct{}{}}
+}
+
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	s := &Subscription{bus: b, events: make(chan Event, buffer)}
+
+	b.mutex.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mutex.Unlock()
+
+	return s
+}
+
+func (b *Bus) Publish(e Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for s := range b.subscribers {
+		select {
+		case s.events <- e:
+		default:
+			s.mutex.Lock()
+			s.dropped++
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Dropped() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dropped
+}
+
+// Close detaches the subscription and closes its channel.
+func (s *Subscription) Close() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.bus.subscribers, s)
+	close(s.events)
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishReachesAllSubscribers(t *testing.T) {
+	bus := NewBus()
+	first := bus.Subscribe(4)
+	second := bus.Subscribe(4)
+	defer first.Close()
+	defer second.Close()
+
+	bus.Publish(FrameSent{Stamp: Now(), Address: 0x01, Data: "hi"})
+
+	for _, sub := range []*Subscription{first, second} {
+		select {
+		case e := <-sub.Events():
+			sent, ok := e.(FrameSent)
+			if !ok || sent.Data != "hi" || sent.Address != 0x01 {
+				t.Errorf("Expected the published FrameSent, got %#v", e)
+			}
+			if sent.Timestamp().IsZero() {
+				t.Error("Expected the event to carry a timestamp")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected every subscriber to receive the event")
+		}
+	}
+}
+
+func TestSlowSubscriberDropsInsteadOfBlocking(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(1)
+	defer sub.Close()
+
+	bus.Publish(Collision{Stamp: Now(), Attempt: 1})
+	bus.Publish(Collision{Stamp: Now(), Attempt: 2})
+
+	if sub.Dropped() != 1 {
+		t.Errorf("Expected one dropped event, got %d", sub.Dropped())
+	}
+}
+
+func TestCloseStopsDelivery(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(1)
+	sub.Close()
+	sub.Close()
+
+	bus.Publish(LinkStateChanged{Stamp: Now(), State: LinkUp})
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected the events channel to be closed")
+	}
+}
@@ -0,0 +1,470 @@
+package filetransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Control bytes of file transfer frames. They carry data, so the 0x80 bit
+// that marks link control frames is clear.
+const (
+	ControlHeader byte = 0x10
+	ControlChunk  byte = 0x11
+	ControlEnd    byte = 0x12
+)
+
+const (
+	DefaultChunkSize = 64
+	MaxChunkSize     = 1024
+	// MaxChunks is the most chunks a transfer may have, which together with
+	// the chunk size bounds the size a header can announce.
+	MaxChunks       = 1 << 16
+	maxNameLength   = 255
+	headerFixedSize = 2 + 8 + 2 + sha256.Size + 1
+)
+
+const (
+	// DefaultMaxFileSize is the largest file a Receiver accepts unless told
+	// otherwise.
+	DefaultMaxFileSize = 16 << 20
+	// DefaultTransferTimeout is how long a Receiver keeps a transfer that
+	// receives no frames before giving up on it.
+	DefaultTransferTimeout = 30 * time.Second
+)
+
+var (
+	ErrChecksumMismatch = errors.New("SHA-256 mismatch")
+	ErrIncomplete       = errors.New("transfer incomplete")
+	ErrHeaderLost       = errors.New("file header lost")
+	ErrMalformed        = errors.New("malformed file transfer frame")
+	ErrTooLarge         = errors.New("file too large")
+	ErrTimeout          = errors.New("transfer timed out")
+)
+
+func IsTransferControl(control byte) bool {
+	return control == ControlHeader || control == ControlChunk || control == ControlEnd
+}
+
+type Header struct {
+	ID        uint16
+	Name      string
+	Size      int64
+	ChunkSize int
+	SHA256    [sha256.Size]byte
+}
+
+func (h Header) Chunks() int {
+	if h.ChunkSize <= 0 {
+		return 0
+	}
+	return int((h.Size + int64(h.ChunkSize) - 1) / int64(h.ChunkSize))
+}
+
+func (h Header) Encode() string {
+	name := h.Name
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	buf := make([]byte, headerFixedSize, headerFixedSize+len(name))
+	binary.BigEndian.PutUint16(buf[0:], h.ID)
+	binary.BigEndian.PutUint64(buf[2:], uint64(h.Size))
+	binary.BigEndian.PutUint16(buf[10:], uint16(h.ChunkSize))
+	copy(buf[12:], h.SHA256[:])
+	buf[12+sha256.Size] = byte(len(name))
+	return string(append(buf, name...))
+}
+
+func DecodeHeader(data string) (Header, error) {
+	if len(data) < headerFixedSize {
+		return Header{}, ErrMalformed
+	}
+	b := []byte(data)
+	h := Header{
+		ID:        binary.BigEndian.Uint16(b[0:]),
+		Size:      int64(binary.BigEndian.Uint64(b[2:])),
+		ChunkSize: int(binary.BigEndian.Uint16(b[10:])),
+	}
+	copy(h.SHA256[:], b[12:])
+	nameLength := int(b[12+sha256.Size])
+	if len(b) != headerFixedSize+nameLength || h.Size < 0 || h.ChunkSize == 0 || h.ChunkSize > MaxChunkSize ||
+		h.Size > int64(h.ChunkSize)*MaxChunks {
+		return Header{}, ErrMalformed
+	}
+	h.Name = string(b[headerFixedSize:])
+	return h, nil
+}
+
+func encodeChunk(id uint16, seq uint32, payload []byte) string {
+	buf := make([]byte, 6, 6+len(payload))
+	binary.BigEndian.PutUint16(buf[0:], id)
+	binary.BigEndian.PutUint32(buf[2:], seq)
+	return string(append(buf, payload...))
+}
+
+func decodeChunk(data string) (uint16, uint32, []byte, error) {
+	if len(data) < 6 {
+		return 0, 0, nil, ErrMalformed
+	}
+	b := []byte(data)
+	return binary.BigEndian.Uint16(b[0:]), binary.BigEndian.Uint32(b[2:]), b[6:], nil
+}
+
+func encodeEnd(id uint16, chunks int) string {
+	buf := make([]byte, 6)
+	binary.BigEndian.PutUint16(buf[0:], id)
+	binary.BigEndian.PutUint32(buf[2:], uint32(chunks))
+	return string(buf)
+}
+
+func decodeEnd(data string) (uint16, int, error) {
+	if len(data) != 6 {
+		return 0, 0, ErrMalformed
+	}
+	b := []byte(data)
+	return binary.BigEndian.Uint16(b[0:]), int(binary.BigEndian.Uint32(b[2:])), nil
+}
+
+type Direction int
+
+const (
+	Sending Direction = iota
+	Receiving
+)
+
+func (d Direction) String() string {
+	if d == Sending {
+		return "sending"
+	}
+	return "receiving"
+}
+
+type Progress struct {
+	Direction  Direction
+	Name       string
+	Done       int64
+	Total      int64
+	Elapsed    time.Duration
+	Throughput float64
+}
+
+func newProgress(direction Direction, name string, done, total int64, started time.Time) Progress {
+	p := Progress{Direction: direction, Name: name, Done: done, Total: total, Elapsed: time.Since(started)}
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.Throughput = float64(done) / seconds
+	}
+	return p
+}
+
+func (p Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 1
+	}
+	return float64(p.Done) / float64(p.Total)
+}
+
+// Link is what a transfer needs from a terminal.
+type Link interface {
+	SendPacketContext(ctx context.Context, address, control byte, data string) error
+}
+
+var (
+	idMutex sync.Mutex
+	lastID  = uint16(time.Now().UnixNano())
+)
+
+func nextID() uint16 {
+	idMutex.Lock()
+	defer idMutex.Unlock()
+	lastID++
+	return lastID
+}
+
+// Send transfers data as one header frame, one frame per chunk and an end
+// frame. progress may be nil.
+func Send(ctx context.Context, link Link, address byte, name string, data []byte, chunkSize int, progress func(Progress)) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize > MaxChunkSize {
+		return fmt.Errorf("chunk size %d exceeds %d bytes", chunkSize, MaxChunkSize)
+	}
+	if len(data) > chunkSize*MaxChunks {
+		return fmt.Errorf("%w: %d bytes need more than %d chunks of %d bytes", ErrTooLarge, len(data), MaxChunks, chunkSize)
+	}
+
+	header := Header{
+		ID:        nextID(),
+		Name:      filepath.Base(name),
+		Size:      int64(len(data)),
+		ChunkSize: chunkSize,
+		SHA256:    sha256.Sum256(data),
+	}
+	started := time.Now()
+
+	if err := link.SendPacketContext(ctx, address, ControlHeader, header.Encode()); err != nil {
+		return fmt.Errorf("sending header of %s: %w", header.Name, err)
+	}
+
+	for seq := 0; seq < header.Chunks(); seq++ {
+		start := seq * chunkSize
+		end := start + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if err := link.SendPacketContext(ctx, address, ControlChunk, encodeChunk(header.ID, uint32(seq), data[start:end])); err != nil {
+			return fmt.Errorf("sending chunk %d of %s: %w", seq, header.Name, err)
+		}
+		if progress != nil {
+			progress(newProgress(Sending, header.Name, int64(end), header.Size, started))
+		}
+	}
+
+	if err := link.SendPacketContext(ctx, address, ControlEnd, encodeEnd(header.ID, header.Chunks())); err != nil {
+		return fmt.Errorf("sending end of %s: %w", header.Name, err)
+	}
+	if progress != nil {
+		progress(newProgress(Sending, header.Name, header.Size, header.Size, started))
+	}
+	return nil
+}
+
+type File struct {
+	Name    string
+	Data    []byte
+	Source  byte
+	Elapsed time.Duration
+}
+
+type transfer struct {
+	header    Header
+	hasHeader bool
+	// rejected transfers were already reported failed; their frames are
+	// dropped until the end frame or the timeout removes them.
+	rejected bool
+	chunks   map[uint32][]byte
+	received int64
+	started  time.Time
+	lastSeen time.Time
+}
+
+// Receiver reassembles transfers from incoming frames. Transfers are keyed by
+// source address and transfer ID, so several may run at once. Chunks are
+// kept as they arrive, up to the maximum file size, and a transfer that
+// receives nothing for the timeout is reported failed and forgotten.
+type Receiver struct {
+	mutex       sync.Mutex
+	transfers   map[uint32]*transfer
+	maxFileSize int64
+	timeout     time.Duration
+	onProgress  func(Progress)
+	onComplete  func(File, error)
+}
+
+func NewReceiver() *Receiver {
+	return &Receiver{
+		transfers:   map[uint32]*transfer{},
+		maxFileSize: DefaultMaxFileSize,
+		timeout:     DefaultTransferTimeout,
+	}
+}
+
+// SetMaxFileSize sets the largest file accepted; bigger transfers fail with
+// ErrTooLarge.
+func (r *Receiver) SetMaxFileSize(size int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxFileSize = size
+}
+
+func (r *Receiver) SetTimeout(d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.timeout = d
+}
+
+func (r *Receiver) SetCallbacks(onProgress func(Progress), onComplete func(File, error)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.onProgress = onProgress
+	r.onComplete = onComplete
+}
+
+// HandleFrame consumes a file transfer frame and reports whether it was one.
+// Callbacks run on the caller's goroutine without the lock held.
+func (r *Receiver) HandleFrame(source, control byte, data string) bool {
+	if !IsTransferControl(control) {
+		return false
+	}
+
+	r.mutex.Lock()
+	onProgress, onComplete := r.onProgress, r.onComplete
+	failed := r.evict(time.Now())
+	var progress *Progress
+	var file File
+	var err error
+	completed := false
+
+	switch control {
+	case ControlHeader:
+		header, decodeErr := DecodeHeader(data)
+		if decodeErr != nil {
+			break
+		}
+		t := r.transfer(source, header.ID)
+		if t.rejected {
+			break
+		}
+		t.header = header
+		t.hasHeader = true
+		if header.Size > r.maxFileSize || t.received > header.Size {
+			failed = append(failed, t.reject(source, fmt.Errorf("%w: %s is %d bytes, at most %d are accepted", ErrTooLarge, header.Name, header.Size, r.maxFileSize)))
+			break
+		}
+		p := newProgress(Receiving, header.Name, t.received, header.Size, t.started)
+		progress = &p
+	case ControlChunk:
+		id, seq, payload, decodeErr := decodeChunk(data)
+		if decodeErr != nil {
+			break
+		}
+		t := r.transfer(source, id)
+		if t.rejected {
+			break
+		}
+		if _, seen := t.chunks[seq]; seen {
+			break
+		}
+		limit := r.maxFileSize
+		if t.hasHeader {
+			if int(seq) >= t.header.Chunks() || len(payload) > t.header.ChunkSize {
+				break
+			}
+			limit = t.header.Size
+		}
+		if t.received+int64(len(payload)) > limit {
+			failed = append(failed, t.reject(source, fmt.Errorf("%w: more than %d bytes received", ErrTooLarge, limit)))
+			break
+		}
+		t.chunks[seq] = payload
+		t.received += int64(len(payload))
+		if t.hasHeader {
+			p := newProgress(Receiving, t.header.Name, t.received, t.header.Size, t.started)
+			progress = &p
+		}
+	case ControlEnd:
+		id, chunks, decodeErr := decodeEnd(data)
+		if decodeErr != nil {
+			break
+		}
+		key := transferKey(source, id)
+		t := r.transfer(source, id)
+		delete(r.transfers, key)
+		if t.rejected {
+			break
+		}
+		file, err = t.assemble(source, chunks)
+		completed = true
+	}
+	r.mutex.Unlock()
+
+	if progress != nil && onProgress != nil {
+		onProgress(*progress)
+	}
+	if onComplete != nil {
+		for _, f := range failed {
+			onComplete(f.file, f.err)
+		}
+		if completed {
+			onComplete(file, err)
+		}
+	}
+	return true
+}
+
+// failure is a transfer given up on, reported once the lock is released.
+type failure struct {
+	file File
+	err  error
+}
+
+// reject frees what t received and marks it failed.
+func (t *transfer) reject(source byte, err error) failure {
+	t.rejected = true
+	t.chunks = nil
+	return failure{File{Name: t.header.Name, Source: source, Elapsed: time.Since(t.started)}, err}
+}
+
+// evict forgets the transfers that saw no frame within the timeout and
+// returns those not already reported.
+func (r *Receiver) evict(now time.Time) []failure {
+	var failed []failure
+	for key, t := range r.transfers {
+		if now.Sub(t.lastSeen) < r.timeout {
+			continue
+		}
+		delete(r.transfers, key)
+		if !t.rejected {
+			failed = append(failed, t.reject(byte(key>>16), fmt.Errorf("%w: %d of %d bytes received in %v", ErrTimeout, t.received, t.header.Size, r.timeout)))
+		}
+	}
+	return failed
+}
+
+func transferKey(source byte, id uint16) uint32 {
+	return uint32(source)<<16 | uint32(id)
+}
+
+func (r *Receiver) transfer(source byte, id uint16) *transfer {
+	key := transferKey(source, id)
+	t, ok := r.transfers[key]
+	if !ok {
+		t = &transfer{chunks: map[uint32][]byte{}, started: time.Now()}
+		r.transfers[key] = t
+	}
+	t.lastSeen = time.Now()
+	return t
+}
+
+func (t *transfer) assemble(source byte, announcedChunks int) (File, error) {
+	file := File{Name: t.header.Name, Source: source, Elapsed: time.Since(t.started)}
+	if !t.hasHeader {
+		return file, fmt.Errorf("%w: %d chunks received without a header", ErrHeaderLost, len(t.chunks))
+	}
+
+	expected := t.header.Chunks()
+	if announcedChunks != expected {
+		return file, fmt.Errorf("%w: header announces %d chunks, sender sent %d", ErrIncomplete, expected, announcedChunks)
+	}
+
+	var missing []int
+	data := make([]byte, 0, t.received)
+	for seq := 0; seq < expected; seq++ {
+		chunk, ok := t.chunks[uint32(seq)]
+		if !ok {
+			missing = append(missing, seq)
+			continue
+		}
+		data = append(data, chunk...)
+	}
+	if len(missing) > 0 {
+		sort.Ints(missing)
+		return file, fmt.Errorf("%w: %d of %d chunks missing (first %d)", ErrIncomplete, len(missing), expected, missing[0])
+	}
+
+	if int64(len(data)) != t.header.Size {
+		return file, fmt.Errorf("%w: got %d bytes, expected %d", ErrIncomplete, len(data), t.header.Size)
+	}
+	if sha256.Sum256(data) != t.header.SHA256 {
+		return file, fmt.Errorf("%w for %s", ErrChecksumMismatch, t.header.Name)
+	}
+
+	file.Data = data
+	return file, nil
+}
@@ -0,0 +1,172 @@
+package filetransfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type frame struct {
+	address byte
+	control byte
+	data    string
+}
+
+type recordingLink struct {
+	frames []frame
+}
+
+func (l *recordingLink) SendPacketContext(ctx context.Context, address, control byte, data string) error {
+	l.frames = append(l.frames, frame{address, control, data})
+	return nil
+}
+
+func sendAll(t *testing.T, data []byte, chunkSize int) *recordingLink {
+	t.Helper()
+	link := &recordingLink{}
+	if err := Send(context.Background(), link, 0x01, "dir/report.bin", data, chunkSize, nil); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	return link
+}
+
+func receive(frames []frame) (File, error) {
+	r := NewReceiver()
+	var file File
+	var result error
+	done := false
+	r.SetCallbacks(nil, func(f File, err error) {
+		file, result, done = f, err, true
+	})
+	for _, f := range frames {
+		r.HandleFrame(f.address, f.control, f.data)
+	}
+	if !done {
+		return File{}, errors.New("transfer never completed")
+	}
+	return file, result
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	h := Header{ID: 7, Name: "a.txt", Size: 1000, ChunkSize: 64}
+	h.SHA256[0] = 0xAB
+
+	decoded, err := DecodeHeader(h.Encode())
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if decoded != h {
+		t.Errorf("Expected %+v, got %+v", h, decoded)
+	}
+	if decoded.Chunks() != 16 {
+		t.Errorf("Expected 16 chunks, got %d", decoded.Chunks())
+	}
+}
+
+func TestTransferReassembles(t *testing.T) {
+	data := bytes.Repeat([]byte{0x00, 0x0E, 0xFF, 'x'}, 50)
+	link := sendAll(t, data, 32)
+
+	if len(link.frames) != 2+7 {
+		t.Errorf("Expected header, 7 chunks and end, got %d frames", len(link.frames))
+	}
+
+	file, err := receive(link.frames)
+	if err != nil {
+		t.Fatalf("Unexpected receive error: %v", err)
+	}
+	if file.Name != "report.bin" {
+		t.Errorf("Expected the base name report.bin, got %s", file.Name)
+	}
+	if !bytes.Equal(file.Data, data) {
+		t.Error("Expected the reassembled data to match")
+	}
+}
+
+func TestMissingChunkReported(t *testing.T) {
+	link := sendAll(t, bytes.Repeat([]byte("abcdefgh"), 10), 16)
+	frames := append(append([]frame{}, link.frames[:2]...), link.frames[3:]...)
+
+	if _, err := receive(frames); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Expected ErrIncomplete, got %v", err)
+	}
+}
+
+func TestMiscorrectedChunkCaughtBySHA256(t *testing.T) {
+	link := sendAll(t, bytes.Repeat([]byte("abcdefgh"), 10), 16)
+	corrupted := []byte(link.frames[2].data)
+	corrupted[len(corrupted)-1] ^= 0x01
+	link.frames[2].data = string(corrupted)
+
+	if _, err := receive(link.frames); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestLostHeaderReported(t *testing.T) {
+	link := sendAll(t, []byte("hello"), 16)
+
+	if _, err := receive(link.frames[1:]); !errors.Is(err, ErrHeaderLost) {
+		t.Errorf("Expected ErrHeaderLost, got %v", err)
+	}
+}
+
+func TestOversizedHeaderRejected(t *testing.T) {
+	h := Header{ID: 1, Name: "huge.bin", Size: int64(MaxChunkSize)*MaxChunks + 1, ChunkSize: MaxChunkSize}
+	if _, err := DecodeHeader(h.Encode()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Expected a size beyond %d chunks to be malformed, got %v", MaxChunks, err)
+	}
+
+	link := sendAll(t, bytes.Repeat([]byte("x"), 100), 16)
+	r := NewReceiver()
+	r.SetMaxFileSize(64)
+	var results []error
+	r.SetCallbacks(nil, func(f File, err error) { results = append(results, err) })
+	for _, f := range link.frames {
+		r.HandleFrame(f.address, f.control, f.data)
+	}
+	if len(results) != 1 || !errors.Is(results[0], ErrTooLarge) {
+		t.Errorf("Expected one ErrTooLarge, got %v", results)
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("Expected the rejected transfer to be forgotten, %d left", len(r.transfers))
+	}
+}
+
+func TestHeaderlessChunksLimited(t *testing.T) {
+	link := sendAll(t, bytes.Repeat([]byte("x"), 100), 16)
+	r := NewReceiver()
+	r.SetMaxFileSize(64)
+	var results []error
+	r.SetCallbacks(nil, func(f File, err error) { results = append(results, err) })
+	for _, f := range link.frames[1 : len(link.frames)-1] {
+		r.HandleFrame(f.address, f.control, f.data)
+	}
+	if len(results) != 1 || !errors.Is(results[0], ErrTooLarge) {
+		t.Errorf("Expected chunks beyond the maximum size to fail with ErrTooLarge, got %v", results)
+	}
+}
+
+func TestStaleTransferEvicted(t *testing.T) {
+	link := sendAll(t, []byte("hello world"), 4)
+	r := NewReceiver()
+	r.SetTimeout(10 * time.Millisecond)
+	var results []error
+	r.SetCallbacks(nil, func(f File, err error) { results = append(results, err) })
+
+	r.HandleFrame(link.frames[0].address, link.frames[0].control, link.frames[0].data)
+	time.Sleep(20 * time.Millisecond)
+	other := sendAll(t, []byte("next"), 4)
+	for _, f := range other.frames {
+		r.HandleFrame(f.address, f.control, f.data)
+	}
+
+	if len(results) != 2 || !errors.Is(results[0], ErrTimeout) || results[1] != nil {
+		t.Errorf("Expected the stale transfer to time out and the next one to complete, got %v", results)
+	}
+	if len(r.transfers) != 0 {
+		t.Errorf("Expected no transfers left, got %d", len(r.transfers))
+	}
+}
@@ -0,0 +1,304 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"oks/internal/events"
+)
+
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// Statuses an entry can have. Sent messages are always StatusSent; the rest
+// are the receiver's verdicts.
+const (
+	StatusSent      = "sent"
+	StatusOK        = "ok"
+	StatusCorrected = "corrected"
+	StatusDropped   = "dropped"
+	StatusMalformed = "malformed"
+	StatusStray     = "stray"
+)
+
+// Entry is one sent or received message. Data is the payload as delivered
+// (after correction), Received what arrived before correction and Raw the
+// stuffed bytes on the wire, when known.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Port      string    `json:"port"`
+	Direction string    `json:"direction"`
+	Status    string    `json:"status"`
+	Address   byte      `json:"address"`
+	Control   byte      `json:"control"`
+	Data      []byte    `json:"data"`
+	Received  []byte    `json:"received,omitempty"`
+	Raw       []byte    `json:"raw,omitempty"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// FromEvent turns a frame event into an entry. Other events give false.
+func FromEvent(port string, e events.Event) (Entry, bool) {
+	entry := Entry{Time: e.Timestamp(), Port: port, Direction: DirectionReceived}
+	switch ev := e.(type) {
+	case events.FrameSent:
+		entry.Direction = DirectionSent
+		entry.Status = StatusSent
+		entry.Address, entry.Control = ev.Address, ev.Control
+		entry.Data = []byte(ev.Data)
+		entry.Raw = ev.Raw
+		entry.Note = fmt.Sprintf("%d attempt(s)", ev.Attempts)
+	case events.FrameReceived:
+		entry.Status = StatusOK
+		entry.Address, entry.Control = ev.Address, ev.Control
+		entry.Data = []byte(ev.Data)
+		entry.Raw = ev.Raw
+	case events.FrameCorrected:
+		entry.Status = StatusCorrected
+		entry.Address, entry.Control = ev.Address, ev.Control
+		entry.Data = []byte(ev.Corrected)
+		entry.Received = []byte(ev.Received)
+		entry.Raw = ev.Raw
+		entry.Note = fmt.Sprintf("data bit %d repaired", ev.Bit)
+	case events.FrameDropped:
+		entry.Status = StatusDropped
+		entry.Address, entry.Control = ev.Address, ev.Control
+		entry.Data = []byte(ev.Data)
+		entry.Raw = ev.Raw
+		entry.Note = ev.Reason
+	case events.FrameMalformed:
+		entry.Status = StatusMalformed
+		entry.Raw = ev.Raw
+		entry.Note = ev.Reason
+	case events.StrayBytes:
+		entry.Status = StatusStray
+		entry.Raw = ev.Data
+	default:
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Store is the history of one port, kept in memory and appended to a JSON
+// Lines file. It is safe for concurrent use.
+type Store struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	entries []Entry
+}
+
+// DefaultDir is where the GUI keeps history files.
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "oks", "history"), nil
+}
+
+// PathFor returns the history file of a station on a port inside dir. The
+// stations of a shared loopback bus read the same port, so the address is
+// part of the name. Characters that are not safe in file names, such as the
+// slashes of /dev/ttyS0, become underscores.
+func PathFor(dir, port string, station byte) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, port)
+	name = strings.TrimLeft(name, "_.")
+	if name == "" {
+		name = "port"
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%02x.jsonl", name, station))
+}
+
+// Open loads the history at path and appends new entries to it, creating the
+// file and its directory when needed. Lines that do not decode, such as a
+// line cut short by a crash, are skipped.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history %s: %v", path, err)
+	}
+
+	s := &Store{path: path, file: file}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("Skipping history line %d of %s: %v", line, path, err)
+			continue
+		}
+		s.entries = append(s.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read history %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *Store) GetPath() string {
+	return s.path
+}
+
+func (s *Store) Append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("history %s is closed", s.path)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %v", err)
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+// Entries returns a copy of every entry, oldest first.
+func (s *Store) Entries() []Entry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Entry(nil), s.entries...)
+}
+
+// Clear empties the history, on disk as well.
+func (s *Store) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("history %s is closed", s.path)
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to clear history: %v", err)
+	}
+	s.entries = nil
+	return nil
+}
+
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Filter selects entries. Empty fields match everything; Text matches the
+// data, the data in hex and the note, ignoring case.
+type Filter struct {
+	Direction string
+	Status    string
+	Text      string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (f Filter) Match(e Entry) bool {
+	if f.Direction != "" && e.Direction != f.Direction {
+		return false
+	}
+	if f.Status != "" && e.Status != f.Status {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	for _, field := range []string{string(e.Data), hex.EncodeToString(e.Data), string(e.Received), e.Note} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func Search(entries []Entry, f Filter) []Entry {
+	var out []Entry
+	for _, e := range entries {
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+var csvHeader = []string{"time", "port", "direction", "status", "address", "control", "data", "data_hex", "received_hex", "raw_hex", "note"}
+
+// WriteCSV exports entries with a header row. Data is written both as text
+// and in hex, since payloads need not be printable.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		record := []string{
+			e.Time.Format(time.RFC3339Nano),
+			e.Port,
+			e.Direction,
+			e.Status,
+			fmt.Sprintf("0x%02X", e.Address),
+			fmt.Sprintf("0x%02X", e.Control),
+			string(e.Data),
+			hex.EncodeToString(e.Data),
+			hex.EncodeToString(e.Received),
+			hex.EncodeToString(e.Raw),
+			e.Note,
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJSON exports entries as one indented JSON array.
+func WriteJSON(w io.Writer, entries []Entry) error {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
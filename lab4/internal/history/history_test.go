@@ -0,0 +1,144 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"oks/internal/events"
+)
+
+func TestStoreReopensWithEntries(t *testing.T) {
+	path := PathFor(t.TempDir(), "/dev/ttyS0", 0x01)
+	if filepath.Base(path) != "dev_ttyS0-01.jsonl" {
+		t.Errorf("Expected dev_ttyS0-01.jsonl, got %s", filepath.Base(path))
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	sent, _ := FromEvent("/dev/ttyS0", events.FrameSent{Stamp: events.Now(), Address: 0x01, Data: "hello", Attempts: 2, Raw: []byte{0x0e, 0x01, 0x0e}})
+	received, _ := FromEvent("/dev/ttyS0", events.FrameCorrected{Stamp: events.Now(), Address: 0x02, Received: "hellp", Corrected: "hello", Bit: 38, Raw: []byte{0x0e, 0xff, 0x0e}})
+	for _, e := range []Entry{sent, received} {
+		if err := s.Append(e); err != nil {
+			t.Fatalf("Unexpected append error: %v", err)
+		}
+	}
+	s.Close()
+
+	// A line cut short by a crash is skipped.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"time":"2025`)
+	f.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected reopen error: %v", err)
+	}
+	defer s.Close()
+	entries := s.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Status != StatusSent || !bytes.Equal(entries[0].Raw, []byte{0x0e, 0x01, 0x0e}) {
+		t.Errorf("Expected the sent entry to keep its wire bytes, got %+v", entries[0])
+	}
+	if entries[1].Status != StatusCorrected || string(entries[1].Received) != "hellp" || !bytes.Equal(entries[1].Raw, []byte{0x0e, 0xff, 0x0e}) {
+		t.Errorf("Expected the corrected entry to survive a reopen, got %+v", entries[1])
+	}
+}
+
+func TestStationsOnOneBusKeepSeparateHistories(t *testing.T) {
+	dir := t.TempDir()
+	first, err := Open(PathFor(dir, "loopback:lab", 0x01))
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer first.Close()
+	second, err := Open(PathFor(dir, "loopback:lab", 0x02))
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer second.Close()
+
+	sent, _ := FromEvent("loopback:lab", events.FrameSent{Stamp: events.Now(), Address: 0x01, Data: "hello"})
+	if err := first.Append(sent); err != nil {
+		t.Fatalf("Unexpected append error: %v", err)
+	}
+	if err := second.Clear(); err != nil {
+		t.Fatalf("Unexpected clear error: %v", err)
+	}
+
+	if len(first.Entries()) != 1 || len(second.Entries()) != 0 {
+		t.Errorf("Expected 1 and 0 entries, got %d and %d", len(first.Entries()), len(second.Entries()))
+	}
+	reopened, _ := Open(first.GetPath())
+	defer reopened.Close()
+	if len(reopened.Entries()) != 1 {
+		t.Errorf("Expected the other station's clear to keep the entry, got %d", len(reopened.Entries()))
+	}
+}
+
+func TestFromEventIgnoresOtherEvents(t *testing.T) {
+	if _, ok := FromEvent("p", events.Collision{Stamp: events.Now()}); ok {
+		t.Error("Expected no entry for a collision")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Time: now.Add(-time.Hour), Direction: DirectionSent, Status: StatusSent, Data: []byte("ping")},
+		{Time: now, Direction: DirectionReceived, Status: StatusOK, Data: []byte("PONG")},
+		{Time: now, Direction: DirectionReceived, Status: StatusDropped, Data: []byte{0x0e}, Note: "double error"},
+	}
+
+	cases := []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 3},
+		{Filter{Direction: DirectionReceived}, 2},
+		{Filter{Status: StatusDropped}, 1},
+		{Filter{Text: "pong"}, 1},
+		{Filter{Text: "0e"}, 1},
+		{Filter{Text: "DOUBLE"}, 1},
+		{Filter{Since: now.Add(-time.Minute)}, 2},
+		{Filter{Direction: DirectionSent, Text: "pong"}, 0},
+	}
+	for _, c := range cases {
+		if got := Search(entries, c.filter); len(got) != c.want {
+			t.Errorf("Expected %d entries for %+v, got %d", c.want, c.filter, len(got))
+		}
+	}
+}
+
+func TestExports(t *testing.T) {
+	entries := []Entry{{Time: time.Unix(0, 0).UTC(), Port: "p", Direction: DirectionSent, Status: StatusSent, Address: 0x0A, Data: []byte("a,b\n")}}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, entries); err != nil {
+		t.Fatalf("Unexpected CSV error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(records) != 2 || records[1][4] != "0x0A" || records[1][6] != "a,b\n" || records[1][7] != "612c620a" {
+		t.Errorf("Unexpected CSV records %q", records)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, entries); err != nil {
+		t.Fatalf("Unexpected JSON error: %v", err)
+	}
+	var decoded []Entry
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 1 || string(decoded[0].Data) != "a,b\n" {
+		t.Errorf("Expected the entry back from JSON, got %+v (%v)", decoded, err)
+	}
+}
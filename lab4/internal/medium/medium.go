@@ -0,0 +1,236 @@
+package medium
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix selects a shared loopback medium instead of a serial device when it
+// starts a port name, e.g. "loopback:bus1".
+const Prefix = "loopback:"
+
+// DefaultByteTime is the time one 8N1 character occupies the line at 9600 baud.
+const DefaultByteTime = 1042 * time.Microsecond
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]*Medium{}
+)
+
+// Medium is a shared half-duplex bus. Every byte put on the line is delivered
+// to all attached ports including the sender; bytes sent by several ports in
+// the same byte slot are wired-OR'ed together, so a collision shows up as a
+// mismatching echo.
+type Medium struct {
+	mutex      sync.Mutex
+	name       string
+	byteTime   time.Duration
+	ports      map[*Port]struct{}
+	running    bool
+	collisions int
+	delivered  int
+}
+
+type Port struct {
+	medium      *Medium
+	rx          []byte
+	tx          []byte
+	readTimeout time.Duration
+	closed      bool
+	notify      chan struct{}
+	sent        chan struct{}
+}
+
+func New(name string, byteTime time.Duration) *Medium {
+	return &Medium{
+		name:     name,
+		byteTime: byteTime,
+		ports:    map[*Port]struct{}{},
+	}
+}
+
+// Shared returns the process-wide medium with the given name, creating it on
+// first use.
+func Shared(name string) *Medium {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	m, ok := registry[name]
+	if !ok {
+		m = New(name, DefaultByteTime)
+		registry[name] = m
+	}
+	return m
+}
+
+func IsLoopbackName(portName string) bool {
+	return strings.HasPrefix(portName, Prefix)
+}
+
+func NameFromPort(portName string) string {
+	return strings.TrimPrefix(portName, Prefix)
+}
+
+func (m *Medium) GetName() string {
+	return m.name
+}
+
+func (m *Medium) GetPortCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.ports)
+}
+
+func (m *Medium) GetStatistics() (delivered, collisions int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.delivered, m.collisions
+}
+
+// Open attaches a new port to the medium. The arguments mirror the serial
+// transport and are ignored.
+func (m *Medium) Open(name string, dataBits int) (io.ReadWriteCloser, error) {
+	return m.Attach(), nil
+}
+
+func (m *Medium) Attach() *Port {
+	p := &Port{
+		medium:      m,
+		readTimeout: 50 * time.Millisecond,
+		notify:      make(chan struct{}, 1),
+		sent:        make(chan struct{}, 1),
+	}
+
+	m.mutex.Lock()
+	m.ports[p] = struct{}{}
+	start := !m.running
+	m.running = true
+	m.mutex.Unlock()
+
+	if start {
+		go m.run()
+	}
+	return p
+}
+
+func (m *Medium) run() {
+	ticker := time.NewTicker(m.byteTime)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mutex.Lock()
+		if len(m.ports) == 0 {
+			m.running = false
+			m.mutex.Unlock()
+			return
+		}
+
+		var line byte
+		senders := 0
+		for p := range m.ports {
+			if len(p.tx) == 0 {
+				continue
+			}
+			line |= p.tx[0]
+			p.tx = p.tx[1:]
+			senders++
+			if len(p.tx) == 0 {
+				signal(p.sent)
+			}
+		}
+
+		if senders > 0 {
+			m.delivered++
+			if senders > 1 {
+				m.collisions++
+			}
+			for p := range m.ports {
+				p.rx = append(p.rx, line)
+				signal(p.notify)
+			}
+		}
+		m.mutex.Unlock()
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Write queues data on the line and returns once every byte has been sent.
+func (p *Port) Write(data []byte) (int, error) {
+	m := p.medium
+
+	m.mutex.Lock()
+	if p.closed {
+		m.mutex.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	p.tx = append(p.tx, data...)
+	m.mutex.Unlock()
+
+	for {
+		m.mutex.Lock()
+		pending := len(p.tx)
+		closed := p.closed
+		m.mutex.Unlock()
+
+		if closed {
+			return len(data) - pending, io.ErrClosedPipe
+		}
+		if pending == 0 {
+			return len(data), nil
+		}
+		<-p.sent
+	}
+}
+
+// Read behaves like a serial port with a read timeout: it returns whatever
+// arrived, or 0 bytes and no error once the timeout passes.
+func (p *Port) Read(buf []byte) (int, error) {
+	m := p.medium
+	timer := time.NewTimer(p.readTimeout)
+	defer timer.Stop()
+
+	for {
+		m.mutex.Lock()
+		if p.closed {
+			m.mutex.Unlock()
+			return 0, io.EOF
+		}
+		if len(p.rx) > 0 {
+			n := copy(buf, p.rx)
+			p.rx = p.rx[n:]
+			m.mutex.Unlock()
+			return n, nil
+		}
+		m.mutex.Unlock()
+
+		select {
+		case <-p.notify:
+		case <-timer.C:
+			return 0, nil
+		}
+	}
+}
+
+func (p *Port) Close() error {
+	m := p.medium
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if p.closed {
+		return fmt.Errorf("port on medium %s already closed", m.name)
+	}
+	p.closed = true
+	delete(m.ports, p)
+	signal(p.notify)
+	signal(p.sent)
+	return nil
+}
@@ -0,0 +1,99 @@
+package medium
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func readN(t *testing.T, p *Port, n int) []byte {
+	t.Helper()
+	var got []byte
+	buf := make([]byte, 64)
+	deadline := time.Now().Add(time.Second)
+	for len(got) < n && time.Now().Before(deadline) {
+		k, err := p.Read(buf)
+		if err != nil {
+			t.Fatalf("Unexpected read error: %v", err)
+		}
+		got = append(got, buf[:k]...)
+	}
+	return got
+}
+
+func TestBroadcastIncludesEcho(t *testing.T) {
+	m := New("test", 100*time.Microsecond)
+	a := m.Attach()
+	b := m.Attach()
+	defer a.Close()
+	defer b.Close()
+
+	payload := []byte{0x0E, 0x01, 0x02, 0x0E}
+	if _, err := a.Write(payload); err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	if echo := readN(t, a, len(payload)); !bytes.Equal(echo, payload) {
+		t.Errorf("Expected sender to read back %v, got %v", payload, echo)
+	}
+	if rx := readN(t, b, len(payload)); !bytes.Equal(rx, payload) {
+		t.Errorf("Expected receiver to get %v, got %v", payload, rx)
+	}
+}
+
+func TestSimultaneousWritesCollide(t *testing.T) {
+	m := New("test", time.Millisecond)
+	a := m.Attach()
+	b := m.Attach()
+	defer a.Close()
+	defer b.Close()
+
+	first := bytes.Repeat([]byte{0x0F}, 8)
+	second := bytes.Repeat([]byte{0xF0}, 8)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); a.Write(first) }()
+	go func() { defer wg.Done(); b.Write(second) }()
+	wg.Wait()
+
+	echo := readN(t, a, len(first))
+	if bytes.Equal(echo, first) {
+		t.Error("Expected overlapping transmissions to garble the echo")
+	}
+
+	if _, collisions := m.GetStatistics(); collisions == 0 {
+		t.Error("Expected the medium to count collisions")
+	}
+}
+
+func TestReadTimesOutAndClose(t *testing.T) {
+	m := New("test", time.Millisecond)
+	p := m.Attach()
+
+	n, err := p.Read(make([]byte, 8))
+	if n != 0 || err != nil {
+		t.Errorf("Expected an idle read to time out with no data, got n=%d err=%v", n, err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatalf("Unexpected close error: %v", err)
+	}
+	if _, err := p.Read(make([]byte, 8)); err != io.EOF {
+		t.Errorf("Expected EOF after close, got %v", err)
+	}
+	if m.GetPortCount() != 0 {
+		t.Errorf("Expected no ports attached after close, got %d", m.GetPortCount())
+	}
+}
+
+func TestSharedRegistry(t *testing.T) {
+	if Shared("bus") != Shared("bus") {
+		t.Error("Expected the same medium for the same name")
+	}
+	if !IsLoopbackName("loopback:bus") || NameFromPort("loopback:bus") != "bus" {
+		t.Error("Expected loopback port names to be recognised")
+	}
+}
@@ -0,0 +1,380 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ReceiveStatus int
+
+const (
+	ReceiveOK ReceiveStatus = iota
+	ReceiveCorrected
+	ReceiveDropped
+)
+
+type frameSample struct {
+	at          time.Time
+	accessDelay time.Duration
+	attempts    int
+	bytes       int
+}
+
+type durationSample struct {
+	at    time.Time
+	value time.Duration
+}
+
+type receiveSample struct {
+	at     time.Time
+	status ReceiveStatus
+}
+
+type compressionSample struct {
+	at         time.Time
+	original   int
+	compressed int
+}
+
+// Collector keeps MAC layer samples for a sliding time window. A zero window
+// keeps everything since the last Reset.
+type Collector struct {
+	mutex    sync.Mutex
+	window   time.Duration
+	started  time.Time
+	frames   []frameSample
+	backoffs []durationSample
+	airtime  []durationSample
+	receives []receiveSample
+	packed   []compressionSample
+	queue    queueGauge
+	now      func() time.Time
+}
+
+type queueGauge struct {
+	length  int
+	peak    int
+	dropped int
+}
+
+type Distribution struct {
+	Count int
+	Min   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+type Snapshot struct {
+	Elapsed      time.Duration
+	Frames       int
+	Bytes        int
+	AccessDelay  Distribution
+	Backoff      Distribution
+	MeanAttempts float64
+	MaxAttempts  int
+	Goodput      float64
+	Utilisation  float64
+	Received     int
+	Corrected    int
+	Dropped      int
+	FCSErrorRate float64
+	QueueLength  int
+	QueuePeak    int
+	QueueDropped int
+	// Compression covers frames sent with compression on: their payload
+	// bytes, the bytes that went into the frame and the ratio of the two.
+	CompressedFrames int
+	PayloadBytes     int
+	CompressedBytes  int
+	CompressionRatio float64
+}
+
+func NewCollector() *Collector {
+	c := &Collector{now: time.Now}
+	c.started = c.now()
+	return c
+}
+
+func (c *Collector) SetWindow(window time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.window = window
+	c.prune()
+}
+
+func (c *Collector) GetWindow() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.window
+}
+
+func (c *Collector) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.started = c.now()
+	c.frames = nil
+	c.backoffs = nil
+	c.airtime = nil
+	c.receives = nil
+	c.packed = nil
+	c.queue = queueGauge{length: c.queue.length, peak: c.queue.length}
+}
+
+// RecordFrame is called once per successfully sent frame. accessDelay runs
+// from the moment the frame was handed to the MAC until its successful
+// transmission started.
+func (c *Collector) RecordFrame(accessDelay time.Duration, attempts, bytes int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.frames = append(c.frames, frameSample{at: c.now(), accessDelay: accessDelay, attempts: attempts, bytes: bytes})
+	c.prune()
+}
+
+func (c *Collector) RecordBackoff(delay time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.backoffs = append(c.backoffs, durationSample{at: c.now(), value: delay})
+	c.prune()
+}
+
+// RecordTransmission accounts line occupancy of every write, collided or not.
+func (c *Collector) RecordTransmission(airtime time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.airtime = append(c.airtime, durationSample{at: c.now(), value: airtime})
+	c.prune()
+}
+
+func (c *Collector) RecordReceive(status ReceiveStatus) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.receives = append(c.receives, receiveSample{at: c.now(), status: status})
+	c.prune()
+}
+
+// RecordCompression is called for every frame sent with compression on,
+// with the payload size and the size it was sent with. Frames sent
+// uncompressed because compressing did not help count too.
+func (c *Collector) RecordCompression(original, compressed int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.packed = append(c.packed, compressionSample{at: c.now(), original: original, compressed: compressed})
+	c.prune()
+}
+
+// SetQueueLength tracks the transmit queue. Unlike the samples it is a gauge
+// and is not affected by the window.
+func (c *Collector) SetQueueLength(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queue.length = n
+	if n > c.queue.peak {
+		c.queue.peak = n
+	}
+}
+
+func (c *Collector) RecordQueueDrop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queue.dropped++
+}
+
+// BackoffSamples returns the backoff delays currently inside the window.
+func (c *Collector) BackoffSamples() []time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.prune()
+	values := make([]time.Duration, len(c.backoffs))
+	for i, s := range c.backoffs {
+		values[i] = s.value
+	}
+	return values
+}
+
+func (c *Collector) Snapshot() Snapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.prune()
+
+	snap := Snapshot{
+		Elapsed:      c.elapsed(),
+		QueueLength:  c.queue.length,
+		QueuePeak:    c.queue.peak,
+		QueueDropped: c.queue.dropped,
+	}
+
+	delays := make([]time.Duration, len(c.frames))
+	totalAttempts := 0
+	for i, f := range c.frames {
+		delays[i] = f.accessDelay
+		snap.Bytes += f.bytes
+		totalAttempts += f.attempts
+		if f.attempts > snap.MaxAttempts {
+			snap.MaxAttempts = f.attempts
+		}
+	}
+	snap.Frames = len(c.frames)
+	snap.AccessDelay = distribution(delays)
+	if snap.Frames > 0 {
+		snap.MeanAttempts = float64(totalAttempts) / float64(snap.Frames)
+	}
+
+	backoffs := make([]time.Duration, len(c.backoffs))
+	for i, b := range c.backoffs {
+		backoffs[i] = b.value
+	}
+	snap.Backoff = distribution(backoffs)
+
+	var busy time.Duration
+	for _, a := range c.airtime {
+		busy += a.value
+	}
+
+	for _, r := range c.receives {
+		switch r.status {
+		case ReceiveCorrected:
+			snap.Corrected++
+		case ReceiveDropped:
+			snap.Dropped++
+		}
+	}
+	snap.Received = len(c.receives)
+	if snap.Received > 0 {
+		snap.FCSErrorRate = float64(snap.Corrected+snap.Dropped) / float64(snap.Received)
+	}
+
+	for _, p := range c.packed {
+		snap.PayloadBytes += p.original
+		snap.CompressedBytes += p.compressed
+	}
+	snap.CompressedFrames = len(c.packed)
+	if snap.PayloadBytes > 0 {
+		snap.CompressionRatio = float64(snap.CompressedBytes) / float64(snap.PayloadBytes)
+	}
+
+	if seconds := snap.Elapsed.Seconds(); seconds > 0 {
+		snap.Goodput = float64(snap.Bytes) / seconds
+		snap.Utilisation = busy.Seconds() / seconds
+		if snap.Utilisation > 1 {
+			snap.Utilisation = 1
+		}
+	}
+
+	return snap
+}
+
+func (c *Collector) elapsed() time.Duration {
+	elapsed := c.now().Sub(c.started)
+	if c.window > 0 && elapsed > c.window {
+		return c.window
+	}
+	return elapsed
+}
+
+func (c *Collector) prune() {
+	if c.window <= 0 {
+		return
+	}
+	cutoff := c.now().Add(-c.window)
+
+	i := 0
+	for i < len(c.frames) && c.frames[i].at.Before(cutoff) {
+		i++
+	}
+	c.frames = c.frames[i:]
+
+	c.backoffs = pruneDurations(c.backoffs, cutoff)
+	c.airtime = pruneDurations(c.airtime, cutoff)
+
+	i = 0
+	for i < len(c.receives) && c.receives[i].at.Before(cutoff) {
+		i++
+	}
+	c.receives = c.receives[i:]
+
+	i = 0
+	for i < len(c.packed) && c.packed[i].at.Before(cutoff) {
+		i++
+	}
+	c.packed = c.packed[i:]
+}
+
+func pruneDurations(samples []durationSample, cutoff time.Time) []durationSample {
+	i := 0
+	for i < len(samples) && samples[i].at.Before(cutoff) {
+		i++
+	}
+	return samples[i:]
+}
+
+func distribution(values []time.Duration) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, v := range sorted {
+		total += v
+	}
+
+	return Distribution{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Mean:  total / time.Duration(len(sorted)),
+		P50:   Percentile(sorted, 50),
+		P90:   Percentile(sorted, 90),
+		P99:   Percentile(sorted, 99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// Percentile uses the nearest-rank method on an ascending slice.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// Airtime is how long n bytes occupy a line at the given baud rate with one
+// start and one stop bit per character.
+func Airtime(n, dataBits, baud int) time.Duration {
+	if baud <= 0 {
+		return 0
+	}
+	bits := n * (dataBits + 2)
+	return time.Duration(bits) * time.Second / time.Duration(baud)
+}
+
+func (s Snapshot) String() string {
+	text := fmt.Sprintf("Frames: %d | Goodput: %.1f B/s | Utilisation: %.1f%% | Attempts: %.2f avg\n"+
+		"Access delay p50/p90/p99: %v/%v/%v | Backoff p50/p90/p99: %v/%v/%v\n"+
+		"Received: %d | Corrected: %d | Dropped: %d | FCS error rate: %.1f%%\n"+
+		"Queue: %d (peak %d, dropped %d)",
+		s.Frames, s.Goodput, s.Utilisation*100, s.MeanAttempts,
+		s.AccessDelay.P50.Round(time.Millisecond), s.AccessDelay.P90.Round(time.Millisecond), s.AccessDelay.P99.Round(time.Millisecond),
+		s.Backoff.P50, s.Backoff.P90, s.Backoff.P99,
+		s.Received, s.Corrected, s.Dropped, s.FCSErrorRate*100,
+		s.QueueLength, s.QueuePeak, s.QueueDropped)
+	if s.CompressedFrames > 0 {
+		text += fmt.Sprintf("\nCompression: %d frame(s), %d B sent as %d B (%.0f%%)",
+			s.CompressedFrames, s.PayloadBytes, s.CompressedBytes, s.CompressionRatio*100)
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time { return f.t }
+
+func newTestCollector() (*Collector, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	c := NewCollector()
+	c.now = clock.now
+	c.Reset()
+	return c, clock
+}
+
+func TestPercentile(t *testing.T) {
+	var values []time.Duration
+	for i := 1; i <= 100; i++ {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+
+	cases := map[float64]time.Duration{
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+	for p, want := range cases {
+		if got := Percentile(values, p); got != want {
+			t.Errorf("Expected p%v to be %v, got %v", p, want, got)
+		}
+	}
+
+	if Percentile(nil, 50) != 0 {
+		t.Error("Expected percentile of no samples to be zero")
+	}
+}
+
+func TestSnapshotRates(t *testing.T) {
+	c, clock := newTestCollector()
+
+	c.RecordFrame(10*time.Millisecond, 1, 100)
+	c.RecordFrame(30*time.Millisecond, 3, 100)
+	c.RecordBackoff(2 * time.Millisecond)
+	c.RecordTransmission(500 * time.Millisecond)
+	c.RecordReceive(ReceiveOK)
+	c.RecordReceive(ReceiveCorrected)
+	c.RecordReceive(ReceiveDropped)
+	c.RecordReceive(ReceiveOK)
+	clock.t = clock.t.Add(2 * time.Second)
+
+	snap := c.Snapshot()
+	if snap.Frames != 2 || snap.Bytes != 200 {
+		t.Errorf("Expected 2 frames and 200 bytes, got %d frames and %d bytes", snap.Frames, snap.Bytes)
+	}
+	if snap.Goodput != 100 {
+		t.Errorf("Expected goodput of 100 B/s, got %v", snap.Goodput)
+	}
+	if snap.Utilisation != 0.25 {
+		t.Errorf("Expected utilisation of 0.25, got %v", snap.Utilisation)
+	}
+	if snap.MeanAttempts != 2 || snap.MaxAttempts != 3 {
+		t.Errorf("Expected mean 2 and max 3 attempts, got %v and %d", snap.MeanAttempts, snap.MaxAttempts)
+	}
+	if snap.FCSErrorRate != 0.5 {
+		t.Errorf("Expected FCS error rate of 0.5, got %v", snap.FCSErrorRate)
+	}
+	if snap.AccessDelay.Max != 30*time.Millisecond || snap.Backoff.Count != 1 {
+		t.Errorf("Unexpected distributions: %+v %+v", snap.AccessDelay, snap.Backoff)
+	}
+}
+
+func TestCompressionRatio(t *testing.T) {
+	c, _ := newTestCollector()
+	if snap := c.Snapshot(); snap.CompressionRatio != 0 || strings.Contains(snap.String(), "Compression") {
+		t.Errorf("Expected no compression figures without compressed frames, got %+v", snap)
+	}
+
+	c.RecordCompression(100, 40)
+	c.RecordCompression(10, 10)
+	snap := c.Snapshot()
+	if snap.CompressedFrames != 2 || snap.PayloadBytes != 110 || snap.CompressedBytes != 50 {
+		t.Errorf("Expected 2 frames of 110 B sent as 50 B, got %+v", snap)
+	}
+	if snap.CompressionRatio != 50.0/110 {
+		t.Errorf("Expected a ratio of %v, got %v", 50.0/110, snap.CompressionRatio)
+	}
+}
+
+func TestWindowAndReset(t *testing.T) {
+	c, clock := newTestCollector()
+	c.SetWindow(time.Minute)
+
+	c.RecordFrame(time.Millisecond, 1, 10)
+	clock.t = clock.t.Add(2 * time.Minute)
+	c.RecordFrame(time.Millisecond, 1, 20)
+
+	snap := c.Snapshot()
+	if snap.Frames != 1 || snap.Bytes != 20 {
+		t.Errorf("Expected only the frame inside the window, got %d frames and %d bytes", snap.Frames, snap.Bytes)
+	}
+	if snap.Elapsed != time.Minute {
+		t.Errorf("Expected elapsed time capped at the window, got %v", snap.Elapsed)
+	}
+
+	c.Reset()
+	if snap := c.Snapshot(); snap.Frames != 0 {
+		t.Errorf("Expected no frames after reset, got %d", snap.Frames)
+	}
+}
+
+func TestAirtime(t *testing.T) {
+	if got := Airtime(960, 8, 9600); got != time.Second {
+		t.Errorf("Expected 960 bytes at 9600 baud to take 1s, got %v", got)
+	}
+}
+
+func TestQueueGaugeSurvivesWindow(t *testing.T) {
+	c, clock := newTestCollector()
+	c.SetWindow(time.Second)
+
+	c.SetQueueLength(3)
+	c.SetQueueLength(1)
+	c.RecordQueueDrop()
+	clock.t = clock.t.Add(time.Minute)
+
+	snap := c.Snapshot()
+	if snap.QueueLength != 1 || snap.QueuePeak != 3 || snap.QueueDropped != 1 {
+		t.Errorf("Expected length 1, peak 3 and 1 drop, got %d, %d and %d", snap.QueueLength, snap.QueuePeak, snap.QueueDropped)
+	}
+
+	c.Reset()
+	snap = c.Snapshot()
+	if snap.QueuePeak != 1 || snap.QueueDropped != 0 {
+		t.Errorf("Expected reset to keep the current length as peak and clear drops, got peak %d and %d drops", snap.QueuePeak, snap.QueueDropped)
+	}
+}
@@ -23,6 +23,13 @@ func groupBinary(bits string) string {
 	return b.String()
 }
 
+// A 1 is inserted after every stuffPattern so the flag 00001110 never shows
+// up inside a frame.
+const (
+	stuffPattern   = "0000111"
+	stuffedPattern = stuffPattern + "1"
+)
+
 type BitStuffer struct{}
 
 func NewBitStuffer() *BitStuffer {
@@ -33,10 +40,9 @@ func (bs *BitStuffer) Stuff(binaryData string) string {
 	var result strings.Builder
 	i := 0
 	for i < len(binaryData) {
-		if i+7 <= len(binaryData) && binaryData[i:i+7] == "0000111" {
-			result.WriteString("0000111")
-			result.WriteByte('1')
-			i += 7
+		if i+len(stuffPattern) <= len(binaryData) && binaryData[i:i+len(stuffPattern)] == stuffPattern {
+			result.WriteString(stuffedPattern)
+			i += len(stuffPattern)
 			continue
 		}
 		result.WriteByte(binaryData[i])
@@ -49,9 +55,9 @@ func (bs *BitStuffer) Destuff(stuffedData string) string {
 	var result strings.Builder
 	i := 0
 	for i < len(stuffedData) {
-		if i+8 <= len(stuffedData) && stuffedData[i:i+8] == "00001111" {
-			result.WriteString("0000111")
-			i += 8
+		if i+len(stuffedPattern) <= len(stuffedData) && stuffedData[i:i+len(stuffedPattern)] == stuffedPattern {
+			result.WriteString(stuffPattern)
+			i += len(stuffedPattern)
 			continue
 		}
 		result.WriteByte(stuffedData[i])
@@ -60,17 +66,21 @@ func (bs *BitStuffer) Destuff(stuffedData string) string {
 	return result.String()
 }
 
-func (bs *BitStuffer) StuffPacket(p *Packet) string {
-	stuffedAddress := bs.Stuff(fmt.Sprintf("%08b", p.Address))
-	stuffedControl := bs.Stuff(fmt.Sprintf("%08b", p.Control))
-	stuffedData := bs.Stuff(BytesToBinaryString(p.Data))
-	stuffedFCS := bs.Stuff(fmt.Sprintf("%08b", p.FCS))
-
-	stuffedFrame := stuffedAddress + stuffedControl + stuffedData + stuffedFCS
+// stuffFrame stuffs address, control, data and FCS as one bit stream, the
+// same way the receiver destuffs it, and pads the result to whole bytes.
+// Stuffing the fields one by one would miss flag patterns that straddle two
+// fields.
+func (bs *BitStuffer) stuffFrame(address, control byte, dataBinary string, fcs uint8) string {
+	stuffedFrame := bs.Stuff(fmt.Sprintf("%08b", address) + fmt.Sprintf("%08b", control) + dataBinary + fmt.Sprintf("%08b", fcs))
 	pad := (8 - (len(stuffedFrame) % 8)) % 8
 	if pad > 0 {
 		stuffedFrame += strings.Repeat("0", pad)
 	}
+	return stuffedFrame
+}
+
+func (bs *BitStuffer) StuffPacket(p *Packet) string {
+	stuffedFrame := bs.stuffFrame(p.Address, p.Control, BytesToBinaryString(p.Data), p.FCS)
 
 	flagBinary := fmt.Sprintf("%08b", p.Flag)
 	finalBinary := flagBinary + stuffedFrame + flagBinary
@@ -88,7 +98,8 @@ func (bs *BitStuffer) DestuffPacket(receivedData string) *Packet {
 	startFlag := binaryData[0:8]
 	endFlag := binaryData[len(binaryData)-8:]
 
-	if startFlag != "00001110" || endFlag != "00001110" {
+	flagBinary := fmt.Sprintf("%08b", FlagByte)
+	if startFlag != flagBinary || endFlag != flagBinary {
 		return nil
 	}
 
@@ -111,7 +122,7 @@ func (bs *BitStuffer) DestuffPacket(receivedData string) *Packet {
 		}
 	}
 	frameDataBytes := BinaryStringToBytes(destuffedFrame)
-	fullFrame := string(byte(0x0E)) + string(frameDataBytes) + string(byte(0x0E))
+	fullFrame := string(FlagByte) + string(frameDataBytes) + string(FlagByte)
 
 	return ParseFrame(fullFrame)
 }
@@ -128,16 +139,7 @@ func (bs *BitStuffer) GetStuffedFrameInfo(p *Packet) string {
 
 	frameBinary := addressBinary + controlBinary + dataBinary + fcsBinary
 
-	stuffedAddress := bs.Stuff(addressBinary)
-	stuffedControl := bs.Stuff(controlBinary)
-	stuffedData := bs.Stuff(dataBinary)
-	stuffedFCS := bs.Stuff(fcsBinary)
-
-	stuffedFrame := stuffedAddress + stuffedControl + stuffedData + stuffedFCS
-	pad := (8 - (len(stuffedFrame) % 8)) % 8
-	if pad > 0 {
-		stuffedFrame += strings.Repeat("0", pad)
-	}
+	stuffedFrame := bs.stuffFrame(p.Address, p.Control, dataBinary, p.FCS)
 
 	flagBinary := fmt.Sprintf("%08b", p.Flag)
 	stuffedFull := flagBinary + stuffedFrame + flagBinary
@@ -205,16 +207,7 @@ func (bs *BitStuffer) GetTransmissionInfo(original *Packet, corrupted *Packet) s
 	controlBinary := fmt.Sprintf("%08b", original.Control)
 	fcsBinary := fmt.Sprintf("%08b", original.FCS)
 
-	stuffedAddress := bs.Stuff(addressBinary)
-	stuffedControl := bs.Stuff(controlBinary)
-	stuffedDataCorrupted := bs.Stuff(corruptedDataBinary)
-	stuffedFCS := bs.Stuff(fcsBinary)
-
-	stuffedFrame := stuffedAddress + stuffedControl + stuffedDataCorrupted + stuffedFCS
-	pad := (8 - (len(stuffedFrame) % 8)) % 8
-	if pad > 0 {
-		stuffedFrame += strings.Repeat("0", pad)
-	}
+	stuffedFrame := bs.stuffFrame(original.Address, original.Control, corruptedDataBinary, original.FCS)
 
 	flagBinary := fmt.Sprintf("%08b", original.Flag)
 	stuffedFull := flagBinary + stuffedFrame + flagBinary
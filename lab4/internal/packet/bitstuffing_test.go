@@ -0,0 +1,22 @@
+package packet
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestStuffPacketRoundTripsBinaryData(t *testing.T) {
+	bs := NewBitStuffer()
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, rng.Intn(64)+1)
+		rng.Read(data)
+		p := NewPacket(byte(rng.Intn(256)), byte(rng.Intn(0x80)), string(data))
+
+		got := bs.DestuffPacket(bs.StuffPacket(p))
+		if got == nil || got.Address != p.Address || got.Control != p.Control || got.Data != p.Data || got.FCS != p.FCS {
+			t.Fatalf("Expected frame %x to survive stuffing, got %+v", data, got)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// fcsGenerator is the CRC-8 polynomial x^8 + x^2 + x + 1 without its top bit.
+const fcsGenerator uint8 = 0x07
+
 type CyclicCode struct {
 	generator uint8
 	fcsLength int
@@ -12,7 +15,7 @@ type CyclicCode struct {
 
 func NewCyclicCode() *CyclicCode {
 	return &CyclicCode{
-		generator: 0x07, //полином x² + x + 1x
+		generator: fcsGenerator, //полином x² + x + 1x
 		fcsLength: 8,
 	}
 }
@@ -86,11 +89,22 @@ func (cc *CyclicCode) correctSingleError(data string, receivedFCS uint8) (string
 }
 
 func (cc *CyclicCode) SimulateBitCorruption(data string) string {
+	corrupted, _ := cc.corruptBits(data)
+	return corrupted
+}
+
+// corruptBits flips one or two data bits and returns their positions, counted
+// from the first bit of data.
+func (cc *CyclicCode) corruptBits(data string) (string, []int) {
 	rand.Seed(time.Now().UnixNano())
 
 	errorType := rand.Float32()
 	dataBinary := []byte(BytesToBinaryString(data))
+	if len(dataBinary) < 2 {
+		return data, nil
+	}
 
+	var flipped []int
 	if errorType < 0.25 {
 		bitPos := rand.Intn(len(dataBinary))
 		if dataBinary[bitPos] == '0' {
@@ -98,6 +112,7 @@ func (cc *CyclicCode) SimulateBitCorruption(data string) string {
 		} else {
 			dataBinary[bitPos] = '0'
 		}
+		flipped = []int{bitPos}
 	} else {
 		bitPos1 := rand.Intn(len(dataBinary))
 		bitPos2 := rand.Intn(len(dataBinary))
@@ -117,9 +132,10 @@ func (cc *CyclicCode) SimulateBitCorruption(data string) string {
 		} else {
 			dataBinary[bitPos2] = '0'
 		}
+		flipped = []int{bitPos1, bitPos2}
 	}
 
-	return BinaryStringToBytes(string(dataBinary))
+	return BinaryStringToBytes(string(dataBinary)), flipped
 }
 
 func (cc *CyclicCode) GetFCSLength() int {
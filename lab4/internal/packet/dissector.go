@@ -0,0 +1,35 @@
+package packet
+
+import (
+	_ "embed"
+	"strings"
+	"text/template"
+)
+
+//go:embed dissector.lua.tmpl
+var dissectorTemplate string
+
+// GenerateDissector returns a Wireshark Lua dissector for the frame format,
+// filled in from the constants the Go code uses. linkTypeRaw and
+// linkTypeFrame are the link types of the capture interfaces with the port
+// bytes and the decoded frames. The shipped copy lives in wireshark/oks.lua.
+func GenerateDissector(linkTypeRaw, linkTypeFrame uint16) string {
+	tmpl := template.Must(template.New("dissector").Parse(dissectorTemplate))
+
+	var out strings.Builder
+	err := tmpl.Execute(&out, map[string]any{
+		"Flag":           FlagByte,
+		"TokenControl":   TokenControl,
+		"Compressed":     CompressedControl,
+		"Encrypted":      EncryptedControl,
+		"Generator":      fcsGenerator,
+		"StuffPattern":   stuffPattern,
+		"StuffedPattern": stuffedPattern,
+		"LinkTypeRaw":    linkTypeRaw,
+		"LinkTypeFrame":  linkTypeFrame,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out.String()
+}
@@ -0,0 +1,152 @@
+package packet
+
+import (
+	"flag"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"oks/internal/capture"
+)
+
+var update = flag.Bool("update", false, "rewrite wireshark/oks.lua from the template")
+
+var shippedDissector = filepath.Join("..", "..", "wireshark", "oks.lua")
+
+func generateDissector() string {
+	return GenerateDissector(capture.LinkTypeRaw, capture.LinkTypeFrame)
+}
+
+func TestShippedDissectorUpToDate(t *testing.T) {
+	generated := generateDissector()
+	if *update {
+		if err := os.WriteFile(shippedDissector, []byte(generated), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shipped, err := os.ReadFile(shippedDissector)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the shipped dissector: %v", err)
+	}
+	if string(shipped) != generated {
+		t.Errorf("Expected %s to match GenerateDissector, run go test ./internal/packet -run Dissector -update", shippedDissector)
+	}
+}
+
+// loadDissector runs the dissector in plain Lua, where the Wireshark part is
+// skipped, and returns its decoding functions.
+func loadDissector(t *testing.T) (*lua.LState, *lua.LTable) {
+	t.Helper()
+	L := lua.NewState()
+	t.Cleanup(L.Close)
+	if err := L.DoString(generateDissector()); err != nil {
+		t.Fatalf("Unexpected Lua error: %v", err)
+	}
+	module, ok := L.Get(-1).(*lua.LTable)
+	if !ok {
+		t.Fatal("Expected the dissector to return its module table")
+	}
+	return L, module
+}
+
+func call(t *testing.T, L *lua.LState, module *lua.LTable, name string, arg string) lua.LValue {
+	t.Helper()
+	if err := L.CallByParam(lua.P{Fn: module.RawGetString(name), NRet: 1, Protect: true}, lua.LString(arg)); err != nil {
+		t.Fatalf("Unexpected error calling %s: %v", name, err)
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	return result
+}
+
+func checkFrame(t *testing.T, got lua.LValue, want *Packet, fcsOK bool) {
+	t.Helper()
+	frame, ok := got.(*lua.LTable)
+	if !ok {
+		t.Fatalf("Expected a decoded frame for %q, got %v", want.Data, got)
+	}
+	if lua.LVAsNumber(frame.RawGetString("address")) != lua.LNumber(want.Address) ||
+		lua.LVAsNumber(frame.RawGetString("control")) != lua.LNumber(want.Control) ||
+		lua.LVAsString(frame.RawGetString("data")) != want.Data ||
+		lua.LVAsNumber(frame.RawGetString("fcs")) != lua.LNumber(want.FCS) {
+		t.Errorf("Expected %+v, got address %v, control %v, data %q, FCS %v", *want,
+			frame.RawGetString("address"), frame.RawGetString("control"),
+			lua.LVAsString(frame.RawGetString("data")), frame.RawGetString("fcs"))
+	}
+	if lua.LVAsBool(frame.RawGetString("fcs_ok")) != fcsOK {
+		t.Errorf("Expected fcs_ok %v for %q", fcsOK, want.Data)
+	}
+	if lua.LVAsBool(frame.RawGetString("token")) != want.IsToken() {
+		t.Errorf("Expected token %v for control 0x%02X", want.IsToken(), want.Control)
+	}
+}
+
+func TestDissectorDecodesStuffedFrames(t *testing.T) {
+	L, module := loadDissector(t)
+	bs := NewBitStuffer()
+	rng := rand.New(rand.NewSource(40))
+
+	packets := []*Packet{NewTokenPacket(0x02), NewPacket(0x01, 0x00, "hello")}
+	for i := 0; i < 200; i++ {
+		data := make([]byte, rng.Intn(40))
+		rng.Read(data)
+		packets = append(packets, NewPacket(byte(rng.Intn(256)), byte(rng.Intn(0x80)), string(data)))
+	}
+
+	for _, p := range packets {
+		checkFrame(t, call(t, L, module, "decode", bs.StuffPacket(p)), p, true)
+		checkFrame(t, call(t, L, module, "decode_frame", p.GetFrameData()), p, true)
+	}
+}
+
+func TestDissectorFlagsCorruptedFrames(t *testing.T) {
+	L, module := loadDissector(t)
+	p := NewPacket(0x01, 0x00, "corrupted")
+	p.Data = "corruptet"
+
+	checkFrame(t, call(t, L, module, "decode", NewBitStuffer().StuffPacket(p)), p, false)
+}
+
+func TestDissectorAcceptsXORChecksum(t *testing.T) {
+	L, module := loadDissector(t)
+	p := NewPacket(0x01, 0x00, "stuffed")
+	p.FCS = p.XORChecksum()
+
+	got := call(t, L, module, "decode", NewBitStuffer().StuffPacket(p))
+	checkFrame(t, got, p, true)
+	if kind := lua.LVAsString(got.(*lua.LTable).RawGetString("fcs_kind")); kind != "xor" {
+		t.Errorf("Expected the FCS to be recognised as xor, got %q", kind)
+	}
+}
+
+func TestDissectorReadsControlFlags(t *testing.T) {
+	L, module := loadDissector(t)
+	p := NewPacket(0x01, CompressedControl|EncryptedControl, "sealed")
+
+	got := call(t, L, module, "decode_frame", p.GetFrameData()).(*lua.LTable)
+	if !lua.LVAsBool(got.RawGetString("compressed")) || !lua.LVAsBool(got.RawGetString("encrypted")) {
+		t.Errorf("Expected the frame to be flagged compressed and encrypted, got %v and %v",
+			got.RawGetString("compressed"), got.RawGetString("encrypted"))
+	}
+}
+
+func TestDissectorSplitsPortChunks(t *testing.T) {
+	L, module := loadDissector(t)
+	bs := NewBitStuffer()
+	first, second := NewPacket(0x01, 0x00, "one"), NewPacket(0x02, 0x00, "two")
+	chunk := "\x00\xFF" + bs.StuffPacket(first) + bs.StuffPacket(second) + "\x0E\x01"
+
+	frames, ok := call(t, L, module, "frames", chunk).(*lua.LTable)
+	if !ok || frames.Len() != 2 {
+		t.Fatalf("Expected 2 frames in the chunk, got %v", frames)
+	}
+	checkFrame(t, frames.RawGetInt(1), first, true)
+	checkFrame(t, frames.RawGetInt(2), second, true)
+	if offset := lua.LVAsNumber(frames.RawGetInt(1).(*lua.LTable).RawGetString("offset")); offset != 2 {
+		t.Errorf("Expected the first frame at offset 2, got %v", offset)
+	}
+}
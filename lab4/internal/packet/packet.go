@@ -7,6 +7,21 @@ import (
 	"strings"
 )
 
+// FlagByte opens and closes every frame on the wire.
+const FlagByte byte = 0x0E
+
+// TokenControl marks a token frame; its Address field carries the station
+// the token is handed to.
+const TokenControl byte = 0x80
+
+// CompressedControl is set in the control byte of a frame whose data is
+// compressed.
+const CompressedControl byte = 0x40
+
+// EncryptedControl is set in the control byte of a frame whose data is
+// sealed with the pre-shared key.
+const EncryptedControl byte = 0x20
+
 type Packet struct {
 	Flag       byte
 	Address    byte
@@ -18,7 +33,7 @@ type Packet struct {
 
 func NewPacket(address, control byte, data string) *Packet {
 	p := &Packet{
-		Flag:       0x0E,
+		Flag:       FlagByte,
 		Address:    address,
 		Control:    control,
 		Data:       data,
@@ -28,6 +43,21 @@ func NewPacket(address, control byte, data string) *Packet {
 	return p
 }
 
+func NewTokenPacket(destination byte) *Packet {
+	return NewPacket(destination, TokenControl, "")
+}
+
+func (p *Packet) IsToken() bool {
+	return IsTokenControl(p.Control)
+}
+
+// IsTokenControl reports whether control marks a token frame. Only the exact
+// value does: other frames with the 0x80 bit set carry data and are
+// compressed and sealed like any other.
+func IsTokenControl(control byte) bool {
+	return control == TokenControl
+}
+
 func (p *Packet) CalculateFCS() uint8 {
 	return p.cyclicCode.CalculateFCS(p.Data)
 }
@@ -36,14 +66,28 @@ func (p *Packet) VerifyFCS() bool {
 	return p.cyclicCode.VerifyFCS(p.Data, p.FCS)
 }
 
+// XORChecksum is the simpler FCS of the stuffed-only stack: address, control
+// and every data byte XORed together.
+func (p *Packet) XORChecksum() uint8 {
+	fcs := p.Address ^ p.Control
+	for i := 0; i < len(p.Data); i++ {
+		fcs ^= p.Data[i]
+	}
+	return fcs
+}
+
 func (p *Packet) DetectAndCorrectErrors() (bool, int, string) {
 	return p.cyclicCode.DetectErrors(p.Data, p.FCS)
 }
 
-func (p *Packet) SimulateCorruption() {
+// SimulateCorruption flips data bits and keeps the FCS of the original data.
+// It returns the flipped positions, counted from the first data bit.
+func (p *Packet) SimulateCorruption() []int {
 	originalFCS := p.FCS
-	p.Data = p.cyclicCode.SimulateBitCorruption(p.Data)
+	var flipped []int
+	p.Data, flipped = p.cyclicCode.corruptBits(p.Data)
 	p.FCS = originalFCS
+	return flipped
 }
 
 func (p *Packet) ToString() string {
@@ -84,7 +128,7 @@ func BinaryStringToBytes(binStr string) string {
 }
 
 func (p *Packet) GetFrameData() string {
-	return string([]byte{p.Address, p.Control}) + p.Data + string(p.FCS)
+	return string([]byte{p.Address, p.Control}) + p.Data + string([]byte{p.FCS})
 }
 
 func (p *Packet) CreateFrame() string {
@@ -96,7 +140,7 @@ func ParseFrame(frameData string) *Packet {
 		return nil
 	}
 
-	if frameData[0] != 0x0E || frameData[len(frameData)-1] != 0x0E {
+	if frameData[0] != FlagByte || frameData[len(frameData)-1] != FlagByte {
 		return nil
 	}
 
@@ -107,7 +151,7 @@ func ParseFrame(frameData string) *Packet {
 	}
 
 	packet := &Packet{
-		Flag:       0x0E,
+		Flag:       FlagByte,
 		Address:    packetData[0],
 		Control:    packetData[1],
 		cyclicCode: NewCyclicCode(),
@@ -0,0 +1,13 @@
+package packet
+
+import "testing"
+
+func TestGetFrameDataKeepsFCSOneByte(t *testing.T) {
+	p := NewPacket(0x01, 0x00, "hi")
+	p.FCS = 0xC3
+
+	frame := p.GetFrameData()
+	if len(frame) != 5 || frame[4] != 0xC3 {
+		t.Errorf("Expected the FCS 0xC3 as the fifth and last byte, got % X", frame)
+	}
+}
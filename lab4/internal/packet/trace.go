@@ -0,0 +1,249 @@
+package packet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is the part of a frame a bit belongs to.
+type Field int
+
+const (
+	FieldFlag Field = iota
+	FieldAddress
+	FieldControl
+	FieldData
+	FieldFCS
+	FieldPadding
+)
+
+func (f Field) String() string {
+	switch f {
+	case FieldFlag:
+		return "flag"
+	case FieldAddress:
+		return "address"
+	case FieldControl:
+		return "control"
+	case FieldData:
+		return "data"
+	case FieldFCS:
+		return "FCS"
+	case FieldPadding:
+		return "padding"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceBit is one bit on the wire. Offset is the bit's position within its
+// field before stuffing, or -1 for stuffed and padding bits.
+type TraceBit struct {
+	Value   byte
+	Field   Field
+	Offset  int
+	Stuffed bool
+	Flipped bool
+}
+
+// FrameTrace is a frame bit by bit as it was put on or taken off the wire,
+// flags included.
+type FrameTrace struct {
+	Bits []TraceBit
+}
+
+// String returns the bits as 0 and 1 characters.
+func (t *FrameTrace) String() string {
+	var b strings.Builder
+	for _, bit := range t.Bits {
+		b.WriteByte('0' + bit.Value)
+	}
+	return b.String()
+}
+
+// Counts returns how many bits were stuffed, flipped and padded.
+func (t *FrameTrace) Counts() (stuffed, flipped, padding int) {
+	for _, bit := range t.Bits {
+		switch {
+		case bit.Stuffed:
+			stuffed++
+		case bit.Field == FieldPadding:
+			padding++
+		}
+		if bit.Flipped {
+			flipped++
+		}
+	}
+	return stuffed, flipped, padding
+}
+
+// Describe explains a single bit, for tooltips and the inspector.
+func (t *FrameTrace) Describe(i int) string {
+	if i < 0 || i >= len(t.Bits) {
+		return ""
+	}
+	bit := t.Bits[i]
+	text := fmt.Sprintf("Bit %d (byte %d, bit %d): %d", i, i/8, i%8, bit.Value)
+	switch {
+	case bit.Stuffed:
+		text += ", inserted by bit stuffing"
+	case bit.Field == FieldPadding:
+		text += ", padding to a whole byte"
+	case bit.Field == FieldData:
+		text += fmt.Sprintf(", data byte %d bit %d", bit.Offset/8, bit.Offset%8)
+	default:
+		text += fmt.Sprintf(", %s bit %d", bit.Field, bit.Offset)
+	}
+	if bit.Flipped {
+		text += ", flipped by corruption"
+	}
+	return text
+}
+
+// markFlipped marks data bits by their position counted from the first data
+// bit.
+func (t *FrameTrace) markFlipped(dataBits []int) {
+	positions := map[int]bool{}
+	for _, p := range dataBits {
+		positions[p] = true
+	}
+	for i := range t.Bits {
+		if t.Bits[i].Field == FieldData && !t.Bits[i].Stuffed && positions[t.Bits[i].Offset] {
+			t.Bits[i].Flipped = true
+		}
+	}
+}
+
+func traceBits(bits string, field Field) []TraceBit {
+	out := make([]TraceBit, len(bits))
+	for i := range bits {
+		out[i] = TraceBit{Value: bits[i] - '0', Field: field, Offset: i}
+	}
+	return out
+}
+
+// TracePacket stuffs p like StuffPacket and records where every bit came
+// from. flipped are the data bits SimulateCorruption inverted.
+func (bs *BitStuffer) TracePacket(p *Packet, flipped []int) *FrameTrace {
+	var frame []TraceBit
+	frame = append(frame, traceBits(fmt.Sprintf("%08b", p.Address), FieldAddress)...)
+	frame = append(frame, traceBits(fmt.Sprintf("%08b", p.Control), FieldControl)...)
+	frame = append(frame, traceBits(BytesToBinaryString(p.Data), FieldData)...)
+	frame = append(frame, traceBits(fmt.Sprintf("%08b", p.FCS), FieldFCS)...)
+
+	flag := traceBits(fmt.Sprintf("%08b", p.Flag), FieldFlag)
+	trace := &FrameTrace{Bits: append([]TraceBit(nil), flag...)}
+
+	matches := func(i int) bool {
+		if i+len(stuffPattern) > len(frame) {
+			return false
+		}
+		for j := 0; j < len(stuffPattern); j++ {
+			if frame[i+j].Value != stuffPattern[j]-'0' {
+				return false
+			}
+		}
+		return true
+	}
+	stuffedLength := 0
+	for i := 0; i < len(frame); {
+		if matches(i) {
+			trace.Bits = append(trace.Bits, frame[i:i+len(stuffPattern)]...)
+			trace.Bits = append(trace.Bits, TraceBit{Value: 1, Field: frame[i+len(stuffPattern)-1].Field, Offset: -1, Stuffed: true})
+			i += len(stuffPattern)
+			stuffedLength += len(stuffedPattern)
+			continue
+		}
+		trace.Bits = append(trace.Bits, frame[i])
+		i++
+		stuffedLength++
+	}
+	for ; stuffedLength%8 != 0; stuffedLength++ {
+		trace.Bits = append(trace.Bits, TraceBit{Field: FieldPadding, Offset: -1})
+	}
+
+	trace.Bits = append(trace.Bits, flag...)
+	trace.markFlipped(flipped)
+	return trace
+}
+
+// TraceFrame destuffs a received frame like DestuffPacket and records where
+// every bit on the wire went. It returns nil when DestuffPacket would reject
+// the frame's flags.
+func (bs *BitStuffer) TraceFrame(receivedData string) *FrameTrace {
+	binaryData := BytesToBinaryString(receivedData)
+	flagBinary := fmt.Sprintf("%08b", FlagByte)
+	if len(binaryData) < 16 || binaryData[:8] != flagBinary || binaryData[len(binaryData)-8:] != flagBinary {
+		return nil
+	}
+
+	stuffed := binaryData[8 : len(binaryData)-8]
+	var wire []TraceBit
+	var destuffed []int // wire index of every destuffed bit
+	for i := 0; i < len(stuffed); {
+		if i+len(stuffedPattern) <= len(stuffed) && stuffed[i:i+len(stuffedPattern)] == stuffedPattern {
+			for j := 0; j < len(stuffPattern); j++ {
+				destuffed = append(destuffed, len(wire))
+				wire = append(wire, TraceBit{Value: stuffed[i+j] - '0'})
+			}
+			wire = append(wire, TraceBit{Value: 1, Offset: -1, Stuffed: true})
+			i += len(stuffedPattern)
+			continue
+		}
+		destuffed = append(destuffed, len(wire))
+		wire = append(wire, TraceBit{Value: stuffed[i] - '0'})
+		i++
+	}
+
+	// The same trailing zeros DestuffPacket trims are the sender's padding.
+	if rem := len(destuffed) % 8; rem != 0 {
+		for trim := rem; trim > 0 && wire[destuffed[len(destuffed)-1]].Value == 0; trim-- {
+			last := destuffed[len(destuffed)-1]
+			wire[last].Field = FieldPadding
+			wire[last].Offset = -1
+			destuffed = destuffed[:len(destuffed)-1]
+		}
+	}
+
+	length := (len(destuffed) + 7) / 8 * 8
+	for n, w := range destuffed {
+		switch {
+		case n < 8:
+			wire[w].Field, wire[w].Offset = FieldAddress, n
+		case n < 16:
+			wire[w].Field, wire[w].Offset = FieldControl, n-8
+		case n >= length-8 && length >= 24:
+			wire[w].Field, wire[w].Offset = FieldFCS, n-(length-8)
+		default:
+			wire[w].Field, wire[w].Offset = FieldData, n-16
+		}
+	}
+	for i := range wire {
+		if wire[i].Stuffed && i > 0 {
+			wire[i].Field = wire[i-1].Field
+		}
+	}
+
+	flag := traceBits(flagBinary, FieldFlag)
+	bits := append(append(append([]TraceBit(nil), flag...), wire...), flag...)
+	return &FrameTrace{Bits: bits}
+}
+
+// MarkCorrected marks the data bits that differ between what arrived and
+// what the FCS corrected it to.
+func (t *FrameTrace) MarkCorrected(received, corrected string) {
+	t.markFlipped(DiffBits(received, corrected))
+}
+
+// DiffBits returns the positions of the bits that differ between a and b,
+// counted from the first bit.
+func DiffBits(a, b string) []int {
+	x, y := BytesToBinaryString(a), BytesToBinaryString(b)
+	var positions []int
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
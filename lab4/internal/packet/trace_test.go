@@ -0,0 +1,73 @@
+package packet
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTraceMatchesStuffedFrame(t *testing.T) {
+	bs := NewBitStuffer()
+	rng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 500; i++ {
+		data := make([]byte, rng.Intn(32)+1)
+		rng.Read(data)
+		p := NewPacket(byte(rng.Intn(256)), byte(rng.Intn(0x80)), string(data))
+		stuffed := bs.StuffPacket(p)
+
+		sent := bs.TracePacket(p, nil)
+		if sent.String() != BytesToBinaryString(stuffed) {
+			t.Fatalf("Expected the trace of %x to match StuffPacket", data)
+		}
+
+		received := bs.TraceFrame(stuffed)
+		if received == nil || len(received.Bits) != len(sent.Bits) {
+			t.Fatalf("Expected the received trace of %x to cover the same bits", data)
+		}
+		for j := range sent.Bits {
+			if received.Bits[j] != sent.Bits[j] {
+				t.Fatalf("Expected bit %d of %x to be %+v on both sides, got %+v", j, data, sent.Bits[j], received.Bits[j])
+			}
+		}
+	}
+}
+
+func TestTraceMarksStuffedBits(t *testing.T) {
+	bs := NewBitStuffer()
+	// 0x0E in the data contains the pattern 0000111 and must be stuffed.
+	trace := bs.TracePacket(NewPacket(0x01, 0x00, "\x0e"), nil)
+
+	stuffed, flipped, _ := trace.Counts()
+	if stuffed == 0 || flipped != 0 {
+		t.Errorf("Expected stuffed bits and no flipped bits, got %d and %d", stuffed, flipped)
+	}
+	for i, bit := range trace.Bits {
+		if bit.Stuffed && (trace.Bits[i-1].Field != FieldData || bit.Value != 1) {
+			t.Errorf("Expected the stuffed bit %d to be a 1 inside the data field, got %+v", i, bit)
+		}
+	}
+}
+
+func TestTraceMarksFlippedBits(t *testing.T) {
+	bs := NewBitStuffer()
+	original := NewPacket(0x01, 0x00, "corruption")
+	corrupted := NewPacket(0x01, 0x00, "corruption")
+	positions := corrupted.SimulateCorruption()
+
+	trace := bs.TracePacket(corrupted, positions)
+	if _, flipped, _ := trace.Counts(); flipped != len(positions) {
+		t.Errorf("Expected %d flipped bits, got %d", len(positions), flipped)
+	}
+
+	received := bs.TraceFrame(bs.StuffPacket(corrupted))
+	received.MarkCorrected(corrupted.Data, original.Data)
+	if _, flipped, _ := received.Counts(); flipped != len(positions) {
+		t.Errorf("Expected the receiver to mark %d flipped bits, got %d", len(positions), flipped)
+	}
+}
+
+func TestTraceFrameRejectsMissingFlags(t *testing.T) {
+	if NewBitStuffer().TraceFrame("\x01\x02\x03") != nil {
+		t.Error("Expected no trace for a frame without flags")
+	}
+}
@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"oks/internal/packet"
+)
+
+// MinPSKLength is the shortest pre-shared key accepted.
+const MinPSKLength = 8
+
+// senderSize is the length of the random sender ID of a session.
+const senderSize = 4
+
+// sealedHeader is the sender address, the sender ID and the counter in
+// front of the ciphertext of every sealed frame.
+const sealedHeader = 1 + senderSize + 8
+
+// Session is the key derived from a pre-shared key together with the
+// counters that keep frames from being replayed. A terminal keeps one per
+// key, so the counters outlive the pipelines built for single frames.
+//
+// The protection has limits. The counters seen are only kept in memory, so
+// a new session, after a restart or a new key, accepts frames recorded
+// earlier until a newer frame from their sender arrives. Token frames are
+// not sealed: anyone on the line can pass, take or drop the token, though
+// it never carries data.
+//
+// Nonces and counters are kept per session rather than per address: every
+// session picks a random sender ID, so stations left at the same default
+// address neither reuse a nonce nor drop each other's frames as replays.
+type Session struct {
+	aead   cipher.AEAD
+	sender [senderSize]byte
+
+	mu      sync.Mutex
+	counter uint64
+	// seen is the highest counter accepted from every sender ID.
+	seen map[[senderSize]byte]uint64
+}
+
+// NewSession derives an AES-256-GCM key from psk with SHA-256. The send
+// counter starts at the current time in nanoseconds, so it keeps growing
+// across restarts and a nonce is never used twice with the same key.
+func NewSession(psk string) (*Session, error) {
+	if len(psk) < MinPSKLength {
+		return nil, fmt.Errorf("pre-shared key must be at least %d characters", MinPSKLength)
+	}
+	key := sha256.Sum256([]byte(psk))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{aead: aead, counter: uint64(time.Now().UnixNano()), seen: make(map[[senderSize]byte]uint64)}
+	if _, err := rand.Read(s.sender[:]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Session) next() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counter++
+	return s.counter
+}
+
+// accept records counter for sender unless it is not above the last one
+// accepted from it.
+func (s *Session) accept(sender [senderSize]byte, counter uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.seen[sender]; ok && counter <= last {
+		return false
+	}
+	s.seen[sender] = counter
+	return true
+}
+
+// nonce is the sender ID and the counter. Sessions sharing a key pick
+// their own sender IDs, so their nonces never meet.
+func (s *Session) nonce(sender [senderSize]byte, counter uint64) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	copy(nonce, sender[:])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+// AEADStage seals the data with AES-GCM and sets packet.EncryptedControl in
+// the control byte. The sealed data is the sender address, the session's
+// sender ID, a counter and the ciphertext with its tag; address, control
+// and sender address are bound to it as associated data, so a frame moved
+// to another station or with its header changed fails authentication.
+//
+// Without a session the stage sends data as it is and drops sealed frames.
+// With one it drops frames that are not sealed, fail authentication, carry
+// the session's own sender ID or repeat a counter already seen from their
+// sender. Token frames pass untouched either way.
+type AEADStage struct {
+	session *Session
+	source  byte
+}
+
+// NewAEADStage seals frames sent from source. session is nil when
+// encryption is off.
+func NewAEADStage(session *Session, source byte) *AEADStage {
+	return &AEADStage{session: session, source: source}
+}
+
+func (s *AEADStage) Name() string { return "aead" }
+
+func associatedData(address, control, source byte) []byte {
+	return []byte{address, control, source}
+}
+
+func (s *AEADStage) Encode(f *Frame) error {
+	if f.Control&packet.EncryptedControl != 0 {
+		return fmt.Errorf("control 0x%02X uses the encryption flag 0x%02X", f.Control, packet.EncryptedControl)
+	}
+	if s.session == nil || packet.IsTokenControl(f.Control) {
+		f.Note("encryption off")
+		return nil
+	}
+
+	counter := s.session.next()
+	f.Control |= packet.EncryptedControl
+	header := make([]byte, sealedHeader, sealedHeader+len(f.Data)+s.session.aead.Overhead())
+	header[0] = s.source
+	copy(header[1:], s.session.sender[:])
+	binary.BigEndian.PutUint64(header[1+senderSize:], counter)
+	sealed := s.session.aead.Seal(header, s.session.nonce(s.session.sender, counter), []byte(f.Data), associatedData(f.Address, f.Control, s.source))
+	f.Note("%d byte(s) sealed to %d, counter %d", len(f.Data), len(sealed), counter)
+	f.Data = string(sealed)
+	return nil
+}
+
+func (s *AEADStage) Decode(f *Frame) error {
+	if packet.IsTokenControl(f.Control) {
+		f.Note("token")
+		return nil
+	}
+	sealed := f.Control&packet.EncryptedControl != 0
+	switch {
+	case !sealed && s.session == nil:
+		f.Note("not encrypted")
+		return nil
+	case !sealed:
+		return &DropError{Stage: s.Name(), Reason: "forged: frame is not encrypted"}
+	case s.session == nil:
+		return &DropError{Stage: s.Name(), Reason: "encrypted, but no pre-shared key is set"}
+	case len(f.Data) < sealedHeader+s.session.aead.Overhead():
+		return &DropError{Stage: s.Name(), Reason: "forged: sealed data too short"}
+	}
+
+	data := []byte(f.Data)
+	source := data[0]
+	var sender [senderSize]byte
+	copy(sender[:], data[1:])
+	counter := binary.BigEndian.Uint64(data[1+senderSize : sealedHeader])
+	plain, err := s.session.aead.Open(nil, s.session.nonce(sender, counter), data[sealedHeader:], associatedData(f.Address, f.Control, source))
+	if err != nil && f.Corrected {
+		// The FCS stage below flipped a bit back, but a sealed frame that
+		// still fails was garbled by more errors than it can correct.
+		return &DropError{Stage: s.Name(), Reason: fmt.Sprintf("corrupted: authentication failed after data bit %d was corrected", f.Bit)}
+	}
+	if err != nil {
+		return &DropError{Stage: s.Name(), Reason: fmt.Sprintf("forged: authentication failed for a frame from 0x%02X", source)}
+	}
+	if sender == s.session.sender {
+		return &DropError{Stage: s.Name(), Reason: fmt.Sprintf("replayed: frame from 0x%02X carries this session's own sender ID", source)}
+	}
+	if !s.session.accept(sender, counter) {
+		return &DropError{Stage: s.Name(), Reason: fmt.Sprintf("replayed: counter %d from 0x%02X (sender %X) was already seen", counter, source, sender)}
+	}
+
+	f.Note("from 0x%02X (sender %X), counter %d authenticated", source, sender, counter)
+	f.Data = string(plain)
+	f.Control &^= packet.EncryptedControl
+	return nil
+}
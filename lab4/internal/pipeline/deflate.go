@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+
+	"oks/internal/packet"
+)
+
+// maxInflated bounds what a compressed frame may inflate to, so a forged
+// frame cannot exhaust memory.
+const maxInflated = 64 * 1024
+
+// DeflateStage compresses the data with DEFLATE and sets
+// packet.CompressedControl in the control byte. Data that does not get
+// smaller, which is common for short messages, is sent as it is without the
+// flag. Decoding inflates every flagged frame, whether or not this side
+// compresses.
+type DeflateStage struct {
+	enabled bool
+}
+
+func NewDeflateStage(enabled bool) *DeflateStage {
+	return &DeflateStage{enabled: enabled}
+}
+
+func (s *DeflateStage) Name() string { return "deflate" }
+
+func (s *DeflateStage) Encode(f *Frame) error {
+	if f.Control&packet.CompressedControl != 0 {
+		return fmt.Errorf("control 0x%02X uses the compression flag 0x%02X", f.Control, packet.CompressedControl)
+	}
+	if !s.enabled || packet.IsTokenControl(f.Control) {
+		f.Note("compression off")
+		return nil
+	}
+
+	compressed, err := deflate(f.Data)
+	if err != nil {
+		return err
+	}
+	if len(compressed) >= len(f.Data) {
+		f.CompressedSize = len(f.Data)
+		f.Note("%d byte(s) sent uncompressed, DEFLATE would need %d", len(f.Data), len(compressed))
+		return nil
+	}
+
+	f.Note("%d byte(s) compressed to %d (%.0f%%)", len(f.Data), len(compressed), float64(len(compressed))*100/float64(len(f.Data)))
+	f.Data = compressed
+	f.Control |= packet.CompressedControl
+	f.CompressedSize = len(compressed)
+	return nil
+}
+
+func (s *DeflateStage) Decode(f *Frame) error {
+	if f.Control&packet.CompressedControl == 0 || packet.IsTokenControl(f.Control) {
+		f.Note("not compressed")
+		return nil
+	}
+
+	data, err := inflate(f.Data)
+	if err != nil {
+		return &DropError{Stage: s.Name(), Reason: fmt.Sprintf("does not inflate: %v", err)}
+	}
+	f.Note("%d byte(s) inflated to %d", len(f.Data), len(data))
+	f.Data = data
+	f.Control &^= packet.CompressedControl
+	return nil
+}
+
+func deflate(data string) (string, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func inflate(data string) (string, error) {
+	r := flate.NewReader(bytes.NewReader([]byte(data)))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxInflated+1))
+	if err != nil {
+		return "", err
+	}
+	if len(out) > maxInflated {
+		return "", fmt.Errorf("more than %d bytes", maxInflated)
+	}
+	return string(out), nil
+}
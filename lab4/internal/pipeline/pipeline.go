@@ -0,0 +1,222 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"oks/internal/packet"
+)
+
+// Stage is one layer of the protocol stack. Encode works on a frame on its
+// way down to the line, Decode undoes it on the way up. A stage changes the
+// frame in place and leaves a note on what it did with Frame.Note.
+type Stage interface {
+	Name() string
+	Encode(f *Frame) error
+	Decode(f *Frame) error
+}
+
+// Frame is a frame passing through the stages. Encoding starts with Payload
+// and ends with Wire, decoding the other way round; the fields in between
+// belong to the stages that set them.
+type Frame struct {
+	Address byte
+	Control byte
+	// Payload is the data as the user sent or receives it, Data the same
+	// data as the current stage sees it.
+	Payload string
+	Data    string
+	FCS     uint8
+	// Wire is the bytes on the line.
+	Wire string
+
+	// Clean is the data before the noise stage flipped the bits in Flipped.
+	Clean   string
+	Flipped []int
+	// Received is the data as it arrived when a stage corrected it, Bit the
+	// first bit it corrected.
+	Received  string
+	Corrected bool
+	Bit       int
+
+	// CompressedSize is the size of the data after the compression stage,
+	// zero when compression is off.
+	CompressedSize int
+
+	// Bits is the bit-level trace of a stuffed frame and Info its structure
+	// as markdown.
+	Bits *packet.FrameTrace
+	Info string
+
+	// Trace has a step for every stage the frame went through.
+	Trace Trace
+	note  string
+}
+
+// Note records what the current stage did, for its step in the trace.
+func (f *Frame) Note(format string, args ...any) {
+	f.note = fmt.Sprintf(format, args...)
+}
+
+// Packet is the frame as the packet package sees it, for captures.
+func (f *Frame) Packet() *packet.Packet {
+	p := packet.NewPacket(f.Address, f.Control, f.Data)
+	p.FCS = f.FCS
+	return p
+}
+
+// describe is the frame as the trace shows it after a stage: the wire bytes
+// once encoding has produced them, the fields otherwise.
+func (f *Frame) describe(encoding bool) string {
+	if encoding && f.Wire != "" {
+		return fmt.Sprintf("%d byte(s) on the wire", len(f.Wire))
+	}
+	return fmt.Sprintf("address 0x%02X, control 0x%02X, %d data byte(s), FCS 0x%02X", f.Address, f.Control, len(f.Data), f.FCS)
+}
+
+// Step is what one stage did to a frame.
+type Step struct {
+	Stage  string
+	Result string
+	Note   string
+}
+
+// Trace lists the steps of a frame in the order they ran.
+type Trace []Step
+
+func (t Trace) String() string {
+	var lines []string
+	for _, s := range t {
+		line := s.Stage + ": " + s.Result
+		if s.Note != "" {
+			line += " (" + s.Note + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (t Trace) Markdown(title string) string {
+	var md strings.Builder
+	md.WriteString(fmt.Sprintf("**%s:**\n\n", title))
+	for _, s := range t {
+		md.WriteString(fmt.Sprintf("- **%s:** %s", s.Stage, s.Result))
+		if s.Note != "" {
+			md.WriteString(" — " + s.Note)
+		}
+		md.WriteString("\n")
+	}
+	return md.String()
+}
+
+// MalformedError is returned for bytes that do not decode into a frame.
+type MalformedError struct {
+	Stage  string
+	Reason string
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("malformed frame at %s: %s", e.Stage, e.Reason)
+}
+
+// DropError is returned when a stage rejects a frame, such as one with an
+// error it cannot correct.
+type DropError struct {
+	Stage  string
+	Reason string
+}
+
+func (e *DropError) Error() string {
+	return fmt.Sprintf("frame dropped at %s: %s", e.Stage, e.Reason)
+}
+
+// Pipeline runs its stages from the top down to encode and from the bottom
+// up to decode, and traces every step.
+type Pipeline struct {
+	stages []Stage
+}
+
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Options are the settings stages are built with.
+type Options struct {
+	DataBits int
+	Compress bool
+	// Session seals frames sent from Source; nil leaves them in the clear.
+	Session *Session
+	Source  byte
+}
+
+// Build composes a pipeline from stage names, top down. The stages are
+// line, deflate, aead, fcs-xor, fcs-crc8, noise and stuffing.
+func Build(names []string, opts Options) (*Pipeline, error) {
+	var stages []Stage
+	for _, name := range names {
+		switch name {
+		case "line":
+			stages = append(stages, NewLineStage(opts.DataBits))
+		case "deflate":
+			stages = append(stages, NewDeflateStage(opts.Compress))
+		case "aead":
+			stages = append(stages, NewAEADStage(opts.Session, opts.Source))
+		case "fcs-xor":
+			stages = append(stages, NewXORStage())
+		case "fcs-crc8":
+			stages = append(stages, NewCRCStage())
+		case "noise":
+			stages = append(stages, NewNoiseStage())
+		case "stuffing":
+			stages = append(stages, NewStuffingStage())
+		default:
+			return nil, fmt.Errorf("unknown pipeline stage %q", name)
+		}
+	}
+	return New(stages...), nil
+}
+
+func (p *Pipeline) Names() []string {
+	names := make([]string, len(p.stages))
+	for i, s := range p.stages {
+		names[i] = s.Name()
+	}
+	return names
+}
+
+// Encode turns a payload into the bytes to write. The frame is returned
+// with its trace even when a stage fails.
+func (p *Pipeline) Encode(address, control byte, payload string) (*Frame, error) {
+	f := &Frame{Address: address, Control: control, Payload: payload, Data: payload, Bit: -1}
+	for _, s := range p.stages {
+		if err := p.run(f, s, s.Encode, true); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// Decode turns the bytes of one frame back into its payload. On a
+// MalformedError or DropError the frame holds what was decoded so far.
+func (p *Pipeline) Decode(wire string) (*Frame, error) {
+	f := &Frame{Wire: wire, Bit: -1}
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		s := p.stages[i]
+		if err := p.run(f, s, s.Decode, false); err != nil {
+			return f, err
+		}
+	}
+	f.Payload = f.Data
+	return f, nil
+}
+
+func (p *Pipeline) run(f *Frame, s Stage, fn func(*Frame) error, encoding bool) error {
+	f.note = ""
+	err := fn(f)
+	step := Step{Stage: s.Name(), Result: f.describe(encoding), Note: f.note}
+	if err != nil {
+		step.Result = err.Error()
+	}
+	f.Trace = append(f.Trace, step)
+	return err
+}
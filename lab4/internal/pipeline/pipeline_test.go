@@ -0,0 +1,308 @@
+package pipeline
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"oks/internal/packet"
+	"oks/internal/stack"
+)
+
+// flipStage flips one data bit on the way down, like NoiseStage but
+// predictably.
+type flipStage struct {
+	bit int
+}
+
+func (s flipStage) Name() string { return "flip" }
+
+func (s flipStage) Encode(f *Frame) error {
+	data := []byte(f.Data)
+	data[s.bit/8] ^= 0x80 >> (s.bit % 8)
+	f.Data = string(data)
+	return nil
+}
+
+func (s flipStage) Decode(f *Frame) error { return nil }
+
+func TestEveryStackRoundTrips(t *testing.T) {
+	for _, config := range stack.Configs() {
+		p, err := Build(config.Stages(false), Options{DataBits: 8})
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", config.Name, err)
+		}
+
+		sent, err := p.Encode(0x01, 0x00, "hello")
+		if err != nil {
+			t.Fatalf("Unexpected encode error for %s: %v", config.Name, err)
+		}
+		received, err := p.Decode(sent.Wire)
+		if err != nil {
+			t.Fatalf("Unexpected decode error for %s: %v", config.Name, err)
+		}
+		if received.Payload != "hello" {
+			t.Errorf("Expected %s to deliver %q, got %q", config.Name, "hello", received.Payload)
+		}
+		if len(sent.Trace) != len(p.Names()) || len(received.Trace) != len(p.Names()) {
+			t.Errorf("Expected a step per stage for %s, got %v and %v", config.Name, sent.Trace, received.Trace)
+		}
+	}
+}
+
+func TestTraceFollowsStageOrder(t *testing.T) {
+	p := New(NewCRCStage(), NewStuffingStage())
+	sent, _ := p.Encode(0x01, 0x00, "hi")
+	received, _ := p.Decode(sent.Wire)
+
+	if sent.Trace[0].Stage != "fcs-crc8" || sent.Trace[1].Stage != "stuffing" {
+		t.Errorf("Expected encoding to run top down, got %v", sent.Trace)
+	}
+	if received.Trace[0].Stage != "stuffing" || received.Trace[1].Stage != "fcs-crc8" {
+		t.Errorf("Expected decoding to run bottom up, got %v", received.Trace)
+	}
+	if sent.Info == "" || sent.Bits == nil || received.Bits == nil {
+		t.Error("Expected the stuffing stage to describe the frame")
+	}
+}
+
+func TestCRCStageCorrectsSingleError(t *testing.T) {
+	sent, _ := New(NewCRCStage(), flipStage{bit: 3}, NewStuffingStage()).Encode(0x01, 0x00, "hello")
+	received, err := New(NewCRCStage(), NewStuffingStage()).Decode(sent.Wire)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !received.Corrected || received.Payload != "hello" || received.Bit != 3 {
+		t.Errorf("Expected data bit 3 to be corrected, got %+v", received)
+	}
+}
+
+func TestXORStageDropsCorruptedFrame(t *testing.T) {
+	sent, _ := New(NewXORStage(), flipStage{bit: 10}, NewStuffingStage()).Encode(0x01, 0x00, "hello")
+	_, err := New(NewXORStage(), NewStuffingStage()).Decode(sent.Wire)
+
+	var dropped *DropError
+	if !errors.As(err, &dropped) || dropped.Stage != "fcs-xor" {
+		t.Errorf("Expected the XOR stage to drop the frame, got %v", err)
+	}
+}
+
+func TestStuffingRejectsBytesWithoutFrame(t *testing.T) {
+	_, err := New(NewStuffingStage()).Decode(string([]byte{packet.FlagByte, 0xFF, packet.FlagByte}))
+
+	var malformed *MalformedError
+	if !errors.As(err, &malformed) {
+		t.Errorf("Expected a malformed frame, got %v", err)
+	}
+}
+
+func TestLineStageMasksDataBits(t *testing.T) {
+	p := New(NewLineStage(7))
+	sent, _ := p.Encode(0, 0, "\xC1")
+	if sent.Wire != "A\r\n" {
+		t.Errorf("Expected %q, got %q", "A\r\n", sent.Wire)
+	}
+}
+
+func TestBuildRejectsUnknownStage(t *testing.T) {
+	if _, err := Build([]string{"fcs-crc8", "zip"}, Options{}); err == nil {
+		t.Error("Expected an error for an unknown stage")
+	}
+}
+
+func TestDeflateStageCompressesRepetitivePayload(t *testing.T) {
+	payload := strings.Repeat("temperature 21.5 C; ", 10)
+	p := New(NewDeflateStage(true), NewCRCStage(), NewStuffingStage())
+
+	sent, err := p.Encode(0x01, 0x00, payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sent.Control&packet.CompressedControl == 0 || sent.CompressedSize >= len(payload) {
+		t.Errorf("Expected a compressed frame, got control 0x%02X and %d bytes", sent.Control, sent.CompressedSize)
+	}
+
+	// The receiver inflates flagged frames even with compression off.
+	received, err := New(NewDeflateStage(false), NewCRCStage(), NewStuffingStage()).Decode(sent.Wire)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Payload != payload || received.Control != 0x00 {
+		t.Errorf("Expected the payload back with control 0x00, got control 0x%02X and %q", received.Control, received.Payload)
+	}
+}
+
+func TestDeflateStageSendsShortPayloadRaw(t *testing.T) {
+	sent, _ := New(NewDeflateStage(true)).Encode(0x01, 0x00, "hi")
+	if sent.Control != 0x00 || sent.Data != "hi" || sent.CompressedSize != 2 {
+		t.Errorf("Expected the payload to be sent raw, got control 0x%02X and %q", sent.Control, sent.Data)
+	}
+
+	if _, err := New(NewDeflateStage(true)).Encode(0x01, packet.CompressedControl, "hi"); err == nil {
+		t.Error("Expected an error for a control byte with the compression flag")
+	}
+}
+
+func TestDeflateStageDropsBadCompressedData(t *testing.T) {
+	p := New(NewDeflateStage(false), NewCRCStage(), NewStuffingStage())
+	sent, _ := New(NewCRCStage(), NewStuffingStage()).Encode(0x01, packet.CompressedControl, "\xFF\xFF\xFF")
+
+	var dropped *DropError
+	if _, err := p.Decode(sent.Wire); !errors.As(err, &dropped) || dropped.Stage != "deflate" {
+		t.Errorf("Expected the deflate stage to drop the frame, got %v", err)
+	}
+}
+
+// readdressStage moves a frame to another station after it was sealed.
+type readdressStage struct {
+	address byte
+}
+
+func (s readdressStage) Name() string { return "readdress" }
+
+func (s readdressStage) Encode(f *Frame) error {
+	f.Address = s.address
+	return nil
+}
+
+func (s readdressStage) Decode(f *Frame) error { return nil }
+
+func newTestSession(t *testing.T, psk string) *Session {
+	t.Helper()
+	session, err := NewSession(psk)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return session
+}
+
+func TestAEADStageSealsAndOpens(t *testing.T) {
+	sender := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	sent, err := sender.Encode(0x02, 0x00, "hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sent.Control&packet.EncryptedControl == 0 || strings.Contains(sent.Data, "hello") {
+		t.Errorf("Expected sealed data, got control 0x%02X and %q", sent.Control, sent.Data)
+	}
+
+	received, err := receiver.Decode(sent.Wire)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Payload != "hello" || received.Control != 0x00 {
+		t.Errorf("Expected the payload back with control 0x00, got control 0x%02X and %q", received.Control, received.Payload)
+	}
+}
+
+func TestAEADStageRejectsForgedFrames(t *testing.T) {
+	session := newTestSession(t, "correct horse")
+	cases := map[string]*Pipeline{
+		"wrong key":       New(NewAEADStage(newTestSession(t, "wrong horse"), 0x01), NewCRCStage(), NewStuffingStage()),
+		"changed data":    New(NewAEADStage(session, 0x01), flipStage{bit: 100}, NewCRCStage(), NewStuffingStage()),
+		"changed address": New(NewAEADStage(session, 0x01), readdressStage{address: 0x03}, NewCRCStage(), NewStuffingStage()),
+		"not encrypted":   New(NewCRCStage(), NewStuffingStage()),
+	}
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	for name, sender := range cases {
+		sent, err := sender.Encode(0x02, 0x00, "open the gate")
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", name, err)
+		}
+		var dropped *DropError
+		if _, err := receiver.Decode(sent.Wire); !errors.As(err, &dropped) || !strings.HasPrefix(dropped.Reason, "forged") {
+			t.Errorf("Expected %s to be dropped as forged, got %v", name, err)
+		}
+	}
+}
+
+func TestAEADStageReportsMiscorrectedFramesAsCorrupted(t *testing.T) {
+	// Three bit errors the cyclic code takes for a single one in another bit.
+	sender := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(),
+		flipStage{bit: 100}, flipStage{bit: 101}, flipStage{bit: 102}, NewStuffingStage())
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	sent, _ := sender.Encode(0x02, 0x00, "open the gate")
+	var dropped *DropError
+	if _, err := receiver.Decode(sent.Wire); !errors.As(err, &dropped) || !strings.HasPrefix(dropped.Reason, "corrupted") {
+		t.Errorf("Expected a miscorrected frame to be dropped as corrupted, got %v", err)
+	}
+}
+
+func TestAEADStageRejectsReplayedFrame(t *testing.T) {
+	sender := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	first, _ := sender.Encode(0x02, 0x00, "open the gate")
+	second, _ := sender.Encode(0x02, 0x00, "close the gate")
+	for _, wire := range []string{first.Wire, second.Wire} {
+		if _, err := receiver.Decode(wire); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	var dropped *DropError
+	if _, err := receiver.Decode(first.Wire); !errors.As(err, &dropped) || !strings.HasPrefix(dropped.Reason, "replayed") {
+		t.Errorf("Expected the old frame to be dropped as replayed, got %v", err)
+	}
+}
+
+func TestAEADStageKeepsStationsAtOneAddressApart(t *testing.T) {
+	first := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	second := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	for i := 0; i < 2; i++ {
+		for _, sender := range []*Pipeline{first, second} {
+			sent, _ := sender.Encode(0x02, 0x00, "hello")
+			if received, err := receiver.Decode(sent.Wire); err != nil || received.Payload != "hello" {
+				t.Fatalf("Expected frames from both stations at 0x01, got %v", err)
+			}
+		}
+	}
+}
+
+func TestAEADStageDropsItsOwnFrames(t *testing.T) {
+	p := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	sent, _ := p.Encode(0x01, 0x00, "hello")
+	var dropped *DropError
+	if _, err := p.Decode(sent.Wire); !errors.As(err, &dropped) || !strings.HasPrefix(dropped.Reason, "replayed") {
+		t.Errorf("Expected a station's own frame to be dropped as replayed, got %v", err)
+	}
+}
+
+func TestAEADStagePassesTokens(t *testing.T) {
+	p := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	sent, _ := p.Encode(0x02, packet.TokenControl, "")
+	if _, err := p.Decode(sent.Wire); err != nil || sent.Control != packet.TokenControl {
+		t.Errorf("Expected the token to pass in the clear, got control 0x%02X and %v", sent.Control, err)
+	}
+}
+
+func TestAEADStageOnlyPassesExactTokens(t *testing.T) {
+	receiver := New(NewAEADStage(newTestSession(t, "correct horse"), 0x02), NewCRCStage(), NewStuffingStage())
+
+	plain, _ := New(NewCRCStage(), NewStuffingStage()).Encode(0x02, packet.TokenControl|0x01, "forged plaintext")
+	var dropped *DropError
+	if _, err := receiver.Decode(plain.Wire); !errors.As(err, &dropped) || !strings.HasPrefix(dropped.Reason, "forged") {
+		t.Errorf("Expected a plain frame with control 0x81 to be dropped as forged, got %v", err)
+	}
+
+	sender := New(NewAEADStage(newTestSession(t, "correct horse"), 0x01), NewCRCStage(), NewStuffingStage())
+	sealed, _ := sender.Encode(0x02, packet.TokenControl|0x01, "sealed")
+	if sealed.Control&packet.EncryptedControl == 0 {
+		t.Errorf("Expected a frame with control 0x81 to be sealed, got control 0x%02X", sealed.Control)
+	}
+	if received, err := receiver.Decode(sealed.Wire); err != nil || received.Payload != "sealed" {
+		t.Errorf("Expected the sealed frame back, got %v", err)
+	}
+}
+
+func TestNewSessionRejectsShortKey(t *testing.T) {
+	if _, err := NewSession("secret"); err == nil {
+		t.Error("Expected an error for a short pre-shared key")
+	}
+}
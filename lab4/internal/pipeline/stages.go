@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"strings"
+
+	"oks/internal/packet"
+)
+
+// LineStage sends the payload as a line ending in CRLF with the bits above
+// the data bits cleared. It is the whole stack of the raw configuration and
+// carries no address, control or FCS.
+type LineStage struct {
+	dataBits int
+}
+
+func NewLineStage(dataBits int) *LineStage {
+	return &LineStage{dataBits: dataBits}
+}
+
+func (s *LineStage) Name() string { return "line" }
+
+func (s *LineStage) mask(data string) string {
+	if s.dataBits <= 0 || s.dataBits >= 8 {
+		return data
+	}
+	mask := byte((1 << s.dataBits) - 1)
+	result := []byte(data)
+	for i := range result {
+		result[i] &= mask
+	}
+	return string(result)
+}
+
+func (s *LineStage) Encode(f *Frame) error {
+	f.Data = s.mask(f.Data)
+	f.Wire = f.Data + "\r\n"
+	f.Note("%d data bits per byte, CRLF appended", s.dataBits)
+	return nil
+}
+
+func (s *LineStage) Decode(f *Frame) error {
+	f.Data = s.mask(strings.TrimRight(f.Wire, "\r\n"))
+	f.Note("CRLF removed")
+	return nil
+}
+
+// XORStage appends the XOR of address, control and data. A mismatch can
+// only be detected, so the frame is dropped.
+type XORStage struct{}
+
+func NewXORStage() *XORStage {
+	return &XORStage{}
+}
+
+func (s *XORStage) Name() string { return "fcs-xor" }
+
+func (s *XORStage) checksum(f *Frame) uint8 {
+	p := packet.Packet{Address: f.Address, Control: f.Control, Data: f.Data}
+	return p.XORChecksum()
+}
+
+func (s *XORStage) Encode(f *Frame) error {
+	f.FCS = s.checksum(f)
+	f.Note("FCS 0x%02X", f.FCS)
+	return nil
+}
+
+func (s *XORStage) Decode(f *Frame) error {
+	if want := s.checksum(f); want != f.FCS {
+		f.Note("expected FCS 0x%02X", want)
+		return &DropError{Stage: s.Name(), Reason: "FCS mismatch"}
+	}
+	f.Note("FCS 0x%02X matches", f.FCS)
+	return nil
+}
+
+// CRCStage appends the cyclic code of the data. On the way up it corrects a
+// single flipped bit, which makes it the forward error correction of the
+// stack as well, and drops frames with more.
+type CRCStage struct {
+	code *packet.CyclicCode
+}
+
+func NewCRCStage() *CRCStage {
+	return &CRCStage{code: packet.NewCyclicCode()}
+}
+
+func (s *CRCStage) Name() string { return "fcs-crc8" }
+
+func (s *CRCStage) Encode(f *Frame) error {
+	f.FCS = s.code.CalculateFCS(f.Data)
+	f.Note("FCS 0x%02X", f.FCS)
+	return nil
+}
+
+func (s *CRCStage) Decode(f *Frame) error {
+	hasErrors, errorCount, corrected := s.code.DetectErrors(f.Data, f.FCS)
+	switch {
+	case !hasErrors:
+		f.Note("FCS 0x%02X matches", f.FCS)
+	case errorCount == 1:
+		f.Received = f.Data
+		f.Data = corrected
+		f.Corrected = true
+		if diff := packet.DiffBits(f.Received, corrected); len(diff) > 0 {
+			f.Bit = diff[0]
+		}
+		if f.Bits != nil {
+			f.Bits.MarkCorrected(f.Received, corrected)
+		}
+		f.Note("single error in data bit %d corrected", f.Bit)
+	default:
+		return &DropError{Stage: s.Name(), Reason: "double error, cannot correct"}
+	}
+	return nil
+}
+
+// NoiseStage flips one or two data bits of every frame and keeps the FCS,
+// the way a noisy line would. There is nothing to undo on the way up.
+type NoiseStage struct{}
+
+func NewNoiseStage() *NoiseStage {
+	return &NoiseStage{}
+}
+
+func (s *NoiseStage) Name() string { return "noise" }
+
+func (s *NoiseStage) Encode(f *Frame) error {
+	p := packet.NewPacket(f.Address, f.Control, f.Data)
+	f.Clean = f.Data
+	f.Flipped = p.SimulateCorruption()
+	f.Data = p.Data
+	f.Note("flipped data bits %v", f.Flipped)
+	return nil
+}
+
+func (s *NoiseStage) Decode(f *Frame) error {
+	return nil
+}
+
+// StuffingStage puts address, control, data and FCS between flags and
+// stuffs them. Splitting the byte stream at the flags is left to the reader.
+type StuffingStage struct {
+	stuffer *packet.BitStuffer
+}
+
+func NewStuffingStage() *StuffingStage {
+	return &StuffingStage{stuffer: packet.NewBitStuffer()}
+}
+
+func (s *StuffingStage) Name() string { return "stuffing" }
+
+func (s *StuffingStage) Encode(f *Frame) error {
+	sent := f.Packet()
+	clean := sent
+	if f.Flipped != nil {
+		clean = packet.NewPacket(f.Address, f.Control, f.Clean)
+		clean.FCS = f.FCS
+	}
+
+	f.Wire = s.stuffer.StuffPacket(sent)
+	f.Bits = s.stuffer.TracePacket(sent, f.Flipped)
+	f.Info = s.stuffer.GetTransmissionInfo(clean, sent)
+	stuffed, _, padding := f.Bits.Counts()
+	f.Note("%d bit(s) stuffed, %d padding", stuffed, padding)
+	return nil
+}
+
+func (s *StuffingStage) Decode(f *Frame) error {
+	p := s.stuffer.DestuffPacket(f.Wire)
+	if p == nil {
+		return &MalformedError{Stage: s.Name(), Reason: "does not destuff into address, control and FCS"}
+	}
+	f.Address = p.Address
+	f.Control = p.Control
+	f.Data = p.Data
+	f.FCS = p.FCS
+	f.Bits = s.stuffer.TraceFrame(f.Wire)
+	if f.Bits != nil {
+		stuffed, _, padding := f.Bits.Counts()
+		f.Note("%d stuffed bit(s) removed, %d padding", stuffed, padding)
+	}
+	return nil
+}
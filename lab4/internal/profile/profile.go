@@ -0,0 +1,325 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"oks/internal/csmacd"
+	"oks/internal/pipeline"
+	"oks/internal/serialterminal"
+	"oks/internal/stack"
+	"oks/internal/txqueue"
+)
+
+// FileName is the profiles file looked up in the working directory.
+const FileName = "profiles.yaml"
+
+// Transport is where frames go: a serial port or loopback:<name>.
+type Transport struct {
+	Port string `yaml:"port"`
+}
+
+// Framing is the character framing of the serial line.
+type Framing struct {
+	DataBits int    `yaml:"data_bits"`
+	Parity   string `yaml:"parity"`
+	StopBits int    `yaml:"stop_bits"`
+}
+
+// Station is the local address. Without one the address is derived from the
+// port name.
+type Station struct {
+	Address *int `yaml:"address,omitempty"`
+}
+
+type Noise struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type MAC struct {
+	Strategy             string        `yaml:"strategy"`
+	Emulation            bool          `yaml:"emulation"`
+	BusyProbability      float64       `yaml:"busy_probability"`
+	CollisionProbability float64       `yaml:"collision_probability"`
+	Detection            string        `yaml:"detection"`
+	SlotTime             time.Duration `yaml:"slot_time"`
+	Jam                  time.Duration `yaml:"jam"`
+	TokenHold            time.Duration `yaml:"token_hold"`
+}
+
+type Queue struct {
+	Depth  int    `yaml:"depth"`
+	Policy string `yaml:"policy"`
+}
+
+// Profile is a named terminal setup. Fields left out of the file keep the
+// values of Default. Stack picks the layers, one of stack.Names or lab1 to
+// lab4; the FCS follows from it and only has to match when given.
+// Compression is none or deflate. PSKFile, when set, names the file holding
+// the pre-shared key that encrypts and authenticates every frame; the key
+// itself is never kept in the profile. Stations only understand each other
+// with the same key.
+type Profile struct {
+	Name        string    `yaml:"name"`
+	Transport   Transport `yaml:"transport"`
+	Stack       string    `yaml:"stack"`
+	Framing     Framing   `yaml:"framing"`
+	FCS         string    `yaml:"fcs,omitempty"`
+	Compression string    `yaml:"compression"`
+	PSKFile     string    `yaml:"psk_file,omitempty"`
+	Noise       Noise     `yaml:"noise"`
+	MAC         MAC       `yaml:"mac"`
+	Station     Station   `yaml:"station"`
+	Queue       Queue     `yaml:"queue"`
+}
+
+// Default is the setup a terminal starts with.
+func Default() Profile {
+	return Profile{
+		Transport:   Transport{Port: "/dev/ttys001"},
+		Stack:       stack.Default.Name,
+		Framing:     Framing{DataBits: 8, Parity: "N", StopBits: 1},
+		Compression: "none",
+		Noise:       Noise{Enabled: true},
+		MAC: MAC{
+			Strategy:             "csmacd",
+			Emulation:            true,
+			BusyProbability:      0.25,
+			CollisionProbability: 0.75,
+			Detection:            "emulated",
+			SlotTime:             csmacd.DefaultSlotTime,
+			Jam:                  csmacd.DefaultJamDuration,
+			TokenHold:            500 * time.Millisecond,
+		},
+		Queue: Queue{Depth: txqueue.DefaultDepth, Policy: "block"},
+	}
+}
+
+func (p *Profile) Validate() error {
+	config, stackErr := stack.Parse(p.Stack)
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("profile has no name")
+	case p.Transport.Port == "":
+		return fmt.Errorf("profile %s: transport.port is empty", p.Name)
+	case stackErr != nil:
+		return fmt.Errorf("profile %s: %v", p.Name, stackErr)
+	case p.Framing.DataBits < 5 || p.Framing.DataBits > 8:
+		return fmt.Errorf("profile %s: framing.data_bits %d must be 5-8", p.Name, p.Framing.DataBits)
+	case len(p.Framing.Parity) != 1 || !strings.Contains("NEOMS", strings.ToUpper(p.Framing.Parity)):
+		return fmt.Errorf("profile %s: framing.parity %q must be N, E, O, M or S", p.Name, p.Framing.Parity)
+	case p.Framing.StopBits != 1 && p.Framing.StopBits != 2:
+		return fmt.Errorf("profile %s: framing.stop_bits %d must be 1 or 2", p.Name, p.Framing.StopBits)
+	case p.FCS != "" && p.FCS != config.FCS.String():
+		return fmt.Errorf("profile %s: fcs %q does not match stack %s, which uses %s", p.Name, p.FCS, config.Name, config.FCS)
+	case p.Compression != "none" && p.Compression != "deflate":
+		return fmt.Errorf("profile %s: compression %q must be none or deflate", p.Name, p.Compression)
+	case p.PSKFile != "" && !config.Stuffing:
+		return fmt.Errorf("profile %s: psk_file needs frames, stack %s has none", p.Name, config.Name)
+	case p.MAC.Strategy != "csmacd" && p.MAC.Strategy != "token":
+		return fmt.Errorf("profile %s: mac.strategy %q must be csmacd or token", p.Name, p.MAC.Strategy)
+	case p.MAC.Detection != "emulated" && p.MAC.Detection != "echo":
+		return fmt.Errorf("profile %s: mac.detection %q must be emulated or echo", p.Name, p.MAC.Detection)
+	case p.MAC.BusyProbability < 0 || p.MAC.BusyProbability > 1 || p.MAC.CollisionProbability < 0 || p.MAC.CollisionProbability > 1:
+		return fmt.Errorf("profile %s: mac probabilities must be between 0 and 1", p.Name)
+	case p.Station.Address != nil && (*p.Station.Address < 0 || *p.Station.Address > 0xFF):
+		return fmt.Errorf("profile %s: station.address %d must fit in a byte", p.Name, *p.Station.Address)
+	case p.Queue.Depth < 1:
+		return fmt.Errorf("profile %s: queue.depth %d must be at least 1", p.Name, p.Queue.Depth)
+	case p.Queue.Policy != "block" && p.Queue.Policy != "drop-oldest":
+		return fmt.Errorf("profile %s: queue.policy %q must be block or drop-oldest", p.Name, p.Queue.Policy)
+	}
+	return nil
+}
+
+// Apply configures term. The port name only changes the next Connect. An
+// unreadable key file is returned after everything else is applied, with
+// encryption left off, so callers must not connect until it is fixed.
+func (p *Profile) Apply(term *serialterminal.SerialTerminal) error {
+	term.SetPortName(p.Transport.Port)
+	if config, err := stack.Parse(p.Stack); err == nil {
+		term.SetStack(config)
+	}
+	term.SetDataBits(p.Framing.DataBits)
+	term.SetFraming(strings.ToUpper(p.Framing.Parity)[0], p.Framing.StopBits)
+	if p.Station.Address != nil {
+		term.SetStationAddress(byte(*p.Station.Address))
+	}
+	term.SetNoiseEnabled(p.Noise.Enabled)
+	term.SetCompression(p.Compression == "deflate")
+	var psk string
+	var keyErr error
+	if p.PSKFile != "" {
+		if psk, keyErr = ReadPSK(p.PSKFile); keyErr != nil {
+			keyErr = fmt.Errorf("profile %s: %v", p.Name, keyErr)
+		}
+	}
+	if err := term.SetPSK(psk); err != nil && keyErr == nil {
+		keyErr = fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+	term.SetCSMAEmulation(p.MAC.Emulation)
+	term.SetTokenEmulation(p.MAC.Emulation)
+	term.SetCSMAProbabilities(p.MAC.BusyProbability, p.MAC.CollisionProbability)
+	term.SetCSMATiming(p.MAC.SlotTime, p.MAC.Jam)
+	term.SetTokenHoldingTime(p.MAC.TokenHold)
+	if p.MAC.Detection == "echo" {
+		term.SetCSMADetectionMode(csmacd.DetectionEcho)
+	} else {
+		term.SetCSMADetectionMode(csmacd.DetectionEmulated)
+	}
+	if p.MAC.Strategy == "token" {
+		term.SetMACMode(serialterminal.MACTokenRing)
+	} else {
+		term.SetMACMode(serialterminal.MACCSMACD)
+	}
+	term.SetQueueDepth(p.Queue.Depth)
+	if p.Queue.Policy == "drop-oldest" {
+		term.SetQueuePolicy(txqueue.PolicyDropOldest)
+	} else {
+		term.SetQueuePolicy(txqueue.PolicyBlock)
+	}
+	return keyErr
+}
+
+// File is a profiles file. Startup names the profiles the GUI opens as tabs
+// when it starts.
+type File struct {
+	Startup  []string  `yaml:"startup,omitempty"`
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// DefaultPath finds the profiles file: $OKS_PROFILES, then profiles.yaml in
+// the working directory, then oks/profiles.yaml in the user's config
+// directory. The last one is returned even if it does not exist yet, so
+// profiles can be saved there.
+func DefaultPath() string {
+	if path := os.Getenv("OKS_PROFILES"); path != "" {
+		return path
+	}
+	if _, err := os.Stat(FileName); err == nil {
+		return FileName
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return FileName
+	}
+	return filepath.Join(dir, "oks", FileName)
+}
+
+// Load reads a profiles file. A missing file is an empty one.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles %s: %v", path, err)
+	}
+	f, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("profiles %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Decode parses and validates a profiles file. Every profile starts from
+// Default, so a profile only needs the settings it changes.
+func Decode(data []byte) (*File, error) {
+	var raw struct {
+		Startup  []string    `yaml:"startup"`
+		Profiles []yaml.Node `yaml:"profiles"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	f := &File{Startup: raw.Startup}
+	seen := map[string]bool{}
+	for _, node := range raw.Profiles {
+		p := Default()
+		if err := decodeStrict(&node, &p); err != nil {
+			return nil, fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", node.Line, err)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("line %d: profile %s is defined twice", node.Line, p.Name)
+		}
+		seen[p.Name] = true
+		f.Profiles = append(f.Profiles, p)
+	}
+	for _, name := range f.Startup {
+		if !seen[name] {
+			return nil, fmt.Errorf("startup profile %s is not defined", name)
+		}
+	}
+	return f, nil
+}
+
+// decodeStrict decodes node into out and rejects keys out does not have, so
+// a misspelt setting is an error instead of silently keeping its default.
+func decodeStrict(node *yaml.Node, out *Profile) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	return dec.Decode(out)
+}
+
+func (f *File) Names() []string {
+	names := make([]string, len(f.Profiles))
+	for i, p := range f.Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func (f *File) Get(name string) (Profile, error) {
+	for _, p := range f.Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("no profile named %q", name)
+}
+
+// Put adds p, replacing a profile with the same name.
+func (f *File) Put(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for i := range f.Profiles {
+		if f.Profiles[i].Name == p.Name {
+			f.Profiles[i] = p
+			return nil
+		}
+	}
+	f.Profiles = append(f.Profiles, p)
+	return nil
+}
+
+// ReadPSK reads a pre-shared key from path, without surrounding whitespace.
+func ReadPSK(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file: %v", err)
+	}
+	psk := strings.TrimSpace(string(data))
+	if len(psk) < pipeline.MinPSKLength {
+		return "", fmt.Errorf("key in %s must be at least %d characters", path, pipeline.MinPSKLength)
+	}
+	return psk, nil
+}
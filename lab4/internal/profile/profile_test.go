@@ -0,0 +1,222 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oks/internal/serialterminal"
+)
+
+func TestDecodeKeepsDefaults(t *testing.T) {
+	f, err := Decode([]byte(`
+profiles:
+  - name: bus
+    transport:
+      port: loopback:bus
+    mac:
+      strategy: token
+      token_hold: 250ms
+    station:
+      address: 0x2a
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p, err := f.Get("bus")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.MAC.Strategy != "token" || p.MAC.TokenHold != 250*time.Millisecond || *p.Station.Address != 0x2a {
+		t.Errorf("Expected the listed settings, got %+v", p)
+	}
+	if def := Default(); p.Framing != def.Framing || p.MAC.BusyProbability != def.MAC.BusyProbability || p.Queue != def.Queue {
+		t.Errorf("Expected unlisted settings to keep their defaults, got %+v", p)
+	}
+}
+
+func TestDecodeRejectsBadProfiles(t *testing.T) {
+	cases := map[string]string{
+		"unknown key":        "profiles:\n  - name: a\n    mac:\n      stratgey: token\n",
+		"bad value":          "profiles:\n  - name: a\n    framing:\n      data_bits: 9\n",
+		"no name":            "profiles:\n  - transport:\n      port: x\n",
+		"duplicate":          "profiles:\n  - name: a\n  - name: a\n",
+		"unknown startup":    "startup: [b]\nprofiles:\n  - name: a\n",
+		"unsupported fcs":    "profiles:\n  - name: a\n    fcs: crc16\n",
+		"mismatched fcs":     "profiles:\n  - name: a\n    stack: stuffed\n    fcs: crc8\n",
+		"unknown stack":      "profiles:\n  - name: a\n    stack: lab5\n",
+		"bad compression":    "profiles:\n  - name: a\n    compression: zip\n",
+		"psk without frames": "profiles:\n  - name: a\n    stack: raw\n    psk_file: key.txt\n",
+		"plaintext psk":      "profiles:\n  - name: a\n    psk: correct horse\n",
+		"unknown top-level":  "profile:\n  - name: a\n",
+	}
+	for name, data := range cases {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", FileName)
+	if f, err := Load(path); err != nil || len(f.Profiles) != 0 {
+		t.Fatalf("Expected a missing file to load empty, got %v, %v", f, err)
+	}
+
+	p := Default()
+	p.Name = "saved"
+	p.MAC.SlotTime = 2 * time.Millisecond
+	f := &File{Startup: []string{"saved"}}
+	if err := f.Put(p); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := loaded.Get("saved")
+	if err != nil || got.MAC.SlotTime != 2*time.Millisecond || len(loaded.Startup) != 1 {
+		t.Errorf("Expected the saved profile back, got %+v (%v)", got, err)
+	}
+}
+
+func TestSaveKeepsTheFileAsWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	written := `# Shared setups.
+
+startup: [bus]
+
+profiles:
+  # The bus every lab uses.
+  - name: bus
+    transport:
+      port: /dev/ttys001 # the first port
+    mac:
+      jam: 500us
+
+  - name: other
+    transport:
+      port: loopback:other
+`
+	if err := os.WriteFile(path, []byte(written), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != written {
+		t.Errorf("Expected an unchanged file to be saved as written, got:\n%s", data)
+	}
+
+	p, _ := f.Get("other")
+	p.Noise.Enabled = false
+	added := Default()
+	added.Name = "added"
+	added.PSKFile = "key.txt"
+	for _, p := range []Profile{p, added} {
+		if err := f.Put(p); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := written + `    noise:
+      enabled: false
+
+  - name: added
+    psk_file: key.txt
+`
+	if string(data) != want {
+		t.Errorf("Expected only the changed settings to be written, got:\n%s", data)
+	}
+}
+
+func TestApplyReadsTheKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(key, []byte("correct horse\n"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if psk, err := ReadPSK(key); err != nil || psk != "correct horse" {
+		t.Errorf("Expected the trimmed key, got %q (%v)", psk, err)
+	}
+	short := filepath.Join(dir, "short.txt")
+	if err := os.WriteFile(short, []byte("secret"), 0o600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := ReadPSK(short); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+
+	p := Default()
+	p.Name = "keyed"
+	p.PSKFile = key
+	term := serialterminal.New("loopback:keyed")
+	if err := p.Apply(term); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !term.GetEncryption() {
+		t.Error("Expected the key file to turn encryption on")
+	}
+
+	p.PSKFile = filepath.Join(dir, "missing.txt")
+	if err := p.Apply(term); err == nil {
+		t.Error("Expected an error for a missing key file")
+	}
+	if term.GetEncryption() {
+		t.Error("Expected a missing key file to leave no key set")
+	}
+}
+
+func TestShippedProfiles(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", FileName))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	f, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Expected the shipped profiles to load, got %v", err)
+	}
+	if len(f.Startup) == 0 {
+		t.Error("Expected the shipped profiles to name startup tabs")
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := Default()
+	p.Name = "apply"
+	p.Transport.Port = "loopback:apply"
+	p.Framing = Framing{DataBits: 7, Parity: "e", StopBits: 2}
+	address := 0x42
+	p.Station.Address = &address
+	p.MAC.Strategy = "token"
+	p.MAC.BusyProbability = 0.5
+
+	term := serialterminal.New("loopback:other")
+	if err := p.Apply(term); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	parity, stopBits := term.GetFraming()
+	busy, _ := term.GetCSMAProbabilities()
+	if term.GetPortName() != "loopback:apply" || term.GetDataBits() != 7 || parity != 'E' || stopBits != 2 ||
+		term.GetStationAddress() != 0x42 || term.GetMACMode() != serialterminal.MACTokenRing || busy != 0.5 {
+		t.Errorf("Expected the terminal to take the profile, got port %s, %d%c%d, address 0x%02X",
+			term.GetPortName(), term.GetDataBits(), parity, stopBits, term.GetStationAddress())
+	}
+	if !strings.EqualFold(p.Framing.Parity, "E") {
+		t.Error("Expected Apply to leave the profile alone")
+	}
+}
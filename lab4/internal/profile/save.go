@@ -0,0 +1,250 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Save writes the file to path. An existing file is edited rather than
+// replaced: its comments, the order of its profiles and settings and the
+// profiles that did not change are kept as written, and new settings are
+// only written when they differ from Default, the way they are written by
+// hand.
+func (f *File) Save(path string) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("profiles %s: %v", path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to read profiles %s: %v", path, err)
+	}
+
+	if err := f.edit(&doc); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	data = separateBlocks(out.Bytes())
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to save profiles %s: %v", path, err)
+	}
+	return nil
+}
+
+// edit brings the document of a profiles file in line with f.
+func (f *File) edit(doc *yaml.Node) error {
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("profiles file is not a mapping")
+	}
+
+	var current []string
+	if old := mappingValue(root, "startup"); old == nil && len(f.Startup) > 0 ||
+		old != nil && (old.Decode(&current) != nil || !reflect.DeepEqual(current, f.Startup)) {
+		var startup yaml.Node
+		if err := startup.Encode(f.Startup); err != nil {
+			return err
+		}
+		startup.Style = yaml.FlowStyle
+		setMappingValue(root, "startup", &startup)
+	}
+
+	existing := map[string]*yaml.Node{}
+	if seq := mappingValue(root, "profiles"); seq != nil {
+		for _, node := range seq.Content {
+			if name := mappingValue(node, "name"); name != nil {
+				existing[name.Value] = node
+			}
+		}
+	}
+	profiles := &yaml.Node{Kind: yaml.SequenceNode}
+	if seq := mappingValue(root, "profiles"); seq != nil {
+		profiles.HeadComment, profiles.LineComment, profiles.FootComment = seq.HeadComment, seq.LineComment, seq.FootComment
+	}
+	for _, p := range f.Profiles {
+		node, err := profileNode(p, existing[p.Name])
+		if err != nil {
+			return err
+		}
+		profiles.Content = append(profiles.Content, node)
+	}
+	setMappingValue(root, "profiles", profiles)
+	return nil
+}
+
+// profileNode is the node to write for p. A profile that did not change
+// keeps its node as it is; otherwise old, which is nil for a new profile,
+// gets the settings of p and drops none of its own unless they changed, and
+// settings old does not have are added when they differ from Default.
+func profileNode(p Profile, old *yaml.Node) (*yaml.Node, error) {
+	if old != nil {
+		current := Default()
+		if err := old.Decode(&current); err == nil && reflect.DeepEqual(current, p) {
+			return old, nil
+		}
+	} else {
+		old = &yaml.Node{Kind: yaml.MappingNode}
+	}
+
+	var node, defaults yaml.Node
+	if err := node.Encode(p); err != nil {
+		return nil, err
+	}
+	d := Default()
+	d.Name = p.Name
+	if err := defaults.Encode(d); err != nil {
+		return nil, err
+	}
+	mergeMapping(old, &node, &defaults)
+	return old, nil
+}
+
+// mergeMapping makes dst hold the values of src. Keys dst already has keep
+// their place, comments and, when the value is the same, its spelling. Keys
+// only in src are appended unless their value is the one in defaults.
+func mergeMapping(dst, src, defaults *yaml.Node) {
+	var content []*yaml.Node
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key, old := dst.Content[i], dst.Content[i+1]
+		value := mappingValue(src, key.Value)
+		switch {
+		case value == nil:
+			continue
+		case old.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeMapping(old, value, mappingOrEmpty(defaults, key.Value))
+			value = old
+		case sameValue(old, value):
+			value = old
+		default:
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		}
+		content = append(content, key, value)
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if mappingValue(dst, key.Value) != nil {
+			continue
+		}
+		def := mappingValue(defaults, key.Value)
+		if value.Kind == yaml.MappingNode {
+			added := &yaml.Node{Kind: yaml.MappingNode}
+			mergeMapping(added, value, mappingOrEmpty(defaults, key.Value))
+			if len(added.Content) == 0 {
+				continue
+			}
+			value = added
+		} else if key.Value != "name" && def != nil && sameValue(value, def) {
+			continue
+		}
+		content = append(content, key, value)
+	}
+	dst.Content = content
+}
+
+func mappingOrEmpty(node *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(node, key); value != nil {
+		return value
+	}
+	return &yaml.Node{Kind: yaml.MappingNode}
+}
+
+// sameValue reports whether two scalars mean the same, such as 0x01 and 1
+// or 500us and 500µs.
+func sameValue(a, b *yaml.Node) bool {
+	if x, err := time.ParseDuration(a.Value); err == nil {
+		if y, err := time.ParseDuration(b.Value); err == nil {
+			return x == y
+		}
+	}
+	var x, y any
+	if a.Decode(&x) != nil || b.Decode(&y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// separateBlocks puts back the blank lines the encoder drops between the
+// top-level keys and between profiles, keeping the comments above a block
+// with it.
+func separateBlocks(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	out := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if i > 0 && blockStart(line) {
+			prev := lines[i-1]
+			sameComment := strings.HasPrefix(prev, indentOf(line)+"#")
+			if prev != "" && prev != "profiles:" && !sameComment {
+				out = append(out, "")
+			}
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+func blockStart(line string) bool {
+	if line == "" {
+		return false
+	}
+	if line[0] != ' ' {
+		return true
+	}
+	return strings.HasPrefix(line, "  - ") || strings.HasPrefix(line, "  #")
+}
+
+func indentOf(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " "))]
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
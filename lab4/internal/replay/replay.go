@@ -0,0 +1,251 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Chunk is what one Read returned from the port, with its time since the
+// recording started.
+type Chunk struct {
+	Offset time.Duration `json:"offset_ns"`
+	Data   []byte        `json:"data"`
+}
+
+// Recorder appends read chunks to a JSON Lines stream, one chunk per line.
+// It is safe for concurrent use.
+type Recorder struct {
+	mutex   sync.Mutex
+	out     *bufio.Writer
+	closer  io.Closer
+	started time.Time
+	err     error
+}
+
+// Create starts a recording at path, replacing an existing one.
+func Create(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording %s: %v", path, err)
+	}
+	return NewRecorder(f), nil
+}
+
+// NewRecorder records into out. If out is an io.Closer, Close closes it.
+func NewRecorder(out io.Writer) *Recorder {
+	r := &Recorder{out: bufio.NewWriter(out), started: time.Now()}
+	if closer, ok := out.(io.Closer); ok {
+		r.closer = closer
+	}
+	return r
+}
+
+// Record appends data as one chunk, stamped with the time since the
+// recording started. After a write error every call returns that error.
+func (r *Recorder) Record(data []byte) error {
+	offset := time.Since(r.started)
+	line, err := json.Marshal(Chunk{Offset: offset, Data: data})
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.out.Write(line)
+	r.out.WriteByte('\n')
+	if err := r.out.Flush(); err != nil {
+		r.err = fmt.Errorf("failed to write recording: %v", err)
+	}
+	return r.err
+}
+
+// Close flushes the recording and closes the underlying file. Chunks
+// recorded afterwards are rejected.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var err error
+	if r.err == nil {
+		err = r.out.Flush()
+		r.err = fmt.Errorf("recording closed")
+	}
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+		r.closer = nil
+	}
+	return err
+}
+
+// Load reads a recording written by Recorder.
+func Load(path string) ([]Chunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording %s: %v", path, err)
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// Decode reads the chunks of a recording from in, skipping empty lines.
+func Decode(in io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var c Chunk
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("recording line %d: %v", line, err)
+		}
+		chunks = append(chunks, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %v", err)
+	}
+	return chunks, nil
+}
+
+// ErrReplayed is returned when a Transport is opened a second time.
+var ErrReplayed = errors.New("recording already replayed")
+
+const readTimeout = 50 * time.Millisecond
+
+// Transport plays a recording back as the port's input. speed scales the
+// original timing: 1 is real time, 10 ten times faster, 0 as fast as the
+// reader reads. Every Read returns exactly one recorded chunk, so the reader
+// sees the same chunk boundaries as during the recording. Writes are
+// discarded. A Transport can be opened once.
+type Transport struct {
+	mutex  sync.Mutex
+	chunks []Chunk
+	speed  float64
+	opened bool
+	done   chan struct{}
+	finish sync.Once
+}
+
+// NewTransport plays chunks back at speed, as loaded by Load.
+func NewTransport(chunks []Chunk, speed float64) *Transport {
+	return &Transport{chunks: chunks, speed: speed, done: make(chan struct{})}
+}
+
+// Done is closed once the last chunk has been read.
+func (t *Transport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Open returns the port that plays the recording. name and dataBits are
+// ignored; the recording has the bytes as they were read.
+func (t *Transport) Open(name string, dataBits int) (io.ReadWriteCloser, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.opened {
+		return nil, ErrReplayed
+	}
+	t.opened = true
+
+	p := &port{transport: t, started: time.Now(), closed: make(chan struct{})}
+	if len(t.chunks) == 0 {
+		t.finished()
+	}
+	return p, nil
+}
+
+func (t *Transport) finished() {
+	t.finish.Do(func() { close(t.done) })
+}
+
+type port struct {
+	transport *Transport
+	started   time.Time
+	next      int
+	pending   []byte
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Read waits for the next chunk to become due, or returns 0 bytes and no
+// error after the read timeout like a serial port does.
+func (p *port) Read(buf []byte) (int, error) {
+	t := p.transport
+	if len(p.pending) > 0 {
+		return p.take(buf), nil
+	}
+
+	wait := readTimeout
+	if p.next < len(t.chunks) {
+		wait = p.due(t.chunks[p.next]) - time.Since(p.started)
+		if wait > readTimeout {
+			wait = readTimeout
+		}
+	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-p.closed:
+			return 0, io.EOF
+		}
+	}
+
+	select {
+	case <-p.closed:
+		return 0, io.EOF
+	default:
+	}
+
+	if p.next >= len(t.chunks) || p.due(t.chunks[p.next]) > time.Since(p.started) {
+		return 0, nil
+	}
+
+	p.pending = t.chunks[p.next].Data
+	p.next++
+	return p.take(buf), nil
+}
+
+// take copies the current chunk into buf. A chunk larger than buf is split,
+// which only happens when the reader's buffer shrank since the recording.
+func (p *port) take(buf []byte) int {
+	n := copy(buf, p.pending)
+	p.pending = p.pending[n:]
+	if len(p.pending) == 0 && p.next == len(p.transport.chunks) {
+		p.transport.finished()
+	}
+	return n
+}
+
+func (p *port) due(c Chunk) time.Duration {
+	if p.transport.speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(c.Offset) / p.transport.speed)
+}
+
+func (p *port) Write(buf []byte) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, io.ErrClosedPipe
+	default:
+		return len(buf), nil
+	}
+}
+
+func (p *port) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
@@ -0,0 +1,75 @@
+package replay
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRecordingRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.Record([]byte{0x0E, 0x01})
+	r.Record([]byte{0x00, 0xFF, 0x0E})
+	if err := r.Close(); err != nil {
+		t.Fatalf("Unexpected close error: %v", err)
+	}
+
+	chunks, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	if !bytes.Equal(chunks[1].Data, []byte{0x00, 0xFF, 0x0E}) {
+		t.Errorf("Expected the second chunk intact, got % X", chunks[1].Data)
+	}
+	if chunks[1].Offset < chunks[0].Offset {
+		t.Errorf("Expected offsets in recording order, got %v then %v", chunks[0].Offset, chunks[1].Offset)
+	}
+}
+
+func TestTransportKeepsBoundariesAndTiming(t *testing.T) {
+	chunks := []Chunk{
+		{Offset: 0, Data: []byte("ab")},
+		{Offset: 200 * time.Millisecond, Data: []byte("cde")},
+	}
+	transport := NewTransport(chunks, 10)
+	port, err := transport.Open("replay", 8)
+	if err != nil {
+		t.Fatalf("Unexpected open error: %v", err)
+	}
+	defer port.Close()
+
+	started := time.Now()
+	buf := make([]byte, 64)
+	var reads []string
+	for len(reads) < 2 {
+		n, err := port.Read(buf)
+		if err != nil {
+			t.Fatalf("Unexpected read error: %v", err)
+		}
+		if n > 0 {
+			reads = append(reads, string(buf[:n]))
+		}
+	}
+	elapsed := time.Since(started)
+
+	if reads[0] != "ab" || reads[1] != "cde" {
+		t.Errorf("Expected the recorded chunks ab and cde, got %q", reads)
+	}
+	if elapsed < 20*time.Millisecond || elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the 200ms gap replayed in about 20ms at 10x, took %v", elapsed)
+	}
+
+	select {
+	case <-transport.Done():
+	default:
+		t.Error("Expected Done to be closed after the last chunk")
+	}
+
+	if _, err := transport.Open("replay", 8); err != ErrReplayed {
+		t.Errorf("Expected ErrReplayed on a second open, got %v", err)
+	}
+}
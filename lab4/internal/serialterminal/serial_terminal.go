@@ -1,80 +1,198 @@
 package serialterminal
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"oks/internal/capture"
 	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/filetransfer"
+	"oks/internal/medium"
+	"oks/internal/metrics"
 	"oks/internal/packet"
+	"oks/internal/pipeline"
+	"oks/internal/replay"
+	"oks/internal/stack"
+	"oks/internal/tokenring"
+	"oks/internal/txqueue"
 
-	"fyne.io/fyne/v2"
 	"github.com/tarm/serial"
 )
 
+type MACMode int
+
+const (
+	MACCSMACD MACMode = iota
+	MACTokenRing
+)
+
+const (
+	baudRate         = 9600
+	tokenWaitTimeout = 10 * time.Second
+	echoTimeout      = 200 * time.Millisecond
+	jamSettleTime    = 20 * time.Millisecond
+	carrierSenseGap  = 5 * time.Millisecond
+)
+
+// Transport opens the byte stream a terminal talks over. The default opens a
+// serial device; a shared loopback medium or a test double can be used instead.
+type Transport interface {
+	Open(name string, dataBits int) (io.ReadWriteCloser, error)
+}
+
+type serialTransport struct {
+	parity   serial.Parity
+	stopBits serial.StopBits
+}
+
+func (t serialTransport) Open(name string, dataBits int) (io.ReadWriteCloser, error) {
+	c := &serial.Config{
+		Name:        name,
+		Baud:        baudRate,
+		ReadTimeout: time.Millisecond * 50,
+		Size:        byte(dataBits),
+		Parity:      t.parity,
+		StopBits:    t.stopBits,
+	}
+	return serial.OpenPort(c)
+}
+
 type SerialTerminal struct {
-	port           io.ReadWriteCloser
-	portName       string
-	dataBits       int
-	stopReading    chan bool
-	messageChan    chan string
-	packetChan     chan string
-	bitStuffer     *packet.BitStuffer
-	csmaCD         *csmacd.CSMACD
-	OnMessage      func(string)
-	OnStatus       func(string)
-	OnPacket       func(string)
-	OnCollision    func()
-	OnChannelBusy  func()
-	OnChannelState func(string)
+	port         io.ReadWriteCloser
+	transport    Transport
+	portName     string
+	dataBits     atomic.Int32
+	parity       serial.Parity
+	stopBits     serial.StopBits
+	address      byte
+	addressSet   bool
+	noiseEnabled atomic.Bool
+	compression  atomic.Bool
+	session      atomic.Pointer[pipeline.Session]
+	stopReading  chan bool
+	events       *events.Bus
+	bitStuffer   *packet.BitStuffer
+	csmaCD       *csmacd.CSMACD
+	tokenRing    *tokenring.TokenRing
+	metrics      *metrics.Collector
+	macMode      atomic.Int32
+	stack        atomic.Pointer[stack.Config]
+	echoActive   atomic.Bool
+	echoChan     chan []byte
+	lastReceive  atomic.Int64
+	txQueue      *txqueue.Queue[*outgoing]
+	stopSending  context.CancelFunc
+	sendingDone  chan struct{}
+	files        *filetransfer.Receiver
+	rawActive    atomic.Bool
+	rawChan      chan []byte
+	capture      atomic.Pointer[capture.Writer]
+	recorder     atomic.Pointer[replay.Recorder]
+}
+
+// outgoing is a frame waiting in the transmit queue. The result of sending
+// it is delivered on result.
+type outgoing struct {
+	ctx     context.Context
+	address byte
+	control byte
+	data    string
+	result  chan error
 }
 
 func New(name string) *SerialTerminal {
 	csma := csmacd.NewCSMACD()
 	terminal := &SerialTerminal{
-		portName:       name,
-		dataBits:       8,
-		stopReading:    make(chan bool, 1),
-		messageChan:    make(chan string, 100),
-		packetChan:     make(chan string, 50),
-		bitStuffer:     packet.NewBitStuffer(),
-		csmaCD:         csma,
-		OnMessage:      func(string) {},
-		OnStatus:       func(string) {},
-		OnPacket:       func(string) {},
-		OnCollision:    func() {},
-		OnChannelBusy:  func() {},
-		OnChannelState: func(string) {},
+		portName:    name,
+		parity:      serial.ParityNone,
+		stopBits:    serial.Stop1,
+		stopReading: make(chan bool, 1),
+		events:      events.NewBus(),
+		echoChan:    make(chan []byte, 64),
+		rawChan:     make(chan []byte, 1024),
+		bitStuffer:  packet.NewBitStuffer(),
+		csmaCD:      csma,
+		metrics:     metrics.NewCollector(),
+		txQueue:     txqueue.New[*outgoing](txqueue.DefaultDepth, txqueue.PolicyBlock),
+		files:       filetransfer.NewReceiver(),
 	}
+	terminal.dataBits.Store(8)
+	terminal.noiseEnabled.Store(true)
+	terminal.SetStack(stack.Default)
+	terminal.tokenRing = tokenring.NewTokenRing(terminal.stationAddress())
 
 	csma.SetCallbacks(
 		func(state csmacd.ChannelState) {
 			log.Printf("CSMA/CD: Channel state changed to %s", csma.GetStateString())
-			fyne.Do(func() { terminal.OnChannelState(csma.GetStateString()) })
 		},
 		func() {
 			log.Printf("CSMA/CD: ⚠️ COLLISION DETECTED - Sending jam signal")
-			fyne.Do(func() { terminal.OnCollision() })
 		},
 		func() {
 			log.Printf("CSMA/CD: 🔴 Channel busy - waiting...")
-			fyne.Do(func() { terminal.OnChannelBusy() })
 		},
 	)
 
+	terminal.tokenRing.SetCallbacks(
+		func(station byte) {
+			log.Printf("Token Ring: token arrived at station 0x%02X", station)
+			terminal.events.Publish(events.TokenArrived{Stamp: events.Now(), Station: station})
+		},
+		func(station byte) {
+			log.Printf("Token Ring: token left station 0x%02X", station)
+			terminal.events.Publish(events.TokenDeparted{Stamp: events.Now(), Station: station})
+		},
+		func(monitor byte) {
+			log.Printf("Token Ring: token lost, regenerated by monitor 0x%02X", monitor)
+			terminal.events.Publish(events.TokenLost{Stamp: events.Now(), Monitor: monitor})
+		},
+	)
+	terminal.tokenRing.SetTokenPasser(terminal.passToken)
+
+	terminal.files.SetCallbacks(
+		func(p filetransfer.Progress) {
+			terminal.publishProgress(p)
+		},
+		func(f filetransfer.File, err error) {
+			if err != nil {
+				log.Printf("File transfer from 0x%02X failed: %v", f.Source, err)
+			} else {
+				log.Printf("File %s received from 0x%02X: %d bytes in %v", f.Name, f.Source, len(f.Data), f.Elapsed)
+			}
+			terminal.events.Publish(events.FileReceived{Stamp: events.Now(), Source: f.Source, Name: f.Name, Data: f.Data, Err: err})
+		},
+	)
+
+	terminal.txQueue.SetOnDrop(func(o *outgoing) {
+		log.Printf("Transmit queue full, dropped oldest frame: %s", o.data)
+		terminal.metrics.RecordQueueDrop()
+		o.result <- fmt.Errorf("frame dropped: %w", txqueue.ErrFull)
+	})
+
 	return terminal
 }
 
+// Subscribe returns a stream of everything the terminal does. Close the
+// subscription when done with it.
+func (st *SerialTerminal) Subscribe(buffer int) *events.Subscription {
+	return st.events.Subscribe(buffer)
+}
+
 func (st *SerialTerminal) SetPortName(name string) {
 	st.portName = name
 }
 
 func (st *SerialTerminal) SetDataBits(dataBits int) {
-	oldDataBits := st.dataBits
-	st.dataBits = dataBits
+	oldDataBits := int(st.dataBits.Swap(int32(dataBits)))
 
 	if st.port != nil && oldDataBits != dataBits {
 		log.Printf("Data bits changed from %d to %d, reconnecting...", oldDataBits, dataBits)
@@ -91,7 +209,71 @@ func (st *SerialTerminal) SetDataBits(dataBits int) {
 }
 
 func (st *SerialTerminal) GetDataBits() int {
-	return st.dataBits
+	return int(st.dataBits.Load())
+}
+
+// SetFraming sets the character framing used by serial ports: parity is one
+// of 'N', 'E', 'O', 'M' or 'S' and stopBits is 1 or 2.
+func (st *SerialTerminal) SetFraming(parity byte, stopBits int) {
+	st.parity = serial.Parity(parity)
+	if stopBits == 2 {
+		st.stopBits = serial.Stop2
+	} else {
+		st.stopBits = serial.Stop1
+	}
+}
+
+func (st *SerialTerminal) GetFraming() (parity byte, stopBits int) {
+	return byte(st.parity), int(st.stopBits)
+}
+
+func (st *SerialTerminal) SetStationAddress(address byte) {
+	st.address = address
+	st.addressSet = true
+	st.tokenRing.SetLocalAddress(address)
+}
+
+func (st *SerialTerminal) GetStationAddress() byte {
+	return st.stationAddress()
+}
+
+// SetNoiseEnabled turns the simulated bit corruption of outgoing frames on
+// or off.
+func (st *SerialTerminal) SetNoiseEnabled(enabled bool) {
+	st.noiseEnabled.Store(enabled)
+}
+
+// SetCompression turns DEFLATE compression of outgoing payloads on or off.
+// Compressed frames are inflated on receipt either way.
+func (st *SerialTerminal) SetCompression(enabled bool) {
+	st.compression.Store(enabled)
+}
+
+func (st *SerialTerminal) GetCompression() bool {
+	return st.compression.Load()
+}
+
+// SetPSK seals outgoing frames with a key derived from psk and accepts only
+// sealed frames, or turns encryption off when psk is empty. Every call
+// starts a new session, forgetting the counters seen so far. The raw stack
+// has no frames and ignores the key.
+func (st *SerialTerminal) SetPSK(psk string) error {
+	if psk == "" {
+		st.session.Store(nil)
+		return nil
+	}
+	session, err := pipeline.NewSession(psk)
+	if err != nil {
+		return err
+	}
+	st.session.Store(session)
+	return nil
+}
+
+// GetEncryption reports whether frames are sealed with a pre-shared key,
+// which is never the case on a stack without frames.
+func (st *SerialTerminal) GetEncryption() bool {
+	return st.session.Load() != nil && st.GetStack().Stuffing
 }
 
 func (st *SerialTerminal) GetPortName() string {
@@ -106,6 +288,34 @@ func (st *SerialTerminal) GetCSMAStatistics() (collisions, busy, totalAttempts i
 	return st.csmaCD.GetStatistics()
 }
 
+func (st *SerialTerminal) GetMetrics() metrics.Snapshot {
+	return st.metrics.Snapshot()
+}
+
+func (st *SerialTerminal) GetBackoffSamples() []time.Duration {
+	return st.metrics.BackoffSamples()
+}
+
+func (st *SerialTerminal) ResetMetrics() {
+	st.metrics.Reset()
+}
+
+func (st *SerialTerminal) SetQueueDepth(depth int) {
+	st.txQueue.SetDepth(depth)
+}
+
+func (st *SerialTerminal) SetQueuePolicy(policy txqueue.Policy) {
+	st.txQueue.SetPolicy(policy)
+}
+
+func (st *SerialTerminal) GetQueueLength() int {
+	return st.txQueue.Len()
+}
+
+func (st *SerialTerminal) SetMetricsWindow(window time.Duration) {
+	st.metrics.SetWindow(window)
+}
+
 func (st *SerialTerminal) GetCSMAStatisticsString() string {
 	return st.csmaCD.GetStatisticsString()
 }
@@ -118,39 +328,254 @@ func (st *SerialTerminal) SetCSMAEmulation(enabled bool) {
 	st.csmaCD.SetEmulationEnabled(enabled)
 }
 
+func (st *SerialTerminal) GetCSMAEmulation() bool {
+	return st.csmaCD.GetEmulationEnabled()
+}
+
 func (st *SerialTerminal) SetCSMAProbabilities(busyProb, collisionProb float64) {
 	st.csmaCD.SetProbabilities(busyProb, collisionProb)
 }
 
-func (st *SerialTerminal) Connect() error {
-	c := &serial.Config{
-		Name:        st.portName,
-		Baud:        9600,
-		ReadTimeout: time.Millisecond * 50,
-		Size:        byte(st.dataBits),
-		Parity:      serial.ParityNone,
-		StopBits:    serial.Stop1,
+func (st *SerialTerminal) GetCSMAProbabilities() (busyProb, collisionProb float64) {
+	return st.csmaCD.GetProbabilities()
+}
+
+func (st *SerialTerminal) GetCSMASlotTime() time.Duration {
+	return st.csmaCD.GetSlotTime()
+}
+
+func (st *SerialTerminal) SetCSMADetectionMode(mode csmacd.DetectionMode) {
+	st.csmaCD.SetDetectionMode(mode)
+}
+
+func (st *SerialTerminal) GetCSMADetectionMode() csmacd.DetectionMode {
+	return st.csmaCD.GetDetectionMode()
+}
+
+// SetTransport overrides how the port is opened; nil restores the default of
+// a serial device, or a shared medium for "loopback:" port names.
+func (st *SerialTerminal) SetTransport(transport Transport) {
+	st.transport = transport
+}
+
+func (st *SerialTerminal) SetCSMATiming(slotTime, jamDuration time.Duration) {
+	st.csmaCD.SetSlotTime(slotTime)
+	st.csmaCD.SetJamDuration(jamDuration)
+}
+
+func (st *SerialTerminal) SetMACMode(mode MACMode) {
+	st.macMode.Store(int32(mode))
+	st.updateTokenRing()
+}
+
+// updateTokenRing runs the token ring while the port is open, the MAC mode
+// is token ring and the stack has a MAC layer, and stops it otherwise.
+func (st *SerialTerminal) updateTokenRing() {
+	if st.port == nil {
+		return
+	}
+	if st.GetMACMode() == MACTokenRing && st.GetStack().MAC {
+		st.tokenRing.SetLocalAddress(st.stationAddress())
+		st.tokenRing.Start()
+	} else {
+		st.tokenRing.Stop()
 	}
+}
+
+func (st *SerialTerminal) GetMACMode() MACMode {
+	return MACMode(st.macMode.Load())
+}
+
+// SetStack selects the layers frames go through, see the stack package. The
+// MAC mode is kept but only used by stacks with a MAC layer. While the port
+// is open the next frame written or read uses the new stack.
+func (st *SerialTerminal) SetStack(config stack.Config) {
+	st.stack.Store(&config)
+	st.updateTokenRing()
+}
+
+func (st *SerialTerminal) GetStack() stack.Config {
+	return *st.stack.Load()
+}
 
-	s, err := serial.OpenPort(c)
+func (st *SerialTerminal) SetTokenEmulation(enabled bool) {
+	st.tokenRing.SetEmulationEnabled(enabled)
+}
+
+func (st *SerialTerminal) SetTokenHoldingTime(d time.Duration) {
+	st.tokenRing.SetHoldingTime(d)
+}
+
+func (st *SerialTerminal) SetTokenStations(stations []byte, monitor byte) {
+	st.tokenRing.SetStations(stations)
+	st.tokenRing.SetMonitorAddress(monitor)
+}
+
+func (st *SerialTerminal) GetTokenStatistics() (arrivals, departures, lostTokens int) {
+	return st.tokenRing.GetStatistics()
+}
+
+func (st *SerialTerminal) GetTokenStatisticsString() string {
+	return st.tokenRing.GetStatisticsString()
+}
+
+func (st *SerialTerminal) GetTokenState() string {
+	return st.tokenRing.GetStateString()
+}
+
+// SetCapture records all port traffic and decoded frames into w from now on.
+// A nil writer stops recording; the writer is not closed by the terminal.
+func (st *SerialTerminal) SetCapture(w *capture.Writer) {
+	st.capture.Store(w)
+}
+
+// SetRecorder records every chunk read from the port, with its timing, so the
+// session can be replayed with replay.Transport. A nil recorder stops it.
+func (st *SerialTerminal) SetRecorder(r *replay.Recorder) {
+	st.recorder.Store(r)
+}
+
+// capturedPort hands every byte crossing the port to the active capture and
+// every chunk read to the active recorder. On a line that reads back its own
+// bytes it also takes the echo of framed writes out of what is read, so the
+// terminal does not receive its own frames. Echo mode transmissions and raw
+// sessions remove their echo themselves.
+type capturedPort struct {
+	io.ReadWriteCloser
+	st *SerialTerminal
+
+	mutex sync.Mutex
+	echo  []byte
+}
+
+func (p *capturedPort) Read(buf []byte) (int, error) {
+	n, err := p.ReadWriteCloser.Read(buf)
+	if w := p.st.capture.Load(); w != nil && n > 0 {
+		p.st.writeCapture(w.WriteRaw(time.Now(), capture.Inbound, buf[:n]))
+	}
+	if r := p.st.recorder.Load(); r != nil && n > 0 {
+		if recordErr := r.Record(buf[:n]); recordErr != nil && p.st.recorder.CompareAndSwap(r, nil) {
+			log.Printf("Recording stopped on %s: %v", p.st.portName, recordErr)
+		}
+	}
+	return p.stripEcho(buf[:n]), err
+}
+
+// stripEcho removes the expected echo from the start of chunk in place and
+// returns how many bytes are left. The line puts every written byte back in
+// order, so each byte read while an echo is expected is that echo; one that
+// differs collided with another sender and is kept.
+func (p *capturedPort) stripEcho(chunk []byte) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	kept := chunk[:0]
+	for _, b := range chunk {
+		if len(p.echo) == 0 {
+			kept = append(kept, b)
+			continue
+		}
+		if p.echo[0] != b {
+			kept = append(kept, b)
+		}
+		p.echo = p.echo[1:]
+	}
+	return len(kept)
+}
+
+func (p *capturedPort) Write(buf []byte) (int, error) {
+	if p.st.echoing() && !p.st.echoActive.Load() && !p.st.rawActive.Load() {
+		p.mutex.Lock()
+		p.echo = append(p.echo, buf...)
+		p.mutex.Unlock()
+	}
+	n, err := p.ReadWriteCloser.Write(buf)
+	if n < len(buf) {
+		// The bytes that never went out will not come back.
+		p.mutex.Lock()
+		p.echo = p.echo[:max(0, len(p.echo)-(len(buf)-n))]
+		p.mutex.Unlock()
+	}
+	if w := p.st.capture.Load(); w != nil && n > 0 {
+		p.st.writeCapture(w.WriteRaw(time.Now(), capture.Outbound, buf[:n]))
+	}
+	return n, err
+}
+
+func (st *SerialTerminal) captureFrame(direction capture.Direction, p *packet.Packet, data, comment string) {
+	w := st.capture.Load()
+	if w == nil {
+		return
+	}
+	st.writeCapture(w.WriteFrame(time.Now(), direction, capture.Frame{
+		Address: p.Address,
+		Control: p.Control,
+		Data:    []byte(data),
+		FCS:     p.FCS,
+		Comment: comment,
+	}))
+}
+
+// writeCapture stops a capture that can no longer be written, so a full disk
+// is reported once instead of on every byte.
+func (st *SerialTerminal) writeCapture(err error) {
+	if err != nil && st.capture.Swap(nil) != nil {
+		log.Printf("Capture stopped on %s: %v", st.portName, err)
+	}
+}
+
+func (st *SerialTerminal) openTransport() Transport {
+	if st.transport != nil {
+		return st.transport
+	}
+	if medium.IsLoopbackName(st.portName) {
+		return medium.Shared(medium.NameFromPort(st.portName))
+	}
+	return serialTransport{parity: st.parity, stopBits: st.stopBits}
+}
+
+func (st *SerialTerminal) Connect() error {
+	s, err := st.openTransport().Open(st.portName, st.GetDataBits())
 	if err != nil {
 		return st.formatError("open", err)
 	}
 
-	st.port = s
-	if st.OnStatus != nil {
-		st.OnStatus(fmt.Sprintf("Port %s open", st.portName))
-	}
+	st.port = &capturedPort{ReadWriteCloser: s, st: st}
+	st.events.Publish(events.LinkStateChanged{
+		Stamp:  events.Now(),
+		Port:   st.portName,
+		State:  events.LinkUp,
+		Status: fmt.Sprintf("Port %s open", st.portName),
+	})
 	log.Printf("Port %s opened successfully", st.portName)
 
-	go st.readPort()
-	go st.messageHandler()
+	go st.readPort(st.port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	st.stopSending = cancel
+	st.sendingDone = make(chan struct{})
+	go st.runQueue(ctx, st.sendingDone)
+
+	if st.GetMACMode() == MACTokenRing && st.GetStack().MAC {
+		st.tokenRing.SetLocalAddress(st.stationAddress())
+		st.tokenRing.Start()
+	}
 
 	return nil
 }
 
 func (st *SerialTerminal) Disconnect() error {
 	if st.port != nil {
+		st.tokenRing.Stop()
+		// The frame being sent may be writing to the port, so it is
+		// cancelled and waited for before the port goes away.
+		st.stopSending()
+		<-st.sendingDone
+		for _, o := range st.txQueue.Drain() {
+			o.result <- fmt.Errorf("port %s closed before frame was sent", st.portName)
+		}
+		st.metrics.SetQueueLength(0)
+
 		select {
 		case st.stopReading <- true:
 		default:
@@ -162,9 +587,12 @@ func (st *SerialTerminal) Disconnect() error {
 		}
 
 		st.port = nil
-		if st.OnStatus != nil {
-			st.OnStatus("Port closed")
-		}
+		st.events.Publish(events.LinkStateChanged{
+			Stamp:  events.Now(),
+			Port:   st.portName,
+			State:  events.LinkDown,
+			Status: "Port closed",
+		})
 		log.Printf("Port %s closed", st.portName)
 	}
 	return nil
@@ -180,107 +608,651 @@ func (st *SerialTerminal) formatError(operation string, err error) error {
 	return fmt.Errorf("failed to %s port %s: %v", operation, st.portName, err)
 }
 
-func (st *SerialTerminal) applyDataBitMask(msg string) string {
-	if st.dataBits >= 8 {
-		return msg
+func (st *SerialTerminal) SendPacket(address, control byte, data string) error {
+	return st.SendPacketContext(context.Background(), address, control, data)
+}
+
+// SendPacketContext is SendPacket that gives up as soon as ctx is done, be it
+// while queued, deferring to a busy channel, backing off or waiting for the
+// token.
+func (st *SerialTerminal) SendPacketContext(ctx context.Context, address, control byte, data string) error {
+	result, err := st.EnqueuePacket(ctx, address, control, data)
+	if err != nil {
+		return err
 	}
 
-	mask := byte((1 << st.dataBits) - 1)
-	result := make([]byte, len(msg))
-	for i, char := range []byte(msg) {
-		result[i] = char & mask
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return sendCancelled(ctx.Err())
 	}
+}
 
-	return string(result)
+// EnqueuePacket queues a frame behind those already waiting and returns at
+// once with a channel that receives the outcome. Link control frames (0x80
+// bit set in the control byte) go ahead of data. When the queue is full the call blocks or
+// evicts the oldest data frame, depending on the queue policy.
+func (st *SerialTerminal) EnqueuePacket(ctx context.Context, address, control byte, data string) (<-chan error, error) {
+	if st.port == nil {
+		return nil, fmt.Errorf("port is not open")
+	}
+
+	o := &outgoing{ctx: ctx, address: address, control: control, data: data, result: make(chan error, 1)}
+	if err := st.txQueue.Push(ctx, framePriority(control), o); err != nil {
+		if ctx.Err() != nil {
+			return nil, sendCancelled(err)
+		}
+		return nil, err
+	}
+	st.metrics.SetQueueLength(st.txQueue.Len())
+	return o.result, nil
 }
 
-func (st *SerialTerminal) SendPacket(address, control byte, data string) error {
+func (st *SerialTerminal) EnqueueMessage(ctx context.Context, msg string) (<-chan error, error) {
+	return st.EnqueuePacket(ctx, st.stationAddress(), 0x00, msg)
+}
+
+func framePriority(control byte) txqueue.Priority {
+	if packet.IsTokenControl(control) {
+		return txqueue.PriorityControl
+	}
+	return txqueue.PriorityData
+}
+
+// runQueue sends queued frames until ctx is done and closes done when it
+// returns. A frame is sent with a context that ends with either its own or
+// ctx, so closing the port interrupts a frame that is backing off.
+func (st *SerialTerminal) runQueue(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+	for {
+		o, err := st.txQueue.Pop(ctx)
+		if err != nil {
+			return
+		}
+		st.metrics.SetQueueLength(st.txQueue.Len())
+
+		if err := o.ctx.Err(); err != nil {
+			o.result <- sendCancelled(err)
+			continue
+		}
+		if st.rawActive.Load() {
+			o.result <- fmt.Errorf("port %s is in raw mode", st.portName)
+			continue
+		}
+		sendCtx, cancel := context.WithCancel(ctx)
+		stop := context.AfterFunc(o.ctx, cancel)
+		o.result <- st.sendPacket(sendCtx, o.address, o.control, o.data)
+		stop()
+		cancel()
+	}
+}
+
+func (st *SerialTerminal) sendPacket(ctx context.Context, address, control byte, data string) error {
 	if st.port == nil {
 		return fmt.Errorf("port is not open")
 	}
 
-	maxRetries := 16
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		log.Printf("CSMA/CD: Attempt %d - Listening to channel...", attempt+1)
-		if !st.csmaCD.ListenToChannel() {
-			log.Printf("CSMA/CD: Channel busy, waiting... (attempt %d)", attempt+1)
-			time.Sleep(100 * time.Millisecond)
+	if !st.GetStack().MAC {
+		return st.sendFrame(address, control, data)
+	}
+	if st.GetMACMode() == MACTokenRing {
+		return st.sendWithToken(ctx, address, control, data)
+	}
+
+	queued := time.Now()
+	frame := st.csmaCD.NewFrame()
+	for {
+		if err := ctx.Err(); err != nil {
+			return sendCancelled(err)
+		}
+
+		attempt := frame.Attempts()
+		log.Printf("CSMA/CD: Attempt %d - Listening to channel...", attempt)
+		if !st.csmaCD.ListenToChannel() || st.carrierSensed() {
+			log.Printf("CSMA/CD: Channel busy, deferring... (attempt %d)", attempt)
+			st.events.Publish(events.ChannelBusy{Stamp: events.Now(), Attempt: attempt})
+			if err := deferFrame(ctx, frame); err != nil {
+				return err
+			}
 			continue
 		}
 
 		log.Printf("CSMA/CD: Channel idle, starting transmission...")
 		if !st.csmaCD.StartTransmission() {
-			log.Printf("CSMA/CD: Failed to start transmission, channel not idle (attempt %d)", attempt+1)
+			log.Printf("CSMA/CD: Failed to start transmission, channel not idle (attempt %d)", attempt)
+			if err := deferFrame(ctx, frame); err != nil {
+				return err
+			}
 			continue
 		}
 
-		original := packet.NewPacket(address, control, data)
-		corrupted := packet.NewPacket(address, control, data)
-		corrupted.SimulateCorruption()
-		log.Printf("Bit corruption simulated for packet: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
-			address, control, corrupted.Data, corrupted.FCS)
-
-		stuffedData := st.bitStuffer.StuffPacket(corrupted)
-		packetInfo := st.bitStuffer.GetTransmissionInfo(original, corrupted)
-		st.packetChan <- packetInfo
+		f, err := st.encode(address, control, data)
+		if err != nil {
+			st.csmaCD.EndTransmission()
+			return err
+		}
 
-		_, err := st.port.Write([]byte(stuffedData))
+		txStart := time.Now()
+		collided, err := st.transmit(ctx, []byte(f.Wire))
+		st.metrics.RecordTransmission(metrics.Airtime(len(f.Wire), st.GetDataBits(), baudRate))
 		if err != nil {
 			st.csmaCD.EndTransmission()
-			return st.formatError("write to", err)
+			return err
 		}
 
-		log.Printf("CSMA/CD: Checking for collision during transmission...")
-		if st.csmaCD.DetectCollision() {
-			log.Printf("CSMA/CD: Collision detected during transmission (attempt %d)", attempt+1)
+		if collided {
+			log.Printf("CSMA/CD: Collision detected during transmission (attempt %d)", attempt)
+			st.events.Publish(events.Collision{Stamp: events.Now(), Attempt: attempt})
 			st.csmaCD.SendJamSignal()
 			st.csmaCD.EndTransmission()
 
-			backoffDelay := st.csmaCD.CalculateBackoffDelay()
+			backoffDelay, err := frame.Collision()
+			if err != nil {
+				log.Printf("CSMA/CD: Giving up after %d collisions", frame.Collisions())
+				return fmt.Errorf("%w (%d collisions)", err, frame.Collisions())
+			}
+			st.metrics.RecordBackoff(backoffDelay)
+			st.events.Publish(events.Backoff{Stamp: events.Now(), Attempt: attempt, Delay: backoffDelay})
 			log.Printf("CSMA/CD: Backing off for %v", backoffDelay)
-			time.Sleep(backoffDelay)
+			if err := sleepContext(ctx, backoffDelay); err != nil {
+				return sendCancelled(err)
+			}
 			continue
 		}
 
+		st.metrics.RecordFrame(txStart.Sub(queued), frame.Attempts(), len(f.Payload))
 		log.Printf("CSMA/CD: Transmission successful!")
-		log.Printf("Packet sent to %s: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
-			st.portName, address, control, original.Data, original.FCS)
-		st.messageChan <- "TX:" + original.Data
+		st.publishSent(f, frame.Attempts())
 		st.csmaCD.EndTransmission()
-		st.csmaCD.ResetBackoff()
 		return nil
 	}
+}
 
-	return fmt.Errorf("maximum retry attempts (%d) exceeded", maxRetries)
+// buildPipeline composes the stages of the current stack. It is cheap, so it
+// is done for every frame and settings changed while the port is open apply
+// to the next one.
+func (st *SerialTerminal) buildPipeline() (*pipeline.Pipeline, error) {
+	return pipeline.Build(st.GetStack().Stages(st.noiseEnabled.Load()), pipeline.Options{
+		DataBits: st.GetDataBits(),
+		Compress: st.compression.Load(),
+		Session:  st.session.Load(),
+		Source:   st.stationAddress(),
+	})
 }
 
-func (st *SerialTerminal) SendMessage(msg string) error {
-	address := byte(0x01)
-	if strings.Contains(st.portName, "ttys003") {
-		address = 0x02
+func (st *SerialTerminal) encode(address, control byte, data string) (*pipeline.Frame, error) {
+	p, err := st.buildPipeline()
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.Encode(address, control, data)
+	if err != nil {
+		return nil, err
+	}
+	if f.Flipped != nil {
+		log.Printf("Bit corruption simulated for packet: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
+			address, control, f.Data, f.FCS)
 	}
+	return f, nil
+}
 
-	return st.SendPacket(address, 0x00, msg)
+func (st *SerialTerminal) decode(wire string) (*pipeline.Frame, error) {
+	p, err := st.buildPipeline()
+	if err != nil {
+		return nil, err
+	}
+	return p.Decode(wire)
 }
 
-func (st *SerialTerminal) messageHandler() {
+// sendFrame writes a frame at once, for stacks without a MAC layer.
+func (st *SerialTerminal) sendFrame(address, control byte, data string) error {
+	queued := time.Now()
+	f, err := st.encode(address, control, data)
+	if err != nil {
+		return err
+	}
+
+	txStart := time.Now()
+	_, err = st.port.Write([]byte(f.Wire))
+	st.metrics.RecordTransmission(metrics.Airtime(len(f.Wire), st.GetDataBits(), baudRate))
+	if err != nil {
+		return st.formatError("write to", err)
+	}
+	st.metrics.RecordFrame(txStart.Sub(queued), 1, len(f.Payload))
+	st.publishSent(f, 1)
+	return nil
+}
+
+// receiveLines decodes every complete line of the raw stack in data and
+// returns what is left of it.
+func (st *SerialTerminal) receiveLines(data string) string {
 	for {
-		select {
-		case msg := <-st.messageChan:
-			if st.OnMessage != nil {
-				fyne.Do(func() { st.OnMessage(msg) })
+		end := strings.IndexByte(data, '\n')
+		if end == -1 && len(data) <= 1024 {
+			return data
+		}
+		line := data
+		if end != -1 {
+			line = data[:end+1]
+		}
+		data = data[len(line):]
+
+		f, err := st.decode(line)
+		if err != nil {
+			log.Printf("Failed to decode line from %s: %v", st.portName, err)
+			continue
+		}
+		st.receiveFrame(f, line)
+	}
+}
+
+// receiveFrame reports a decoded frame, unless it belongs to a file
+// transfer.
+func (st *SerialTerminal) receiveFrame(f *pipeline.Frame, raw string) {
+	if f.Corrected {
+		st.metrics.RecordReceive(metrics.ReceiveCorrected)
+		st.captureReceived(f, f.Received, fmt.Sprintf("single error, corrected to %q", f.Payload))
+		if st.files.HandleFrame(f.Address, f.Control, f.Payload) {
+			return
+		}
+		log.Printf("Single error detected and corrected from %s: Original=%s, Corrected=%s, FCS=0x%02X",
+			st.portName, f.Received, f.Payload, f.FCS)
+		st.events.Publish(events.FrameCorrected{
+			Stamp:     events.Now(),
+			Address:   f.Address,
+			Control:   f.Control,
+			Received:  f.Received,
+			Corrected: f.Payload,
+			FCS:       f.FCS,
+			Bit:       f.Bit,
+			Raw:       []byte(raw),
+			Trace:     f.Bits,
+			Steps:     f.Trace.String(),
+		})
+		return
+	}
+
+	st.metrics.RecordReceive(metrics.ReceiveOK)
+	st.captureReceived(f, f.Payload, "")
+	if st.files.HandleFrame(f.Address, f.Control, f.Payload) {
+		return
+	}
+	log.Printf("Packet received from %s: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
+		st.portName, f.Address, f.Control, f.Payload, f.FCS)
+	st.events.Publish(events.FrameReceived{
+		Stamp:   events.Now(),
+		Address: f.Address,
+		Control: f.Control,
+		Data:    f.Payload,
+		FCS:     f.FCS,
+		Raw:     []byte(raw),
+		Trace:   f.Bits,
+		Steps:   f.Trace.String(),
+	})
+}
+
+func (st *SerialTerminal) dropFrame(f *pipeline.Frame, reason, raw string) {
+	st.metrics.RecordReceive(metrics.ReceiveDropped)
+	st.captureReceived(f, f.Data, reason)
+	log.Printf("Frame dropped from %s: Data=%s, FCS=0x%02X (%s)", st.portName, f.Data, f.FCS, reason)
+	st.events.Publish(events.FrameDropped{
+		Stamp:   events.Now(),
+		Address: f.Address,
+		Control: f.Control,
+		Data:    f.Data,
+		FCS:     f.FCS,
+		Reason:  reason,
+		Raw:     []byte(raw),
+		Trace:   f.Bits,
+		Steps:   f.Trace.String(),
+	})
+}
+
+// captureReceived writes a decoded frame to the capture. Lines of the raw
+// stack are not frames; the capture has their bytes already.
+func (st *SerialTerminal) captureReceived(f *pipeline.Frame, data, comment string) {
+	if st.GetStack().Stuffing {
+		st.captureFrame(capture.Inbound, f.Packet(), data, comment)
+	}
+}
+
+// transmit writes a frame and reports whether it collided. In echo mode every
+// byte is compared with what the line reads back while it is being sent.
+func (st *SerialTerminal) transmit(ctx context.Context, frame []byte) (bool, error) {
+	if st.csmaCD.GetDetectionMode() != csmacd.DetectionEcho {
+		if _, err := st.port.Write(frame); err != nil {
+			return false, st.formatError("write to", err)
+		}
+		log.Printf("CSMA/CD: Checking for collision during transmission...")
+		return st.csmaCD.DetectCollision(), nil
+	}
+
+	st.startEcho()
+	defer st.stopEcho()
+
+	var echoed []byte
+	for i, b := range frame {
+		if _, err := st.port.Write([]byte{b}); err != nil {
+			return false, st.formatError("write to", err)
+		}
+
+		for len(echoed) <= i {
+			select {
+			case chunk := <-st.echoChan:
+				echoed = append(echoed, chunk...)
+			case <-time.After(echoTimeout):
+				return false, fmt.Errorf("no echo from port %s within %v, line does not read back", st.portName, echoTimeout)
+			case <-ctx.Done():
+				return false, sendCancelled(ctx.Err())
+			}
+		}
+
+		if echoed[i] != b {
+			log.Printf("CSMA/CD: Echo mismatch at byte %d: sent 0x%02X, read back 0x%02X", i, b, echoed[i])
+			st.csmaCD.ReportCollision()
+			if _, err := st.port.Write(csmacd.JamPattern); err != nil {
+				return true, st.formatError("write to", err)
 			}
-		case packetInfo := <-st.packetChan:
-			if st.OnPacket != nil {
-				fyne.Do(func() { st.OnPacket(packetInfo) })
+			time.Sleep(jamSettleTime)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// carrierSensed reports recent traffic on the line. It is only meaningful in
+// echo mode, where the terminal is attached to a real shared bus.
+func (st *SerialTerminal) carrierSensed() bool {
+	if st.csmaCD.GetDetectionMode() != csmacd.DetectionEcho {
+		return false
+	}
+	return time.Since(time.Unix(0, st.lastReceive.Load())) < carrierSenseGap
+}
+
+func (st *SerialTerminal) startEcho() {
+	for {
+		select {
+		case <-st.echoChan:
+		default:
+			st.echoActive.Store(true)
+			return
+		}
+	}
+}
+
+func (st *SerialTerminal) stopEcho() {
+	st.echoActive.Store(false)
+	for {
+		select {
+		case <-st.echoChan:
+		default:
+			return
+		}
+	}
+}
+
+func (st *SerialTerminal) sendWithToken(ctx context.Context, address, control byte, data string) error {
+	queued := time.Now()
+	for {
+		log.Printf("Token Ring: waiting for token at station 0x%02X...", st.tokenRing.GetLocalAddress())
+		deadline, ok := st.tokenRing.AcquireTokenContext(ctx, tokenWaitTimeout)
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return sendCancelled(err)
 			}
-		case <-st.stopReading:
+			return fmt.Errorf("token not received within %v", tokenWaitTimeout)
+		}
+
+		if time.Now().After(deadline) || !st.tokenRing.IsHoldingToken() {
+			log.Printf("Token Ring: token holding time expired before transmission, waiting for next token")
+			continue
+		}
+
+		f, err := st.encode(address, control, data)
+		if err != nil {
+			st.tokenRing.ReleaseToken()
+			return err
+		}
+
+		txStart := time.Now()
+		_, err = st.port.Write([]byte(f.Wire))
+		st.tokenRing.ReleaseToken()
+		st.metrics.RecordTransmission(metrics.Airtime(len(f.Wire), st.GetDataBits(), baudRate))
+		if err != nil {
+			return st.formatError("write to", err)
+		}
+		st.metrics.RecordFrame(txStart.Sub(queued), 1, len(f.Payload))
+		st.publishSent(f, 1)
+		return nil
+	}
+}
+
+// deferInterval is how long a frame waits before listening to a busy channel
+// again.
+const deferInterval = 100 * time.Millisecond
+
+// deferFrame waits before the next attempt at a frame that found the channel
+// busy, or gives up once it has waited csmacd.MaxDeferrals times.
+func deferFrame(ctx context.Context, frame *csmacd.FrameBackoff) error {
+	if err := frame.Defer(); err != nil {
+		log.Printf("CSMA/CD: Giving up after %d deferrals", frame.Deferrals())
+		return fmt.Errorf("%w (%d deferrals)", err, frame.Deferrals())
+	}
+	if err := sleepContext(ctx, deferInterval); err != nil {
+		return sendCancelled(err)
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func sendCancelled(err error) error {
+	log.Printf("Send cancelled: %v", err)
+	return fmt.Errorf("send cancelled: %w", err)
+}
+
+func (st *SerialTerminal) publishSent(f *pipeline.Frame, attempts int) {
+	log.Printf("Packet sent to %s: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
+		st.portName, f.Address, f.Control, f.Payload, f.FCS)
+	if st.GetStack().Stuffing {
+		st.captureFrame(capture.Outbound, f.Packet(), f.Payload, fmt.Sprintf("sent after %d attempt(s)", attempts))
+	}
+	if f.CompressedSize > 0 {
+		st.metrics.RecordCompression(len(f.Payload), f.CompressedSize)
+	}
+
+	info := f.Trace.Markdown("Pipeline")
+	if f.Info != "" {
+		info = f.Info + "\n\n" + info
+	}
+	st.events.Publish(events.FrameSent{
+		Stamp:    events.Now(),
+		Address:  f.Address,
+		Control:  f.Control,
+		Data:     f.Payload,
+		FCS:      f.FCS,
+		Attempts: attempts,
+		Raw:      []byte(f.Wire),
+		Info:     info,
+		Trace:    f.Bits,
+		Steps:    f.Trace.String(),
+	})
+}
+
+func (st *SerialTerminal) passToken(next byte) {
+	if st.port == nil || st.rawActive.Load() {
+		return
+	}
+
+	token := packet.NewTokenPacket(next)
+	if _, err := st.port.Write([]byte(st.bitStuffer.StuffPacket(token))); err != nil {
+		log.Printf("Token Ring: failed to pass token to 0x%02X: %v", next, err)
+		return
+	}
+	st.captureFrame(capture.Outbound, token, token.Data, "token")
+}
+
+func (st *SerialTerminal) stationAddress() byte {
+	if st.addressSet {
+		return st.address
+	}
+	if strings.Contains(st.portName, "ttys003") {
+		return 0x02
+	}
+	return 0x01
+}
+
+func (st *SerialTerminal) SendMessage(msg string) error {
+	return st.SendMessageContext(context.Background(), msg)
+}
+
+func (st *SerialTerminal) SendMessageContext(ctx context.Context, msg string) error {
+	return st.SendPacketContext(ctx, st.stationAddress(), 0x00, msg)
+}
+
+// RawSession hands the open port to fn as a plain byte stream, bypassing
+// framing and the MAC, for protocols such as XMODEM. Queued frames fail and
+// tokens are not passed until fn returns.
+func (st *SerialTerminal) RawSession(fn func(rw io.ReadWriter) error) error {
+	if st.port == nil {
+		return fmt.Errorf("port is not open")
+	}
+	if !st.rawActive.CompareAndSwap(false, true) {
+		return fmt.Errorf("port %s is already in raw mode", st.portName)
+	}
+	st.drainRaw()
+	defer func() {
+		st.rawActive.Store(false)
+		st.drainRaw()
+	}()
+
+	log.Printf("Port %s switched to raw mode", st.portName)
+	defer log.Printf("Port %s back to framed mode", st.portName)
+	return fn(&rawPort{terminal: st, echoing: st.echoing()})
+}
+
+// echoing reports whether the line reads back the bytes the terminal writes.
+func (st *SerialTerminal) echoing() bool {
+	return medium.IsLoopbackName(st.portName) || st.csmaCD.GetDetectionMode() == csmacd.DetectionEcho
+}
+
+func (st *SerialTerminal) drainRaw() {
+	for {
+		select {
+		case <-st.rawChan:
+		default:
 			return
 		}
 	}
 }
 
-func (st *SerialTerminal) readPort() {
+// rawPort reads what readPort routes to it and returns (0, nil) when nothing
+// arrives for a while, like a serial port with a read timeout. On a line that
+// reads back its own bytes the echo is removed.
+type rawPort struct {
+	terminal *SerialTerminal
+	pending  []byte
+	echoing  bool
+	mutex    sync.Mutex
+	echo     []byte
+}
+
+func (p *rawPort) Read(buf []byte) (int, error) {
+	if len(p.pending) == 0 {
+		timer := time.NewTimer(50 * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case chunk := <-p.terminal.rawChan:
+			p.pending = p.stripEcho(chunk)
+		case <-timer.C:
+			return 0, nil
+		}
+	}
+	n := copy(buf, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *rawPort) stripEcho(chunk []byte) []byte {
+	if !p.echoing {
+		return chunk
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	kept := chunk[:0]
+	for _, b := range chunk {
+		if len(p.echo) > 0 && p.echo[0] == b {
+			p.echo = p.echo[1:]
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return kept
+}
+
+func (p *rawPort) Write(buf []byte) (int, error) {
+	port := p.terminal.port
+	if port == nil {
+		return 0, fmt.Errorf("port is not open")
+	}
+	if p.echoing {
+		p.mutex.Lock()
+		p.echo = append(p.echo, buf...)
+		p.mutex.Unlock()
+	}
+	return port.Write(buf)
+}
+
+// SetMaxFileSize sets the largest file received over frames, see
+// filetransfer.Receiver.
+func (st *SerialTerminal) SetMaxFileSize(size int64) {
+	st.files.SetMaxFileSize(size)
+}
+
+// SendFile transfers data as a file called name, see filetransfer.Send.
+func (st *SerialTerminal) SendFile(ctx context.Context, name string, data []byte, chunkSize int) error {
+	if st.port == nil {
+		return fmt.Errorf("port is not open")
+	}
+	if config := st.GetStack(); !config.Stuffing {
+		return fmt.Errorf("the %s stack has no frames to carry a file, use XMODEM or YMODEM", config.Name)
+	}
+	return filetransfer.Send(ctx, st, st.stationAddress(), name, data, chunkSize, st.publishProgress)
+}
+
+func (st *SerialTerminal) publishProgress(p filetransfer.Progress) {
+	st.events.Publish(events.TransferProgress{
+		Stamp:      events.Now(),
+		Sending:    p.Direction == filetransfer.Sending,
+		Name:       p.Name,
+		Done:       p.Done,
+		Total:      p.Total,
+		Throughput: p.Throughput,
+	})
+}
+
+// publishStray reports bytes that arrived outside any frame.
+func (st *SerialTerminal) publishStray(data string) {
+	log.Printf("Discarded %d stray byte(s) from %s", len(data), st.portName)
+	st.events.Publish(events.StrayBytes{Stamp: events.Now(), Data: []byte(data)})
+}
+
+// readPort gets the port it reads from rather than using st.port, which
+// Disconnect clears while the reader may still be running.
+func (st *SerialTerminal) readPort(port io.Reader) {
 	buf := make([]byte, 512)
 	var receivedData string
 
@@ -290,33 +1262,68 @@ func (st *SerialTerminal) readPort() {
 			log.Printf("Reading stopped for port %s", st.portName)
 			return
 		default:
-			if st.port == nil {
-				return
-			}
-
-			n, err := st.port.Read(buf)
+			n, err := port.Read(buf)
 			if err != nil {
 				if err == io.EOF {
 					time.Sleep(time.Millisecond * 100)
 					continue
 				}
 				log.Printf("Error reading from port %s: %v", st.portName, err)
+				st.events.Publish(events.LinkStateChanged{
+					Stamp:  events.Now(),
+					Port:   st.portName,
+					State:  events.LinkError,
+					Status: fmt.Sprintf("Read error on %s", st.portName),
+					Err:    err,
+				})
 				time.Sleep(time.Second * 1)
 				continue
 			}
 
+			if n > 0 {
+				st.lastReceive.Store(time.Now().UnixNano())
+			}
+
+			if n > 0 && st.rawActive.Load() {
+				select {
+				case st.rawChan <- append([]byte(nil), buf[:n]...):
+				default:
+					log.Printf("Raw mode reader fell behind on %s, dropped %d bytes", st.portName, n)
+				}
+				continue
+			}
+
+			if n > 0 && st.echoActive.Load() {
+				select {
+				case st.echoChan <- append([]byte(nil), buf[:n]...):
+				default:
+				}
+				continue
+			}
+
+			if n > 0 && !st.GetStack().Stuffing {
+				receivedData = st.receiveLines(receivedData + string(buf[:n]))
+				continue
+			}
+
 			if n > 0 {
 				receivedData += string(buf[:n])
 
-				flag := byte(0x0E)
+				flag := packet.FlagByte
 				for {
 					startIdx := strings.IndexByte(receivedData, flag)
 					if startIdx == -1 {
 						if len(receivedData) > 1024 {
+							st.publishStray(receivedData)
 							receivedData = ""
 						}
 						break
 					}
+					if startIdx > 0 {
+						st.publishStray(receivedData[:startIdx])
+						receivedData = receivedData[startIdx:]
+						startIdx = 0
+					}
 
 					endIdx := strings.IndexByte(receivedData[startIdx+1:], flag)
 					if endIdx == -1 {
@@ -325,30 +1332,51 @@ func (st *SerialTerminal) readPort() {
 					endIdx += startIdx + 1
 
 					frameData := receivedData[startIdx : endIdx+1]
-					packetObj := st.bitStuffer.DestuffPacket(frameData)
+					f, err := st.decode(frameData)
 
-					if packetObj == nil {
-						receivedData = receivedData[startIdx+1:]
+					var malformed *pipeline.MalformedError
+					if errors.As(err, &malformed) {
+						// The closing flag may open the next frame, so it is
+						// kept. Two flags back to back are the closing flag
+						// of a frame we could not parse and the next opening
+						// one.
+						if endIdx > startIdx+1 {
+							log.Printf("Malformed frame from %s: % X", st.portName, frameData)
+							st.events.Publish(events.FrameMalformed{
+								Stamp:  events.Now(),
+								Raw:    []byte(frameData),
+								Reason: malformed.Reason,
+							})
+						}
+						receivedData = receivedData[endIdx:]
 						continue
 					}
 
-					hasErrors, errorCount, correctedData := packetObj.DetectAndCorrectErrors()
-
 					receivedData = receivedData[endIdx+1:]
 
-					if !hasErrors {
-						log.Printf("Packet received from %s: Address=0x%02X, Control=0x%02X, Data=%s, FCS=0x%02X",
-							st.portName, packetObj.Address, packetObj.Control, packetObj.Data, packetObj.FCS)
-						st.messageChan <- "RX:" + packetObj.Data
-					} else if errorCount == 1 {
-						log.Printf("Single error detected and corrected from %s: Original=%s, Corrected=%s, FCS=0x%02X",
-							st.portName, packetObj.Data, correctedData, packetObj.FCS)
-						st.messageChan <- "RX:" + correctedData
-					} else if errorCount == 2 {
-						log.Printf("Double error detected from %s: Data=%s, FCS=0x%02X (cannot correct)",
-							st.portName, packetObj.Data, packetObj.FCS)
-					} else {
+					if err != nil && f == nil {
+						log.Printf("Failed to decode frame from %s: %v", st.portName, err)
+						continue
+					}
+
+					if packet.IsTokenControl(f.Control) {
+						st.captureFrame(capture.Inbound, f.Packet(), f.Data, "token")
+						if st.GetMACMode() == MACTokenRing && st.GetStack().MAC {
+							st.tokenRing.ReceiveToken(f.Address)
+						}
+						continue
+					}
+
+					var dropped *pipeline.DropError
+					if errors.As(err, &dropped) {
+						st.dropFrame(f, dropped.Reason, frameData)
+						continue
+					}
+					if err != nil {
+						log.Printf("Failed to decode frame from %s: %v", st.portName, err)
+						continue
 					}
+					st.receiveFrame(f, frameData)
 				}
 			}
 
@@ -0,0 +1,615 @@
+package serialterminal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"oks/internal/capture"
+	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/packet"
+	"oks/internal/pipeline"
+	"oks/internal/replay"
+	"oks/internal/stack"
+	"oks/internal/xmodem"
+)
+
+func newLoopbackPair(t *testing.T, bus string) (*SerialTerminal, *SerialTerminal) {
+	t.Helper()
+	sender := New("loopback:" + bus)
+	receiver := New("loopback:" + bus)
+	for _, st := range []*SerialTerminal{sender, receiver} {
+		st.SetCSMAEmulation(false)
+		if err := st.Connect(); err != nil {
+			t.Fatalf("Unexpected connect error: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		sender.Disconnect()
+		receiver.Disconnect()
+	})
+	return sender, receiver
+}
+
+func waitFor[T events.Event](t *testing.T, sub *events.Subscription) T {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-sub.Events():
+			if ev, ok := e.(T); ok {
+				return ev
+			}
+		case <-timeout:
+			var zero T
+			t.Fatalf("Timed out waiting for %T", zero)
+			return zero
+		}
+	}
+}
+
+func TestFrameDeliveredOverLoopback(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "delivery")
+	tx := sender.Subscribe(64)
+	defer tx.Close()
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	if err := sender.SendMessage("hello"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if sent := waitFor[events.FrameSent](t, tx); len(sent.Raw) < 2 || sent.Raw[0] != packet.FlagByte || sent.Raw[len(sent.Raw)-1] != packet.FlagByte {
+		t.Errorf("Expected the sent event to carry the stuffed frame, got % X", sent.Raw)
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-rx.Events():
+			switch e.(type) {
+			case events.FrameReceived, events.FrameCorrected, events.FrameDropped:
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the receiver to report the frame")
+		}
+	}
+}
+
+func TestEchoDetectionWithoutContention(t *testing.T) {
+	sender, _ := newLoopbackPair(t, "echo")
+	sender.SetCSMADetectionMode(csmacd.DetectionEcho)
+	tx := sender.Subscribe(64)
+	defer tx.Close()
+
+	if err := sender.SendMessage("echo"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	sent := waitFor[events.FrameSent](t, tx)
+	if sent.Attempts != 1 {
+		t.Errorf("Expected a clean echo to succeed on the first attempt, got %d", sent.Attempts)
+	}
+	if collisions, _, _ := sender.GetCSMAStatistics(); collisions != 0 {
+		t.Errorf("Expected no collisions on an idle line, got %d", collisions)
+	}
+}
+
+func TestLinkStateEvents(t *testing.T) {
+	st := New("loopback:link")
+	sub := st.Subscribe(8)
+	defer sub.Close()
+
+	if err := st.Connect(); err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	if up := waitFor[events.LinkStateChanged](t, sub); up.State != events.LinkUp {
+		t.Errorf("Expected link up, got %v", up.State)
+	}
+
+	if err := st.Disconnect(); err != nil {
+		t.Fatalf("Unexpected disconnect error: %v", err)
+	}
+	if down := waitFor[events.LinkStateChanged](t, sub); down.State != events.LinkDown {
+		t.Errorf("Expected link down, got %v", down.State)
+	}
+}
+
+func TestSendPacketContextCancelledWhileDeferring(t *testing.T) {
+	sender, _ := newLoopbackPair(t, "cancel")
+	sender.SetCSMAEmulation(true)
+	sender.SetCSMAProbabilities(1, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := sender.SendMessageContext(ctx, "never")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected send to return soon after the deadline, took %v", elapsed)
+	}
+}
+
+func TestQueuedBurstDeliveredInOrder(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "burst")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	messages := []string{"one", "two", "three", "four", "five"}
+	var results []<-chan error
+	for _, msg := range messages {
+		result, err := sender.EnqueueMessage(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("Unexpected enqueue error: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	for i, result := range results {
+		if err := <-result; err != nil {
+			t.Errorf("Unexpected send error for %s: %v", messages[i], err)
+		}
+	}
+
+	for _, want := range messages {
+		got := waitFor[events.FrameReceived](t, rx)
+		if got.Data != want {
+			t.Errorf("Expected %s, got %s", want, got.Data)
+		}
+	}
+
+	if sender.GetQueueLength() != 0 {
+		t.Errorf("Expected an empty queue, got %d", sender.GetQueueLength())
+	}
+}
+
+func TestFileTransferOverLoopback(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "file")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(256)
+	defer rx.Close()
+
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := sender.SendFile(context.Background(), "table.bin", data, 64); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	file := waitFor[events.FileReceived](t, rx)
+	if file.Err != nil {
+		t.Fatalf("Unexpected transfer error: %v", file.Err)
+	}
+	if file.Name != "table.bin" || string(file.Data) != string(data) {
+		t.Errorf("Expected table.bin with the sent bytes, got %s with %d bytes", file.Name, len(file.Data))
+	}
+}
+
+func TestSenderDoesNotReceiveItsOwnFrames(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "own-echo")
+	sender.SetNoiseEnabled(false)
+	own := sender.Subscribe(256)
+	defer own.Close()
+	rx := receiver.Subscribe(256)
+	defer rx.Close()
+
+	if err := sender.SendMessage("hello"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if err := sender.SendFile(context.Background(), "a.bin", []byte("contents"), 64); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	waitFor[events.FileReceived](t, rx)
+
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case e := <-own.Events():
+			switch e := e.(type) {
+			case events.FrameReceived:
+				t.Errorf("Expected the sender to receive nothing, got its own frame %q", e.Data)
+			case events.FileReceived:
+				t.Errorf("Expected the sender to receive nothing, got its own file %s", e.Name)
+			case events.StrayBytes:
+				t.Errorf("Expected the echo to be removed, got %d stray bytes", len(e.Data))
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestRawSessionCarriesXMODEM(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "xmodem")
+	data := []byte(strings.Repeat("firmware image ", 20))
+	opts := xmodem.Options{Mode: xmodem.ModeCRC, Timeout: time.Second}
+
+	received := make(chan []byte, 1)
+	go func() {
+		receiver.RawSession(func(rw io.ReadWriter) error {
+			got, err := xmodem.Receive(context.Background(), rw, opts)
+			if err != nil {
+				t.Errorf("Unexpected receive error: %v", err)
+			}
+			received <- got
+			return err
+		})
+	}()
+
+	err := sender.RawSession(func(rw io.ReadWriter) error {
+		return xmodem.Send(context.Background(), rw, data, opts)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+
+	if got := <-received; string(got) != string(data) {
+		t.Errorf("Expected %d bytes, got %d", len(data), len(got))
+	}
+
+	if err := sender.SendMessage("framed again"); err != nil {
+		t.Errorf("Expected framed sending to work after the raw session, got %v", err)
+	}
+}
+
+func TestCaptureRecordsTraffic(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "capture")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	var buf bytes.Buffer
+	w, err := capture.NewWriter(&buf, "loopback:capture")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	receiver.SetCapture(w)
+
+	if err := sender.SendMessage("captured"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	waitFor[events.FrameReceived](t, rx)
+	receiver.SetCapture(nil)
+	w.Close()
+
+	if !bytes.Contains(buf.Bytes(), []byte{0x0E}) {
+		t.Error("Expected the raw frame bytes in the capture")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("captured")) {
+		t.Error("Expected the decoded frame data in the capture")
+	}
+}
+
+func TestRecordedSessionReplays(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "record")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	var recording bytes.Buffer
+	recorder := replay.NewRecorder(&recording)
+	receiver.SetRecorder(recorder)
+	for _, msg := range []string{"first", "second"} {
+		if err := sender.SendMessage(msg); err != nil {
+			t.Fatalf("Unexpected send error: %v", err)
+		}
+		waitFor[events.FrameReceived](t, rx)
+	}
+	receiver.SetRecorder(nil)
+	recorder.Close()
+
+	chunks, err := replay.Decode(&recording)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+
+	transport := replay.NewTransport(chunks, 0)
+	replayed := New("replay")
+	replayed.SetCSMAEmulation(false)
+	replayed.SetTransport(transport)
+	sub := replayed.Subscribe(64)
+	defer sub.Close()
+	if err := replayed.Connect(); err != nil {
+		t.Fatalf("Unexpected connect error: %v", err)
+	}
+	defer replayed.Disconnect()
+
+	for _, want := range []string{"first", "second"} {
+		if got := waitFor[events.FrameReceived](t, sub); got.Data != want {
+			t.Errorf("Expected replayed frame %q, got %q", want, got.Data)
+		}
+	}
+}
+
+func TestReceiverReportsStrayAndMalformedBytes(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "diagnostics")
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	err := sender.RawSession(func(rw io.ReadWriter) error {
+		_, err := rw.Write([]byte("junk\x0e\xff\x0e"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	if stray := waitFor[events.StrayBytes](t, rx); string(stray.Data) != "junk" {
+		t.Errorf("Expected the stray bytes %q, got %q", "junk", stray.Data)
+	}
+	if bad := waitFor[events.FrameMalformed](t, rx); !bytes.Equal(bad.Raw, []byte{0x0e, 0xff, 0x0e}) {
+		t.Errorf("Expected the malformed frame 0E FF 0E, got % X", bad.Raw)
+	}
+}
+
+func TestMalformedFrameIsNotReportedAsStrayBytes(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "malformed-stray")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	err := sender.RawSession(func(rw io.ReadWriter) error {
+		_, err := rw.Write([]byte{0x0e, 0xff, 0xfe, 0x0e})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	waitFor[events.FrameMalformed](t, rx)
+
+	// A good frame after the malformed one shows whether anything was
+	// reported in between.
+	if err := sender.SendMessage("hello"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-rx.Events():
+			switch ev := e.(type) {
+			case events.StrayBytes:
+				t.Fatalf("Expected no stray bytes after a malformed frame, got % X", ev.Data)
+			case events.FrameReceived:
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the frame after the malformed one")
+		}
+	}
+}
+
+func TestEveryStackDeliversOverLoopback(t *testing.T) {
+	for _, config := range stack.Configs() {
+		t.Run(config.Name, func(t *testing.T) {
+			sender, receiver := newLoopbackPair(t, "stack-"+config.Name)
+			for _, st := range []*SerialTerminal{sender, receiver} {
+				st.SetStack(config)
+				st.SetNoiseEnabled(false)
+			}
+			rx := receiver.Subscribe(64)
+			defer rx.Close()
+
+			if err := sender.SendMessage("hello"); err != nil {
+				t.Fatalf("Unexpected send error: %v", err)
+			}
+			if got := waitFor[events.FrameReceived](t, rx); got.Data != "hello" {
+				t.Errorf("Expected %q, got %q", "hello", got.Data)
+			}
+		})
+	}
+}
+
+func TestSetStackWhileConnected(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "switch")
+	sender.SetNoiseEnabled(false)
+	rx := receiver.Subscribe(256)
+	defer rx.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			config := stack.Configs()[i%len(stack.Configs())]
+			sender.SetStack(config)
+			receiver.SetStack(config)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		sender.SendMessage("during")
+	}
+	<-done
+
+	for _, st := range []*SerialTerminal{sender, receiver} {
+		st.SetStack(stack.Stuffed)
+	}
+	if err := sender.SendMessage("after"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	for {
+		if got := waitFor[events.FrameReceived](t, rx); got.Data == "after" {
+			break
+		}
+	}
+	if receiver.GetStack().Name != stack.Stuffed.Name {
+		t.Errorf("Expected the %s stack, got %s", stack.Stuffed.Name, receiver.GetStack().Name)
+	}
+}
+
+func TestSettingsChangeWhileConnected(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "settings")
+	rx := receiver.Subscribe(256)
+	defer rx.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			sender.SetNoiseEnabled(i%2 == 0)
+			sender.SetCompression(i%2 == 1)
+			sender.SetMACMode(MACCSMACD)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		sender.SendMessage("during")
+	}
+	<-done
+
+	sender.SetNoiseEnabled(false)
+	sender.SetCompression(true)
+	if err := sender.SendMessage("after"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	for {
+		if got := waitFor[events.FrameReceived](t, rx); got.Data == "after" {
+			break
+		}
+	}
+}
+
+func TestStuffedStackDropsFrameWithWrongChecksum(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "xor")
+	receiver.SetStack(stack.Stuffed)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	p := packet.NewPacket(0x01, 0x00, "hello")
+	p.FCS = p.XORChecksum() ^ 0x01
+	err := sender.RawSession(func(rw io.ReadWriter) error {
+		_, err := rw.Write([]byte(packet.NewBitStuffer().StuffPacket(p)))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+
+	if dropped := waitFor[events.FrameDropped](t, rx); dropped.Reason != "FCS mismatch" {
+		t.Errorf("Expected the frame to be dropped for its FCS, got %q", dropped.Reason)
+	}
+}
+
+func TestCompressedFrameDeliveredOverLoopback(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "deflate")
+	sender.SetNoiseEnabled(false)
+	sender.SetCompression(true)
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	payload := strings.Repeat("ping ", 40)
+	if err := sender.SendMessage(payload); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if got := waitFor[events.FrameReceived](t, rx); got.Data != payload {
+		t.Errorf("Expected the payload back, got %q", got.Data)
+	}
+
+	snap := sender.GetMetrics()
+	if snap.CompressedFrames != 1 || snap.CompressionRatio >= 0.5 {
+		t.Errorf("Expected one frame compressed to under half, got %+v", snap)
+	}
+}
+
+func TestEncryptedFramesOverLoopback(t *testing.T) {
+	sender, receiver := newLoopbackPair(t, "aead")
+	for _, st := range []*SerialTerminal{sender, receiver} {
+		st.SetNoiseEnabled(false)
+		if err := st.SetPSK("correct horse"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	tx := sender.Subscribe(64)
+	defer tx.Close()
+	rx := receiver.Subscribe(64)
+	defer rx.Close()
+
+	// Both stations are left at the default address and still talk both ways.
+	for i := 0; i < 2; i++ {
+		if err := sender.SendMessage("hello"); err != nil {
+			t.Fatalf("Unexpected send error: %v", err)
+		}
+		if got := waitFor[events.FrameReceived](t, rx); got.Data != "hello" {
+			t.Errorf("Expected %q, got %q", "hello", got.Data)
+		}
+		if err := receiver.SendMessage("hello back"); err != nil {
+			t.Fatalf("Unexpected send error: %v", err)
+		}
+		if got := waitFor[events.FrameReceived](t, tx); got.Data != "hello back" {
+			t.Errorf("Expected %q, got %q", "hello back", got.Data)
+		}
+	}
+
+	// A sealed frame recorded off the line is rejected the second time.
+	session, _ := pipeline.NewSession("correct horse")
+	p, _ := pipeline.Build(stack.Default.Stages(false), pipeline.Options{Session: session, Source: 0x09})
+	f, _ := p.Encode(0x01, 0x00, "open the gate")
+	err := sender.RawSession(func(rw io.ReadWriter) error {
+		_, err := rw.Write([]byte(f.Wire + f.Wire))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected write error: %v", err)
+	}
+	if got := waitFor[events.FrameReceived](t, rx); got.Data != "open the gate" {
+		t.Errorf("Expected %q, got %q", "open the gate", got.Data)
+	}
+	if dropped := waitFor[events.FrameDropped](t, rx); !strings.HasPrefix(dropped.Reason, "replayed") {
+		t.Errorf("Expected the second copy to be dropped as replayed, got %q", dropped.Reason)
+	}
+
+	// A station without the key cannot inject frames.
+	sender.SetPSK("")
+	if err := sender.SendMessage("forged"); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	if dropped := waitFor[events.FrameDropped](t, rx); !strings.HasPrefix(dropped.Reason, "forged") {
+		t.Errorf("Expected the plain frame to be dropped as forged, got %q", dropped.Reason)
+	}
+}
+
+func TestRawStackIsNeverEncrypted(t *testing.T) {
+	st := New("loopback:raw-psk")
+	if err := st.SetPSK("correct horse"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !st.GetEncryption() {
+		t.Error("Expected encryption on the default stack")
+	}
+	st.SetStack(stack.Raw)
+	if st.GetEncryption() {
+		t.Error("Expected no encryption on the raw stack")
+	}
+}
+
+func TestDisconnectDuringBackoff(t *testing.T) {
+	sender, _ := newLoopbackPair(t, "backoff-disconnect")
+	sender.SetCSMAEmulation(true)
+	sender.SetCSMAProbabilities(0, 1)
+	sender.SetCSMATiming(time.Second, time.Millisecond)
+	tx := sender.Subscribe(64)
+	defer tx.Close()
+
+	result := make(chan error, 1)
+	go func() { result <- sender.SendMessage("hello") }()
+	waitFor[events.Backoff](t, tx)
+
+	if err := sender.Disconnect(); err != nil {
+		t.Fatalf("Unexpected disconnect error: %v", err)
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected the interrupted send to fail")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Disconnect to interrupt the backoff")
+	}
+}
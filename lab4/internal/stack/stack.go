@@ -0,0 +1,108 @@
+package stack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FCS is the frame check sequence a stack appends to every frame.
+type FCS int
+
+const (
+	FCSNone FCS = iota
+	// FCSXOR is address, control and every data byte XORed together. It
+	// detects errors but cannot correct them.
+	FCSXOR
+	// FCSCRC8 is the cyclic code of the data. A single flipped bit is
+	// corrected, two are detected.
+	FCSCRC8
+)
+
+func (f FCS) String() string {
+	switch f {
+	case FCSXOR:
+		return "xor"
+	case FCSCRC8:
+		return "crc8"
+	default:
+		return "none"
+	}
+}
+
+// Config selects the layers a terminal runs. Each lab of the course is one
+// configuration of the same code.
+type Config struct {
+	Name string
+	Lab  int
+	// Stuffing wraps data in flag-delimited, bit-stuffed frames. Without it
+	// messages are sent as lines ending in CRLF.
+	Stuffing bool
+	FCS      FCS
+	// MAC runs CSMA/CD or the token ring before every frame. Without it
+	// frames are written as soon as they leave the queue.
+	MAC bool
+}
+
+var (
+	Raw        = Config{Name: "raw", Lab: 1}
+	Stuffed    = Config{Name: "stuffed", Lab: 2, Stuffing: true, FCS: FCSXOR}
+	StuffedCRC = Config{Name: "stuffed+crc", Lab: 3, Stuffing: true, FCS: FCSCRC8}
+	Full       = Config{Name: "stuffed+crc+csmacd", Lab: 4, Stuffing: true, FCS: FCSCRC8, MAC: true}
+)
+
+// Default is the stack a terminal starts with, the one of the last lab.
+var Default = Full
+
+// Configs lists the stacks from the simplest to the full one.
+func Configs() []Config {
+	return []Config{Raw, Stuffed, StuffedCRC, Full}
+}
+
+func Names() []string {
+	var names []string
+	for _, c := range Configs() {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// Parse finds a stack by its name or by the lab it reproduces, "lab1" to
+// "lab4".
+func Parse(name string) (Config, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, c := range Configs() {
+		if name == c.Name || name == fmt.Sprintf("lab%d", c.Lab) {
+			return c, nil
+		}
+	}
+	return Config{}, fmt.Errorf("unknown stack %q, expected one of %s", name, strings.Join(Names(), ", "))
+}
+
+// Stages names the pipeline stages of the stack from the top down. Noise,
+// compression and encryption only apply to frames, so the raw stack has
+// none of them. The compression and encryption stages are always there to
+// undo what arrives compressed or sealed; whether they compress and seal is
+// a pipeline option.
+func (c Config) Stages(noise bool) []string {
+	if !c.Stuffing {
+		return []string{"line"}
+	}
+	stages := []string{"deflate", "aead", "fcs-" + c.FCS.String()}
+	if noise {
+		stages = append(stages, "noise")
+	}
+	return append(stages, "stuffing")
+}
+
+// Describe lists the layers of the stack from the top down, without the
+// optional compression and encryption.
+func (c Config) Describe() string {
+	layers := c.Stages(false)
+	if c.Stuffing {
+		layers = layers[2:]
+	}
+	if c.MAC {
+		layers = append(layers, "mac")
+	}
+	return strings.Join(layers, ", ")
+}
@@ -0,0 +1,26 @@
+package stack
+
+import "testing"
+
+func TestParseAcceptsNamesAndLabs(t *testing.T) {
+	for name, want := range map[string]Config{
+		"raw":                Raw,
+		"lab2":               Stuffed,
+		"Stuffed+CRC":        StuffedCRC,
+		"stuffed+crc+csmacd": Full,
+		"lab4":               Full,
+	} {
+		got, err := Parse(name)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected %s for %q, got %s", want.Name, name, got.Name)
+		}
+	}
+
+	if _, err := Parse("lab5"); err == nil {
+		t.Error("Expected an error for an unknown stack")
+	}
+}
@@ -0,0 +1,446 @@
+package tokenring
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type TokenState int
+
+const (
+	TokenCirculating TokenState = iota
+	TokenHeld
+	TokenLost
+)
+
+type TokenRing struct {
+	mutex            sync.Mutex
+	stations         []byte
+	localAddress     byte
+	monitorAddress   byte
+	state            TokenState
+	holder           int
+	generation       int
+	lastSeen         time.Time
+	holdingTime      time.Duration
+	passDelay        time.Duration
+	tokenTimeout     time.Duration
+	lossProbability  float64
+	emulationEnabled bool
+	running          bool
+	waiting          int
+	arrivals         int
+	departures       int
+	lostTokens       int
+	grant            chan time.Time
+	release          chan struct{}
+	stop             chan struct{}
+	onTokenArrival   func(byte)
+	onTokenDeparture func(byte)
+	onTokenLost      func(byte)
+	onTokenPass      func(byte)
+}
+
+func NewTokenRing(localAddress byte) *TokenRing {
+	return &TokenRing{
+		stations:         []byte{0x01, 0x02, 0x03, 0x04},
+		localAddress:     localAddress,
+		monitorAddress:   0x01,
+		state:            TokenLost,
+		holdingTime:      500 * time.Millisecond,
+		passDelay:        200 * time.Millisecond,
+		tokenTimeout:     3 * time.Second,
+		lossProbability:  0.05,
+		emulationEnabled: true,
+		grant:            make(chan time.Time),
+		release:          make(chan struct{}, 1),
+		onTokenArrival:   func(byte) {},
+		onTokenDeparture: func(byte) {},
+		onTokenLost:      func(byte) {},
+		onTokenPass:      func(byte) {},
+	}
+}
+
+func (tr *TokenRing) SetEmulationEnabled(enabled bool) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.emulationEnabled = enabled
+}
+
+func (tr *TokenRing) SetStations(stations []byte) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.stations = append([]byte(nil), stations...)
+	tr.holder = 0
+}
+
+func (tr *TokenRing) SetLocalAddress(address byte) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.localAddress = address
+}
+
+func (tr *TokenRing) SetMonitorAddress(address byte) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.monitorAddress = address
+}
+
+func (tr *TokenRing) SetHoldingTime(d time.Duration) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.holdingTime = d
+}
+
+func (tr *TokenRing) SetPassDelay(d time.Duration) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.passDelay = d
+}
+
+func (tr *TokenRing) SetTokenTimeout(d time.Duration) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.tokenTimeout = d
+}
+
+func (tr *TokenRing) SetLossProbability(p float64) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.lossProbability = p
+}
+
+func (tr *TokenRing) SetCallbacks(onTokenArrival, onTokenDeparture, onTokenLost func(byte)) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.onTokenArrival = onTokenArrival
+	tr.onTokenDeparture = onTokenDeparture
+	tr.onTokenLost = onTokenLost
+}
+
+// SetTokenPasser is called with the next station address whenever the local
+// station hands the token on and emulation is disabled, so the owner can put
+// a token frame on the wire.
+func (tr *TokenRing) SetTokenPasser(onTokenPass func(byte)) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	tr.onTokenPass = onTokenPass
+}
+
+func (tr *TokenRing) GetLocalAddress() byte {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.localAddress
+}
+
+func (tr *TokenRing) GetState() TokenState {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.state
+}
+
+func (tr *TokenRing) GetHolder() (byte, bool) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	if tr.state == TokenLost || len(tr.stations) == 0 {
+		return 0, false
+	}
+	return tr.stations[tr.holder], true
+}
+
+func (tr *TokenRing) GetStatistics() (arrivals, departures, lostTokens int) {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.arrivals, tr.departures, tr.lostTokens
+}
+
+func (tr *TokenRing) Start() {
+	tr.mutex.Lock()
+	if tr.running {
+		tr.mutex.Unlock()
+		return
+	}
+	tr.running = true
+	tr.state = TokenLost
+	tr.generation++
+	tr.lastSeen = time.Now()
+	tr.stop = make(chan struct{})
+	stop := tr.stop
+	interval := tr.tokenTimeout / 4
+	tr.mutex.Unlock()
+
+	go tr.monitor(stop, interval)
+}
+
+func (tr *TokenRing) Stop() {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	if !tr.running {
+		return
+	}
+	tr.running = false
+	tr.generation++
+	tr.state = TokenLost
+	close(tr.stop)
+}
+
+func (tr *TokenRing) IsRunning() bool {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.running
+}
+
+// AcquireToken blocks until the token reaches the local station or the
+// timeout expires. On success it returns the moment by which the token must
+// be released; the ring takes the token back on its own after that.
+func (tr *TokenRing) AcquireToken(timeout time.Duration) (time.Time, bool) {
+	return tr.AcquireTokenContext(context.Background(), timeout)
+}
+
+// AcquireTokenContext is AcquireToken that also stops waiting when ctx is done.
+func (tr *TokenRing) AcquireTokenContext(ctx context.Context, timeout time.Duration) (time.Time, bool) {
+	tr.mutex.Lock()
+	if !tr.running {
+		tr.mutex.Unlock()
+		return time.Time{}, false
+	}
+	tr.waiting++
+	tr.mutex.Unlock()
+
+	defer func() {
+		tr.mutex.Lock()
+		tr.waiting--
+		tr.mutex.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case deadline := <-tr.grant:
+		return deadline, true
+	case <-timer.C:
+		return time.Time{}, false
+	case <-ctx.Done():
+		return time.Time{}, false
+	}
+}
+
+func (tr *TokenRing) ReleaseToken() {
+	select {
+	case tr.release <- struct{}{}:
+	default:
+	}
+}
+
+// IsHoldingToken reports whether the local station may still transmit.
+func (tr *TokenRing) IsHoldingToken() bool {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.state == TokenHeld
+}
+
+// ReceiveToken hands a token frame addressed to destination over to the ring.
+// It returns false when the token is meant for another station.
+func (tr *TokenRing) ReceiveToken(destination byte) bool {
+	tr.mutex.Lock()
+	if !tr.running || destination != tr.localAddress {
+		tr.mutex.Unlock()
+		return false
+	}
+	idx := tr.indexOf(destination)
+	generation := tr.generation
+	tr.mutex.Unlock()
+
+	if idx < 0 {
+		return false
+	}
+	go tr.tokenAt(idx, generation)
+	return true
+}
+
+func (tr *TokenRing) indexOf(address byte) int {
+	for i, station := range tr.stations {
+		if station == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tr *TokenRing) monitor(stop chan struct{}, interval time.Duration) {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tr.regenerate(false)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			tr.mutex.Lock()
+			expired := tr.state != TokenHeld && time.Since(tr.lastSeen) > tr.tokenTimeout
+			responsible := tr.emulationEnabled || tr.localAddress == tr.monitorAddress
+			tr.mutex.Unlock()
+
+			if expired && responsible {
+				tr.regenerate(true)
+			}
+		}
+	}
+}
+
+func (tr *TokenRing) regenerate(lost bool) {
+	tr.mutex.Lock()
+	responsible := tr.emulationEnabled || tr.localAddress == tr.monitorAddress
+	idx := tr.indexOf(tr.monitorAddress)
+	if !tr.running || !responsible || idx < 0 {
+		tr.mutex.Unlock()
+		return
+	}
+	if lost {
+		tr.lostTokens++
+	}
+	tr.generation++
+	generation := tr.generation
+	monitor := tr.monitorAddress
+	onTokenLost := tr.onTokenLost
+	tr.mutex.Unlock()
+
+	if lost {
+		onTokenLost(monitor)
+	}
+	go tr.tokenAt(idx, generation)
+}
+
+func (tr *TokenRing) tokenAt(idx int, generation int) {
+	tr.mutex.Lock()
+	if !tr.running || generation != tr.generation || idx >= len(tr.stations) {
+		tr.mutex.Unlock()
+		return
+	}
+	station := tr.stations[idx]
+	tr.holder = idx
+	tr.state = TokenCirculating
+	tr.lastSeen = time.Now()
+	tr.arrivals++
+	local := station == tr.localAddress
+	passDelay := tr.passDelay
+	onTokenArrival := tr.onTokenArrival
+	tr.mutex.Unlock()
+
+	onTokenArrival(station)
+
+	if local {
+		tr.holdLocal(generation)
+	} else {
+		time.Sleep(passDelay)
+	}
+
+	tr.pass(idx, generation)
+}
+
+func (tr *TokenRing) holdLocal(generation int) {
+	tr.mutex.Lock()
+	waiting := tr.waiting > 0
+	holdingTime := tr.holdingTime
+	passDelay := tr.passDelay
+	if waiting {
+		tr.state = TokenHeld
+	}
+	tr.mutex.Unlock()
+
+	if !waiting {
+		time.Sleep(passDelay)
+		return
+	}
+
+	select {
+	case <-tr.release:
+	default:
+	}
+
+	deadline := time.Now().Add(holdingTime)
+	select {
+	case tr.grant <- deadline:
+	case <-time.After(passDelay):
+		tr.mutex.Lock()
+		tr.state = TokenCirculating
+		tr.mutex.Unlock()
+		return
+	}
+
+	timer := time.NewTimer(holdingTime)
+	defer timer.Stop()
+	select {
+	case <-tr.release:
+	case <-timer.C:
+	}
+
+	tr.mutex.Lock()
+	if generation == tr.generation {
+		tr.state = TokenCirculating
+	}
+	tr.mutex.Unlock()
+}
+
+func (tr *TokenRing) pass(idx int, generation int) {
+	tr.mutex.Lock()
+	if !tr.running || generation != tr.generation {
+		tr.mutex.Unlock()
+		return
+	}
+	station := tr.stations[idx]
+	next := (idx + 1) % len(tr.stations)
+	nextStation := tr.stations[next]
+	tr.departures++
+	emulation := tr.emulationEnabled
+	lost := emulation && rand.Float64() < tr.lossProbability
+	if lost {
+		tr.state = TokenLost
+	}
+	onTokenDeparture, onTokenPass := tr.onTokenDeparture, tr.onTokenPass
+	tr.mutex.Unlock()
+
+	onTokenDeparture(station)
+
+	if lost {
+		return
+	}
+
+	if emulation {
+		go tr.tokenAt(next, generation)
+		return
+	}
+
+	tr.mutex.Lock()
+	tr.state = TokenCirculating
+	tr.mutex.Unlock()
+	onTokenPass(nextStation)
+}
+
+func (tr *TokenRing) GetStateString() string {
+	switch tr.GetState() {
+	case TokenCirculating:
+		return "Circulating"
+	case TokenHeld:
+		return "Held"
+	case TokenLost:
+		return "Lost"
+	default:
+		return "Unknown"
+	}
+}
+
+func (tr *TokenRing) GetStatisticsString() string {
+	arrivals, departures, lost := tr.GetStatistics()
+	return fmt.Sprintf("Token arrivals: %d | Departures: %d | Lost tokens: %d",
+		arrivals, departures, lost)
+}
@@ -0,0 +1,190 @@
+package tokenring
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newFastRing(local byte) *TokenRing {
+	tr := NewTokenRing(local)
+	tr.SetPassDelay(time.Millisecond)
+	tr.SetHoldingTime(50 * time.Millisecond)
+	tr.SetTokenTimeout(40 * time.Millisecond)
+	tr.SetLossProbability(0)
+	return tr
+}
+
+func TestTokenRingInitialization(t *testing.T) {
+	tr := NewTokenRing(0x02)
+
+	if tr.GetState() != TokenLost {
+		t.Errorf("Expected initial token state to be Lost, got %v", tr.GetState())
+	}
+
+	if tr.GetLocalAddress() != 0x02 {
+		t.Errorf("Expected local address 0x02, got 0x%02X", tr.GetLocalAddress())
+	}
+
+	if _, ok := tr.AcquireToken(10 * time.Millisecond); ok {
+		t.Error("Expected acquiring the token to fail while the ring is stopped")
+	}
+}
+
+func TestTokenAcquireAndRelease(t *testing.T) {
+	tr := newFastRing(0x03)
+	tr.Start()
+	defer tr.Stop()
+
+	deadline, ok := tr.AcquireToken(time.Second)
+	if !ok {
+		t.Fatal("Expected the token to reach the local station")
+	}
+
+	if !tr.IsHoldingToken() {
+		t.Error("Expected the local station to hold the token after acquiring it")
+	}
+
+	if time.Until(deadline) > 50*time.Millisecond {
+		t.Errorf("Expected holding deadline within the holding time, got %v", time.Until(deadline))
+	}
+
+	tr.ReleaseToken()
+	time.Sleep(10 * time.Millisecond)
+
+	if holder, _ := tr.GetHolder(); holder == 0x03 && tr.IsHoldingToken() {
+		t.Error("Expected the token to move on after release")
+	}
+}
+
+func TestAcquireTokenContextCancelled(t *testing.T) {
+	tr := newFastRing(0x03)
+	tr.SetPassDelay(time.Hour)
+	tr.SetTokenTimeout(time.Hour)
+	tr.Start()
+	defer tr.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, ok := tr.AcquireTokenContext(ctx, 10*time.Second); ok {
+		t.Fatal("Expected acquiring the token to fail once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to end with the context, took %v", elapsed)
+	}
+}
+
+func TestHoldingTimeEnforced(t *testing.T) {
+	tr := newFastRing(0x01)
+	tr.SetHoldingTime(20 * time.Millisecond)
+	tr.Start()
+	defer tr.Stop()
+
+	if _, ok := tr.AcquireToken(time.Second); !ok {
+		t.Fatal("Expected the token to reach the local station")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if tr.IsHoldingToken() {
+		t.Error("Expected the ring to take the token back after the holding time")
+	}
+}
+
+func TestLostTokenRecovery(t *testing.T) {
+	tr := newFastRing(0x02)
+	tr.SetLossProbability(1)
+
+	var mu sync.Mutex
+	var lostAt []byte
+	tr.SetCallbacks(func(byte) {}, func(byte) {}, func(monitor byte) {
+		mu.Lock()
+		lostAt = append(lostAt, monitor)
+		mu.Unlock()
+	})
+
+	tr.Start()
+	time.Sleep(150 * time.Millisecond)
+	tr.Stop()
+
+	_, _, lost := tr.GetStatistics()
+	if lost == 0 {
+		t.Fatal("Expected the monitor to detect and regenerate a lost token")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, monitor := range lostAt {
+		if monitor != 0x01 {
+			t.Errorf("Expected the token to be regenerated by monitor 0x01, got 0x%02X", monitor)
+		}
+	}
+}
+
+func TestTokenPassedOnWireWithoutEmulation(t *testing.T) {
+	tr := newFastRing(0x01)
+	tr.SetEmulationEnabled(false)
+	tr.SetStations([]byte{0x01, 0x02})
+
+	passed := make(chan byte, 1)
+	tr.SetTokenPasser(func(next byte) {
+		select {
+		case passed <- next:
+		default:
+		}
+	})
+
+	tr.Start()
+	defer tr.Stop()
+
+	select {
+	case next := <-passed:
+		if next != 0x02 {
+			t.Errorf("Expected the token to be passed to 0x02, got 0x%02X", next)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the monitor station to put a token on the wire")
+	}
+
+	if tr.ReceiveToken(0x02) {
+		t.Error("Expected a token addressed to another station to be ignored")
+	}
+	if !tr.ReceiveToken(0x01) {
+		t.Error("Expected a token addressed to the local station to be accepted")
+	}
+}
+
+func TestSetCallbacksWhileRunning(t *testing.T) {
+	tr := newFastRing(0x01)
+	tr.Start()
+	defer tr.Stop()
+
+	var mu sync.Mutex
+	arrivals := 0
+	for i := 0; i < 20; i++ {
+		tr.SetCallbacks(func(byte) {
+			mu.Lock()
+			arrivals++
+			mu.Unlock()
+		}, func(byte) {}, func(byte) {})
+		tr.SetTokenPasser(func(byte) {})
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if arrivals == 0 {
+		t.Error("Expected the new callbacks to see the token arrive")
+	}
+}
+
+func TestTokenStateString(t *testing.T) {
+	tr := NewTokenRing(0x01)
+
+	if tr.GetStateString() != "Lost" {
+		t.Errorf("Expected state string to be 'Lost', got '%s'", tr.GetStateString())
+	}
+}
@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyTab
+	keyBackTab
+	keyBackspace
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyCtrlC
+	keyUnknown
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// delta maps the arrow keys to -1/+1 for fields that cycle through values.
+func (k key) delta() int {
+	switch k.code {
+	case keyLeft:
+		return -1
+	case keyRight:
+		return 1
+	}
+	return 0
+}
+
+func (k key) activates() bool {
+	return k.code == keyEnter || (k.code == keyRune && k.r == ' ')
+}
+
+// parseKeys decodes raw terminal input. It returns the keys found and how
+// many bytes were consumed; an incomplete trailing sequence is left unread.
+func parseKeys(buf []byte) ([]key, int) {
+	var keys []key
+	i := 0
+	for i < len(buf) {
+		b := buf[i]
+		switch {
+		case b == 0x1B:
+			if i+1 >= len(buf) {
+				return keys, i
+			}
+			if buf[i+1] != '[' && buf[i+1] != 'O' {
+				keys = append(keys, key{code: keyUnknown})
+				i++
+				continue
+			}
+			if i+2 >= len(buf) {
+				return keys, i
+			}
+			switch buf[i+2] {
+			case 'A':
+				keys = append(keys, key{code: keyUp})
+			case 'B':
+				keys = append(keys, key{code: keyDown})
+			case 'C':
+				keys = append(keys, key{code: keyRight})
+			case 'D':
+				keys = append(keys, key{code: keyLeft})
+			case 'Z':
+				keys = append(keys, key{code: keyBackTab})
+			default:
+				keys = append(keys, key{code: keyUnknown})
+			}
+			i += 3
+		case b == '\r' || b == '\n':
+			keys = append(keys, key{code: keyEnter})
+			i++
+		case b == '\t':
+			keys = append(keys, key{code: keyTab})
+			i++
+		case b == 0x7F || b == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+			i++
+		case b == 0x03:
+			keys = append(keys, key{code: keyCtrlC})
+			i++
+		case b < 0x20:
+			keys = append(keys, key{code: keyUnknown})
+			i++
+		default:
+			if !utf8.FullRune(buf[i:]) {
+				return keys, i
+			}
+			r, size := utf8.DecodeRune(buf[i:])
+			keys = append(keys, key{code: keyRune, r: r})
+			i += size
+		}
+	}
+	return keys, i
+}
+
+func readKeys(in io.Reader, keys chan<- key, readErr chan<- error) {
+	reader := bufio.NewReader(in)
+	buf := make([]byte, 0, 64)
+	chunk := make([]byte, 64)
+	for {
+		n, err := reader.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		parsed, used := parseKeys(buf)
+		buf = append(buf[:0], buf[used:]...)
+		for _, k := range parsed {
+			keys <- k
+		}
+		if err != nil {
+			if err == io.EOF {
+				keys <- key{code: keyCtrlC}
+				return
+			}
+			readErr <- err
+			return
+		}
+	}
+}
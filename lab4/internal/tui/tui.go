@@ -0,0 +1,605 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/serialterminal"
+)
+
+const (
+	maxLogLines    = 200
+	refreshPeriod  = 100 * time.Millisecond
+	probabilityInc = 0.05
+)
+
+type fieldKind int
+
+const (
+	fieldPort fieldKind = iota
+	fieldDataBits
+	fieldOpen
+	fieldMAC
+	fieldDetection
+	fieldEmulation
+	fieldBusyProb
+	fieldCollisionProb
+	fieldInput
+)
+
+var fieldOrder = []fieldKind{
+	fieldPort, fieldDataBits, fieldOpen,
+	fieldMAC, fieldDetection, fieldEmulation, fieldBusyProb, fieldCollisionProb,
+	fieldInput,
+}
+
+// App is a text-mode front-end with the same panels as the Fyne TerminalUI,
+// driven entirely by the keyboard.
+type App struct {
+	terminal *serialterminal.SerialTerminal
+	in       io.Reader
+	out      io.Writer
+
+	mutex         sync.Mutex
+	width         int
+	height        int
+	focus         int
+	portName      []rune
+	input         []rune
+	dataBits      int
+	mac           serialterminal.MACMode
+	detection     csmacd.DetectionMode
+	emulation     bool
+	busyProb      float64
+	collisionProb float64
+	status        string
+	connected     bool
+	sent          []string
+	received      []string
+	eventLog      []string
+	frameInfo     []string
+	dirty         bool
+	quit          bool
+	sending       context.Context
+	// control runs the terminal calls keys ask for that publish events, such
+	// as Connect, one at a time and off the key handler, which holds mutex.
+	control chan func()
+}
+
+func New(term *serialterminal.SerialTerminal, in io.Reader, out io.Writer) *App {
+	busy, collision := term.GetCSMAProbabilities()
+	return &App{
+		terminal:      term,
+		in:            in,
+		out:           out,
+		width:         100,
+		height:        40,
+		portName:      []rune(term.GetPortName()),
+		dataBits:      term.GetDataBits(),
+		mac:           term.GetMACMode(),
+		detection:     term.GetCSMADetectionMode(),
+		emulation:     term.GetCSMAEmulation(),
+		busyProb:      busy,
+		collisionProb: collision,
+		status:        "Port closed",
+		connected:     term.IsConnected(),
+		frameInfo:     []string{"Frame structure will appear here after sending a message"},
+		focus:         len(fieldOrder) - 1,
+		dirty:         true,
+		control:       make(chan func(), 16),
+	}
+}
+
+// SetSize sets the screen size used for rendering.
+func (a *App) SetSize(width, height int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.width = width
+	a.height = height
+	a.dirty = true
+}
+
+func (a *App) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a.mutex.Lock()
+	a.sending = ctx
+	a.mutex.Unlock()
+
+	sub := a.terminal.Subscribe(1024)
+	defer sub.Close()
+
+	go func() {
+		for e := range sub.Events() {
+			a.handleEvent(e)
+		}
+	}()
+	controlDone := make(chan struct{})
+	go func() {
+		a.runControl(ctx)
+		close(controlDone)
+	}()
+	defer func() {
+		cancel()
+		<-controlDone
+	}()
+
+	keys := make(chan key, 64)
+	readErr := make(chan error, 1)
+	go readKeys(a.in, keys, readErr)
+
+	fmt.Fprint(a.out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(a.out, "\x1b[?25h\x1b[?1049l")
+
+	ticker := time.NewTicker(refreshPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case k := <-keys:
+			a.handleKey(k)
+		case <-ticker.C:
+		}
+
+		a.mutex.Lock()
+		quit := a.quit
+		dirty := a.dirty
+		a.dirty = false
+		var screen string
+		if dirty {
+			screen = a.render()
+		}
+		a.mutex.Unlock()
+
+		if dirty {
+			fmt.Fprint(a.out, screen)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+func (a *App) handleEvent(e events.Event) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	at := e.Timestamp().Format("15:04:05")
+	switch ev := e.(type) {
+	case events.FrameSent:
+		a.sent = appendLine(a.sent, ev.Data)
+		a.frameInfo = markdownLines(ev.Info)
+		a.logf(at, "Message sent after %d attempt(s): %s", ev.Attempts, ev.Data)
+	case events.FrameReceived:
+		a.received = appendLine(a.received, ev.Data)
+		a.logf(at, "Message received: %s", ev.Data)
+	case events.FrameCorrected:
+		a.received = appendLine(a.received, ev.Corrected)
+		a.logf(at, "Message received with corrected error: %s (was %s)", ev.Corrected, ev.Received)
+	case events.FrameDropped:
+		a.logf(at, "Frame dropped: %s", ev.Reason)
+	case events.FrameMalformed:
+		a.logf(at, "Malformed frame (%d bytes): %s", len(ev.Raw), ev.Reason)
+	case events.StrayBytes:
+		a.logf(at, "Discarded %d stray byte(s)", len(ev.Data))
+	case events.Collision:
+		a.logf(at, "Collision detected! (attempt %d)", ev.Attempt)
+	case events.ChannelBusy:
+		a.logf(at, "Channel busy detected")
+	case events.Backoff:
+		a.logf(at, "Backing off for %v (attempt %d)", ev.Delay, ev.Attempt)
+	case events.TokenArrived:
+		a.logf(at, "Token arrived at station 0x%02X", ev.Station)
+	case events.TokenDeparted:
+		a.logf(at, "Token left station 0x%02X", ev.Station)
+	case events.TokenLost:
+		a.logf(at, "Token lost, regenerated by monitor 0x%02X", ev.Monitor)
+	case events.FileReceived:
+		if ev.Err != nil {
+			a.logf(at, "File transfer from 0x%02X failed: %v", ev.Source, ev.Err)
+		} else {
+			a.logf(at, "File %s received from 0x%02X (%d bytes), use com-cli -save-dir to keep it", ev.Name, ev.Source, len(ev.Data))
+		}
+	case events.LinkStateChanged:
+		a.status = ev.Status
+		if ev.State != events.LinkError {
+			a.connected = ev.State == events.LinkUp
+		}
+		a.logf(at, "Link %s: %s", ev.State, ev.Status)
+	}
+	a.dirty = true
+}
+
+func (a *App) logf(at, format string, args ...interface{}) {
+	a.eventLog = appendLine(a.eventLog, "["+at+"] "+fmt.Sprintf(format, args...))
+}
+
+func appendLine(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > maxLogLines {
+		lines = lines[len(lines)-maxLogLines:]
+	}
+	return lines
+}
+
+func (a *App) handleKey(k key) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.dirty = true
+
+	switch k.code {
+	case keyCtrlC:
+		a.quit = true
+		return
+	case keyTab, keyDown:
+		a.focus = (a.focus + 1) % len(fieldOrder)
+		return
+	case keyBackTab, keyUp:
+		a.focus = (a.focus + len(fieldOrder) - 1) % len(fieldOrder)
+		return
+	}
+
+	switch fieldOrder[a.focus] {
+	case fieldPort:
+		a.portName = editRunes(a.portName, k)
+		if k.code == keyEnter {
+			a.terminal.SetPortName(string(a.portName))
+			a.logf(time.Now().Format("15:04:05"), "Port set to %s", string(a.portName))
+		}
+	case fieldDataBits:
+		if delta := k.delta(); delta != 0 {
+			a.dataBits = clampInt(a.dataBits+delta, 5, 8)
+			dataBits := a.dataBits
+			a.do(func() { a.terminal.SetDataBits(dataBits) })
+		}
+	case fieldOpen:
+		if k.activates() {
+			a.do(a.togglePort)
+		}
+	case fieldMAC:
+		if k.delta() != 0 || k.activates() {
+			if a.mac == serialterminal.MACCSMACD {
+				a.mac = serialterminal.MACTokenRing
+			} else {
+				a.mac = serialterminal.MACCSMACD
+			}
+			a.terminal.SetMACMode(a.mac)
+		}
+	case fieldDetection:
+		if k.delta() != 0 || k.activates() {
+			if a.detection == csmacd.DetectionEmulated {
+				a.detection = csmacd.DetectionEcho
+			} else {
+				a.detection = csmacd.DetectionEmulated
+			}
+			a.terminal.SetCSMADetectionMode(a.detection)
+		}
+	case fieldEmulation:
+		if k.activates() || k.delta() != 0 {
+			a.emulation = !a.emulation
+			a.terminal.SetCSMAEmulation(a.emulation)
+			a.terminal.SetTokenEmulation(a.emulation)
+		}
+	case fieldBusyProb:
+		if delta := k.delta(); delta != 0 {
+			a.busyProb = clampProbability(a.busyProb + float64(delta)*probabilityInc)
+			a.terminal.SetCSMAProbabilities(a.busyProb, a.collisionProb)
+		}
+	case fieldCollisionProb:
+		if delta := k.delta(); delta != 0 {
+			a.collisionProb = clampProbability(a.collisionProb + float64(delta)*probabilityInc)
+			a.terminal.SetCSMAProbabilities(a.busyProb, a.collisionProb)
+		}
+	case fieldInput:
+		if k.code == keyEnter {
+			msg := string(a.input)
+			a.input = nil
+			if msg != "" {
+				go a.send(a.sending, msg)
+			}
+			return
+		}
+		a.input = editRunes(a.input, k)
+	}
+}
+
+// do queues fn for the control goroutine. Keys pressed faster than it keeps
+// up are dropped rather than blocking the screen.
+func (a *App) do(fn func()) {
+	select {
+	case a.control <- fn:
+	default:
+		a.logf(time.Now().Format("15:04:05"), "Busy, key ignored")
+	}
+}
+
+func (a *App) runControl(ctx context.Context) {
+	for {
+		select {
+		case fn := <-a.control:
+			fn()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *App) togglePort() {
+	var err error
+	if a.terminal.IsConnected() {
+		err = a.terminal.Disconnect()
+	} else {
+		err = a.terminal.Connect()
+	}
+	if err != nil {
+		a.mutex.Lock()
+		a.status = err.Error()
+		a.logf(time.Now().Format("15:04:05"), "Error: %v", err)
+		a.dirty = true
+		a.mutex.Unlock()
+	}
+}
+
+func (a *App) send(ctx context.Context, msg string) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := a.terminal.SendMessageContext(ctx, msg); err != nil {
+		a.mutex.Lock()
+		a.logf(time.Now().Format("15:04:05"), "Message sending failed: %v", err)
+		a.dirty = true
+		a.mutex.Unlock()
+	}
+}
+
+func editRunes(buf []rune, k key) []rune {
+	switch k.code {
+	case keyRune:
+		return append(buf, k.r)
+	case keyBackspace:
+		if len(buf) > 0 {
+			return buf[:len(buf)-1]
+		}
+	}
+	return buf
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func clampProbability(p float64) float64 {
+	p = float64(int(p*100+0.5)) / 100
+	if p < 0 {
+		return 0
+	}
+	if p > 1 {
+		return 1
+	}
+	return p
+}
+
+// render draws the whole screen. The caller holds the mutex.
+func (a *App) render() string {
+	width := a.width
+	if width < 60 {
+		width = 60
+	}
+	height := a.height
+	if height < 30 {
+		height = 30
+	}
+	leftWidth := width * 2 / 5
+	rightWidth := width - leftWidth
+
+	var screen []string
+	screen = append(screen, padRight(" Serial Port Communicator — Status: "+a.status, width))
+
+	configLines := []string{
+		a.fieldLine(fieldPort, "Port:      ", string(a.portName)),
+		a.fieldLine(fieldDataBits, "Data bits: ", strconv.Itoa(a.dataBits)),
+		a.fieldLine(fieldOpen, "", a.openLabel()),
+	}
+	macName := "CSMA/CD"
+	if a.mac == serialterminal.MACTokenRing {
+		macName = "Token Ring"
+	}
+	detectionName := "Emulated"
+	if a.detection == csmacd.DetectionEcho {
+		detectionName = "Echo readback"
+	}
+	emulation := "off"
+	if a.emulation {
+		emulation = "on"
+	}
+	csmaLines := []string{
+		a.fieldLine(fieldMAC, "MAC:                   ", macName),
+		a.fieldLine(fieldDetection, "Collision detection:   ", detectionName),
+		a.fieldLine(fieldEmulation, "Emulation:             ", emulation),
+		a.fieldLine(fieldBusyProb, "Busy probability:      ", fmt.Sprintf("%.2f", a.busyProb)),
+		a.fieldLine(fieldCollisionProb, "Collision probability: ", fmt.Sprintf("%.2f", a.collisionProb)),
+	}
+	csmaLines = append(csmaLines, strings.Split(a.terminal.GetMetrics().String(), "\n")...)
+
+	top := hjoin(
+		box("Port Configuration", configLines, leftWidth, len(csmaLines)+2),
+		box("CSMA/CD Configuration", csmaLines, rightWidth, len(csmaLines)+2),
+	)
+	screen = append(screen, top...)
+
+	remaining := height - len(screen) - 5
+	logHeight := remaining / 3
+	paneHeight := remaining / 3
+	frameHeight := remaining - logHeight - paneHeight
+
+	screen = append(screen, box("CSMA/CD Event Log", tail(a.eventLog, logHeight-2), width, logHeight)...)
+	screen = append(screen, hjoin(
+		box("Sent Messages", tail(a.sent, paneHeight-2), width/2, paneHeight),
+		box("Received Messages", tail(a.received, paneHeight-2), width-width/2, paneHeight),
+	)...)
+	screen = append(screen, box("Transmitted Frame Structure", head(a.frameInfo, frameHeight-2), width, frameHeight)...)
+
+	inputLine := a.fieldLine(fieldInput, "Message to send: ", string(a.input)+"_")
+	screen = append(screen, box("Input", []string{inputLine}, width, 3)...)
+	screen = append(screen, padRight(" Tab/↑↓: move  ←/→: change  Enter: activate/send  Ctrl+C: quit", width))
+
+	for i, line := range screen {
+		screen[i] = strings.ReplaceAll(line, focusStart, "\x1b[7m")
+		screen[i] = strings.ReplaceAll(screen[i], focusEnd, "\x1b[0m")
+	}
+
+	return "\x1b[H\x1b[2J" + strings.Join(screen, "\r\n")
+}
+
+// Focus markers are zero-width private-use runes swapped for reverse video
+// after layout, so padding and truncation see only visible characters.
+const (
+	focusStart = "\ue000"
+	focusEnd   = "\ue001"
+)
+
+func (a *App) fieldLine(kind fieldKind, label, value string) string {
+	if fieldOrder[a.focus] == kind {
+		return label + focusStart + value + focusEnd
+	}
+	return label + value
+}
+
+func (a *App) openLabel() string {
+	if a.connected {
+		return "[ Close Port ]"
+	}
+	return "[ Open Port ]"
+}
+
+func tail(lines []string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func head(lines []string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	if len(lines) > n {
+		return lines[:n]
+	}
+	return lines
+}
+
+// markdownLines turns the transmission info markdown into plain text lines.
+func markdownLines(md string) []string {
+	var lines []string
+	for _, line := range strings.Split(md, "\n") {
+		if strings.HasPrefix(line, "```") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		line = strings.ReplaceAll(line, "**", "")
+		line = strings.ReplaceAll(line, "`", "")
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func visibleLen(s string) int {
+	n := 0
+	for _, r := range s {
+		if r != []rune(focusStart)[0] && r != []rune(focusEnd)[0] {
+			n++
+		}
+	}
+	return n
+}
+
+func padRight(s string, width int) string {
+	if visibleLen(s) > width {
+		return truncate(s, width)
+	}
+	return s + strings.Repeat(" ", width-visibleLen(s))
+}
+
+func truncate(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	focused := false
+	for _, r := range s {
+		marker := r == []rune(focusStart)[0] || r == []rune(focusEnd)[0]
+		if !marker && n == width {
+			break
+		}
+		if marker {
+			focused = r == []rune(focusStart)[0]
+		} else {
+			n++
+		}
+		b.WriteRune(r)
+	}
+	if focused {
+		b.WriteString(focusEnd)
+	}
+	return b.String()
+}
+
+func box(title string, lines []string, width, height int) []string {
+	if width < 4 || height < 2 {
+		return nil
+	}
+	inner := width - 2
+	titleText := "─ " + title + " "
+	if utf8.RuneCountInString(titleText) > inner {
+		titleText = string([]rune(titleText)[:inner])
+	}
+	out := []string{"┌" + titleText + strings.Repeat("─", inner-utf8.RuneCountInString(titleText)) + "┐"}
+	for i := 0; i < height-2; i++ {
+		line := ""
+		if i < len(lines) {
+			line = strings.ReplaceAll(lines[i], "\t", " ")
+		}
+		out = append(out, "│"+padRight(line, inner)+"│")
+	}
+	out = append(out, "└"+strings.Repeat("─", inner)+"┘")
+	return out
+}
+
+func hjoin(left, right []string) []string {
+	n := len(left)
+	if len(right) > n {
+		n = len(right)
+	}
+	out := make([]string, n)
+	for i := 0; i < n; i++ {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		out[i] = l + r
+	}
+	return out
+}
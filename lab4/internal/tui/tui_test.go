@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/serialterminal"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, used := parseKeys([]byte("a\t\x1b[Z\x1b[C\r\x7f\x03"))
+	expected := []keyCode{keyRune, keyTab, keyBackTab, keyRight, keyEnter, keyBackspace, keyCtrlC}
+
+	if used != 11 {
+		t.Errorf("Expected 11 bytes consumed, got %d", used)
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %d keys, got %d", len(expected), len(keys))
+	}
+	for i, code := range expected {
+		if keys[i].code != code {
+			t.Errorf("Expected key %d to be %d, got %d", i, code, keys[i].code)
+		}
+	}
+}
+
+func TestParseKeysKeepsIncompleteSequence(t *testing.T) {
+	keys, used := parseKeys([]byte("x\x1b["))
+	if len(keys) != 1 || used != 1 {
+		t.Errorf("Expected one key and the escape prefix left unread, got %d keys, %d bytes", len(keys), used)
+	}
+}
+
+func TestBoxKeepsWidthWithFocusMarkers(t *testing.T) {
+	lines := box("Title", []string{"label " + focusStart + "value" + focusEnd, strings.Repeat("x", 50)}, 20, 4)
+
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d", len(lines))
+	}
+	for i, line := range lines {
+		if visibleLen(line) != 20 {
+			t.Errorf("Expected line %d to be 20 columns wide, got %d: %q", i, visibleLen(line), line)
+		}
+	}
+}
+
+func TestNewShowsTerminalSettings(t *testing.T) {
+	terminal := serialterminal.New("loopback:tui-settings")
+	terminal.SetCSMAEmulation(false)
+	terminal.SetCSMADetectionMode(csmacd.DetectionEcho)
+
+	app := New(terminal, strings.NewReader(""), io.Discard)
+	if app.emulation || app.detection != csmacd.DetectionEcho {
+		t.Errorf("Expected emulation off and echo detection, got %v and %v", app.emulation, app.detection)
+	}
+}
+
+func TestTypingAndEnterSendsMessage(t *testing.T) {
+	name := "loopback:tui-" + t.Name()
+	sender := serialterminal.New(name)
+	receiver := serialterminal.New(name)
+	for _, term := range []*serialterminal.SerialTerminal{sender, receiver} {
+		term.SetCSMAEmulation(false)
+		term.SetNoiseEnabled(false)
+		if err := term.Connect(); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		defer term.Disconnect()
+	}
+
+	sub := receiver.Subscribe(16)
+	defer sub.Close()
+
+	in, keys := io.Pipe()
+	defer keys.Close()
+	var out bytes.Buffer
+	app := New(sender, in, &out)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	go app.Run(ctx)
+	go keys.Write([]byte("hello\r"))
+
+	for {
+		select {
+		case e := <-sub.Events():
+			if ev, ok := e.(events.FrameReceived); ok {
+				if ev.Data != "hello" {
+					t.Errorf("Expected hello, got %q", ev.Data)
+				}
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("Expected the typed message to be received")
+		}
+	}
+}
+
+func TestRepeatedOpenKeysRunInOrder(t *testing.T) {
+	term := serialterminal.New("loopback:tui-" + t.Name())
+	term.SetCSMAEmulation(false)
+	sub := term.Subscribe(16)
+	defer sub.Close()
+
+	in, keys := io.Pipe()
+	defer keys.Close()
+	var out bytes.Buffer
+	app := New(term, in, &out)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		app.Run(ctx)
+		close(done)
+	}()
+	go keys.Write([]byte(strings.Repeat("\x1b[A", 6) + "\r\r\r"))
+
+	want := []events.LinkState{events.LinkUp, events.LinkDown, events.LinkUp}
+	for i := 0; i < len(want); {
+		select {
+		case e := <-sub.Events():
+			if ev, ok := e.(events.LinkStateChanged); ok {
+				if ev.State != want[i] {
+					t.Fatalf("Expected link state %d to be %v, got %v", i, want[i], ev.State)
+				}
+				i++
+			}
+		case <-ctx.Done():
+			t.Fatal("Expected the port to open, close and open again")
+		}
+	}
+	cancel()
+	<-done
+	term.Disconnect()
+}
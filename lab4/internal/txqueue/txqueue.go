@@ -0,0 +1,279 @@
+package txqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type Priority int
+
+const (
+	PriorityControl Priority = iota
+	PriorityData
+	priorityCount
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityControl:
+		return "control"
+	case PriorityData:
+		return "data"
+	default:
+		return "unknown"
+	}
+}
+
+// Policy decides what Push does when the queue is full.
+type Policy int
+
+const (
+	PolicyBlock Policy = iota
+	PolicyDropOldest
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyBlock:
+		return "block"
+	case PolicyDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+const DefaultDepth = 32
+
+var (
+	ErrClosed = errors.New("transmit queue closed")
+	ErrFull   = errors.New("transmit queue full")
+)
+
+// Queue is a bounded FIFO per priority class. Pop always serves the most
+// urgent non-empty class first.
+type Queue[T any] struct {
+	mutex   sync.Mutex
+	classes [priorityCount][]T
+	depth   int
+	policy  Policy
+	closed  bool
+	dropped int
+	peak    int
+	changed chan struct{}
+	onDrop  func(T)
+}
+
+func New[T any](depth int, policy Policy) *Queue[T] {
+	if depth < 1 {
+		depth = DefaultDepth
+	}
+	return &Queue[T]{
+		depth:   depth,
+		policy:  policy,
+		changed: make(chan struct{}),
+	}
+}
+
+// SetOnDrop registers a callback for entries evicted by PolicyDropOldest.
+// It is called without the queue lock held.
+func (q *Queue[T]) SetOnDrop(onDrop func(T)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.onDrop = onDrop
+}
+
+func (q *Queue[T]) SetDepth(depth int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if depth < 1 {
+		depth = 1
+	}
+	q.depth = depth
+	q.notify()
+}
+
+func (q *Queue[T]) GetDepth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.depth
+}
+
+func (q *Queue[T]) SetPolicy(policy Policy) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.policy = policy
+	q.notify()
+}
+
+func (q *Queue[T]) GetPolicy() Policy {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.policy
+}
+
+// Push adds v to its priority class. When the queue is full it either waits
+// for room until ctx is done or evicts the oldest entry of the least urgent
+// class that is not more urgent than v.
+func (q *Queue[T]) Push(ctx context.Context, priority Priority, v T) error {
+	if priority < 0 || priority >= priorityCount {
+		priority = PriorityData
+	}
+
+	for {
+		q.mutex.Lock()
+		if q.closed {
+			q.mutex.Unlock()
+			return ErrClosed
+		}
+
+		if q.length() < q.depth {
+			q.classes[priority] = append(q.classes[priority], v)
+			if n := q.length(); n > q.peak {
+				q.peak = n
+			}
+			q.notify()
+			q.mutex.Unlock()
+			return nil
+		}
+
+		if q.policy == PolicyDropOldest {
+			evicted, ok := q.evict(priority)
+			if !ok {
+				q.mutex.Unlock()
+				return ErrFull
+			}
+			q.classes[priority] = append(q.classes[priority], v)
+			q.dropped++
+			q.notify()
+			onDrop := q.onDrop
+			q.mutex.Unlock()
+			if onDrop != nil {
+				onDrop(evicted)
+			}
+			return nil
+		}
+
+		changed := q.changed
+		q.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pop waits for the next entry until ctx is done or the queue is closed.
+func (q *Queue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		q.mutex.Lock()
+		for p := range q.classes {
+			if len(q.classes[p]) > 0 {
+				v := q.classes[p][0]
+				var zero T
+				q.classes[p][0] = zero
+				q.classes[p] = q.classes[p][1:]
+				q.notify()
+				q.mutex.Unlock()
+				return v, nil
+			}
+		}
+		if q.closed {
+			q.mutex.Unlock()
+			var zero T
+			return zero, ErrClosed
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Drain removes and returns everything still queued, most urgent first.
+func (q *Queue[T]) Drain() []T {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var drained []T
+	for p := range q.classes {
+		drained = append(drained, q.classes[p]...)
+		q.classes[p] = nil
+	}
+	q.notify()
+	return drained
+}
+
+// Close wakes every waiter; Push fails from now on while Pop still returns
+// what is left.
+func (q *Queue[T]) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.notify()
+}
+
+func (q *Queue[T]) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.length()
+}
+
+func (q *Queue[T]) LenByPriority(priority Priority) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if priority < 0 || priority >= priorityCount {
+		return 0
+	}
+	return len(q.classes[priority])
+}
+
+// GetStatistics returns the peak length and the number of evicted entries.
+func (q *Queue[T]) GetStatistics() (peak, dropped int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.peak, q.dropped
+}
+
+func (q *Queue[T]) ResetStatistics() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.peak = q.length()
+	q.dropped = 0
+}
+
+func (q *Queue[T]) length() int {
+	n := 0
+	for p := range q.classes {
+		n += len(q.classes[p])
+	}
+	return n
+}
+
+func (q *Queue[T]) evict(incoming Priority) (T, bool) {
+	for p := priorityCount - 1; p >= incoming; p-- {
+		if len(q.classes[p]) > 0 {
+			v := q.classes[p][0]
+			q.classes[p] = q.classes[p][1:]
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+func (q *Queue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
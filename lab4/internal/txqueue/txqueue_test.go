@@ -0,0 +1,113 @@
+package txqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestControlServedBeforeData(t *testing.T) {
+	q := New[string](4, PolicyBlock)
+	ctx := context.Background()
+
+	q.Push(ctx, PriorityData, "data-1")
+	q.Push(ctx, PriorityData, "data-2")
+	q.Push(ctx, PriorityControl, "control")
+
+	for _, want := range []string{"control", "data-1", "data-2"} {
+		got, err := q.Pop(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected pop error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestDropOldestEvictsLeastUrgent(t *testing.T) {
+	q := New[string](2, PolicyDropOldest)
+	var dropped []string
+	q.SetOnDrop(func(v string) { dropped = append(dropped, v) })
+	ctx := context.Background()
+
+	q.Push(ctx, PriorityControl, "control")
+	q.Push(ctx, PriorityData, "data-1")
+	if err := q.Push(ctx, PriorityData, "data-2"); err != nil {
+		t.Fatalf("Unexpected push error: %v", err)
+	}
+
+	if len(dropped) != 1 || dropped[0] != "data-1" {
+		t.Errorf("Expected data-1 to be dropped, got %v", dropped)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Expected queue length 2, got %d", q.Len())
+	}
+
+	q.Drain()
+	q.Push(ctx, PriorityControl, "control-1")
+	q.Push(ctx, PriorityControl, "control-2")
+	if err := q.Push(ctx, PriorityData, "data-3"); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected data not to evict control frames, got %v", err)
+	}
+
+	peak, drops := q.GetStatistics()
+	if peak != 2 || drops != 1 {
+		t.Errorf("Expected peak 2 and 1 drop, got peak %d and %d drops", peak, drops)
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	q := New[int](1, PolicyBlock)
+	q.Push(context.Background(), PriorityData, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Push(ctx, PriorityData, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected push to block until the deadline, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- q.Push(context.Background(), PriorityData, 3) }()
+
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := q.Pop(context.Background()); v != 1 {
+		t.Errorf("Expected 1, got %d", v)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected push error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the blocked push to complete once room was made")
+	}
+}
+
+func TestCloseWakesPop(t *testing.T) {
+	q := New[int](1, PolicyBlock)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := q.Pop(context.Background())
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to wake the waiting Pop")
+	}
+
+	if err := q.Push(context.Background(), PriorityData, 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected push after close to fail, got %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package ui
+
+import (
+	"image/color"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/packet"
+)
+
+const (
+	bitCellWidth  = 16
+	bitCellHeight = 20
+	bitByteGap    = 6
+	bitsPerRow    = 32
+)
+
+var (
+	fieldColors = map[packet.Field]color.Color{
+		packet.FieldFlag:    color.NRGBA{R: 0x78, G: 0x90, B: 0x9C, A: 0x60},
+		packet.FieldAddress: color.NRGBA{R: 0x1E, G: 0x88, B: 0xE5, A: 0x60},
+		packet.FieldControl: color.NRGBA{R: 0x8E, G: 0x24, B: 0xAA, A: 0x60},
+		packet.FieldData:    color.NRGBA{R: 0x43, G: 0xA0, B: 0x47, A: 0x60},
+		packet.FieldFCS:     color.NRGBA{R: 0xFB, G: 0x8C, B: 0x00, A: 0x60},
+		packet.FieldPadding: color.NRGBA{R: 0x9E, G: 0x9E, B: 0x9E, A: 0x30},
+	}
+	stuffedColor = color.NRGBA{R: 0xFD, G: 0xD8, B: 0x35, A: 0xFF}
+	flippedColor = color.NRGBA{R: 0xE5, G: 0x39, B: 0x35, A: 0xFF}
+)
+
+// bitGrid shows a FrameTrace one cell per bit, eight bits to a byte. Cells are
+// tinted by field; stuffed bits are yellow and flipped bits have a red frame.
+// Tapping a cell selects it and reports the bit to onSelect.
+type bitGrid struct {
+	widget.BaseWidget
+	mutex    sync.Mutex
+	title    string
+	trace    *packet.FrameTrace
+	selected int
+	onSelect func(trace *packet.FrameTrace, bit int)
+}
+
+func newBitGrid(title string, onSelect func(trace *packet.FrameTrace, bit int)) *bitGrid {
+	g := &bitGrid{title: title, selected: -1, onSelect: onSelect}
+	g.ExtendBaseWidget(g)
+	return g
+}
+
+func (g *bitGrid) SetTrace(title string, trace *packet.FrameTrace) {
+	g.mutex.Lock()
+	g.title = title
+	g.trace = trace
+	g.selected = -1
+	g.mutex.Unlock()
+	g.Refresh()
+}
+
+func (g *bitGrid) Tapped(e *fyne.PointEvent) {
+	g.mutex.Lock()
+	trace := g.trace
+	bit := -1
+	if trace != nil {
+		bit = bitAt(e.Position, len(trace.Bits))
+	}
+	g.selected = bit
+	g.mutex.Unlock()
+	g.Refresh()
+
+	if bit >= 0 && g.onSelect != nil {
+		g.onSelect(trace, bit)
+	}
+}
+
+func (g *bitGrid) CreateRenderer() fyne.WidgetRenderer {
+	return &bitGridRenderer{grid: g}
+}
+
+func bitGridTop() float32 {
+	return theme.CaptionTextSize() + chartPadding*2
+}
+
+func bitPosition(i int) fyne.Position {
+	column := i % bitsPerRow
+	row := i / bitsPerRow
+	x := chartPadding + float32(column)*bitCellWidth + float32(column/8)*bitByteGap
+	y := bitGridTop() + float32(row)*(bitCellHeight+2)
+	return fyne.NewPos(x, y)
+}
+
+func bitAt(pos fyne.Position, count int) int {
+	for i := 0; i < count; i++ {
+		p := bitPosition(i)
+		if pos.X >= p.X && pos.X < p.X+bitCellWidth && pos.Y >= p.Y && pos.Y < p.Y+bitCellHeight {
+			return i
+		}
+	}
+	return -1
+}
+
+type bitGridRenderer struct {
+	grid    *bitGrid
+	size    fyne.Size
+	objects []fyne.CanvasObject
+}
+
+func (r *bitGridRenderer) Layout(size fyne.Size) {
+	r.size = size
+	r.rebuild()
+}
+
+func (r *bitGridRenderer) MinSize() fyne.Size {
+	r.grid.mutex.Lock()
+	defer r.grid.mutex.Unlock()
+
+	rows := 2
+	if r.grid.trace != nil {
+		rows = (len(r.grid.trace.Bits) + bitsPerRow - 1) / bitsPerRow
+	}
+	width := float32(chartPadding*2 + bitsPerRow*bitCellWidth + (bitsPerRow/8-1)*bitByteGap)
+	return fyne.NewSize(width, bitGridTop()+float32(rows)*(bitCellHeight+2)+chartPadding)
+}
+
+func (r *bitGridRenderer) Refresh() {
+	r.rebuild()
+	canvas.Refresh(r.grid)
+}
+
+func (r *bitGridRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *bitGridRenderer) Destroy() {}
+
+func (r *bitGridRenderer) rebuild() {
+	g := r.grid
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	background.Resize(r.size)
+	title := canvas.NewText(g.title, theme.Color(theme.ColorNameForeground))
+	title.TextSize = theme.CaptionTextSize()
+	title.TextStyle = fyne.TextStyle{Bold: true}
+	title.Move(fyne.NewPos(chartPadding, 0))
+	objects := []fyne.CanvasObject{background, title}
+
+	if g.trace == nil {
+		r.objects = objects
+		return
+	}
+
+	foreground := theme.Color(theme.ColorNameForeground)
+	for i, bit := range g.trace.Bits {
+		pos := bitPosition(i)
+
+		fill := fieldColors[bit.Field]
+		if bit.Stuffed {
+			fill = stuffedColor
+		}
+		cell := canvas.NewRectangle(fill)
+		if bit.Flipped {
+			cell.StrokeColor = flippedColor
+			cell.StrokeWidth = 2
+		}
+		if i == g.selected {
+			cell.StrokeColor = foreground
+			cell.StrokeWidth = 2
+		}
+		cell.Move(pos)
+		cell.Resize(fyne.NewSize(bitCellWidth-1, bitCellHeight))
+		objects = append(objects, cell)
+
+		// A line at the start of every field marks the boundary.
+		if i > 0 && !bit.Stuffed && bit.Field != g.trace.Bits[i-1].Field {
+			boundary := canvas.NewLine(foreground)
+			boundary.StrokeWidth = 2
+			boundary.Position1 = fyne.NewPos(pos.X-1, pos.Y-1)
+			boundary.Position2 = fyne.NewPos(pos.X-1, pos.Y+bitCellHeight+1)
+			objects = append(objects, boundary)
+		}
+
+		textColor := foreground
+		if bit.Flipped {
+			textColor = flippedColor
+		}
+		text := canvas.NewText(string('0'+rune(bit.Value)), textColor)
+		text.TextStyle = fyne.TextStyle{Monospace: true, Bold: bit.Stuffed || bit.Flipped}
+		text.Alignment = fyne.TextAlignCenter
+		text.Move(pos)
+		text.Resize(fyne.NewSize(bitCellWidth-1, bitCellHeight))
+		objects = append(objects, text)
+	}
+
+	r.objects = objects
+}
+
+// bitLegend explains the grid colours once for both grids.
+func bitLegend() fyne.CanvasObject {
+	item := func(fill color.Color, stroke color.Color, label string) fyne.CanvasObject {
+		swatch := canvas.NewRectangle(fill)
+		if stroke != nil {
+			swatch.StrokeColor = stroke
+			swatch.StrokeWidth = 2
+		}
+		swatch.SetMinSize(fyne.NewSize(bitCellWidth, bitCellHeight))
+		text := canvas.NewText(label, theme.Color(theme.ColorNameForeground))
+		text.TextSize = theme.CaptionTextSize()
+		return container.NewHBox(swatch, text)
+	}
+
+	return container.NewHBox(
+		item(fieldColors[packet.FieldFlag], nil, "Flag"),
+		item(fieldColors[packet.FieldAddress], nil, "Address"),
+		item(fieldColors[packet.FieldControl], nil, "Control"),
+		item(fieldColors[packet.FieldData], nil, "Data"),
+		item(fieldColors[packet.FieldFCS], nil, "FCS"),
+		item(fieldColors[packet.FieldPadding], nil, "Padding"),
+		item(stuffedColor, nil, "Stuffed"),
+		item(color.Transparent, flippedColor, "Flipped"),
+	)
+}
@@ -0,0 +1,284 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const chartPadding = 4
+
+type chartSeries struct {
+	name    string
+	color   color.Color
+	buckets []float64
+}
+
+// timeSeriesChart plots event counts per time bucket for several series. The
+// newest bucket is on the right; Advance shifts the window by one bucket.
+type timeSeriesChart struct {
+	widget.BaseWidget
+	mutex  sync.Mutex
+	title  string
+	series []*chartSeries
+}
+
+func newTimeSeriesChart(title string, bucketCount int, names []string, colors []color.Color) *timeSeriesChart {
+	c := &timeSeriesChart{title: title}
+	for i, name := range names {
+		c.series = append(c.series, &chartSeries{
+			name:    name,
+			color:   colors[i%len(colors)],
+			buckets: make([]float64, bucketCount),
+		})
+	}
+	c.ExtendBaseWidget(c)
+	return c
+}
+
+func (c *timeSeriesChart) Add(name string) {
+	c.mutex.Lock()
+	for _, s := range c.series {
+		if s.name == name {
+			s.buckets[len(s.buckets)-1]++
+		}
+	}
+	c.mutex.Unlock()
+	c.Refresh()
+}
+
+func (c *timeSeriesChart) Advance() {
+	c.mutex.Lock()
+	for _, s := range c.series {
+		copy(s.buckets, s.buckets[1:])
+		s.buckets[len(s.buckets)-1] = 0
+	}
+	c.mutex.Unlock()
+	c.Refresh()
+}
+
+func (c *timeSeriesChart) Clear() {
+	c.mutex.Lock()
+	for _, s := range c.series {
+		for i := range s.buckets {
+			s.buckets[i] = 0
+		}
+	}
+	c.mutex.Unlock()
+	c.Refresh()
+}
+
+func (c *timeSeriesChart) CreateRenderer() fyne.WidgetRenderer {
+	return &timeSeriesRenderer{chart: c}
+}
+
+type timeSeriesRenderer struct {
+	chart   *timeSeriesChart
+	size    fyne.Size
+	objects []fyne.CanvasObject
+}
+
+func (r *timeSeriesRenderer) Layout(size fyne.Size) {
+	r.size = size
+	r.rebuild()
+}
+
+func (r *timeSeriesRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(220, 140)
+}
+
+func (r *timeSeriesRenderer) Refresh() {
+	r.rebuild()
+	canvas.Refresh(r.chart)
+}
+
+func (r *timeSeriesRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *timeSeriesRenderer) Destroy() {}
+
+func (r *timeSeriesRenderer) rebuild() {
+	c := r.chart
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	objects, plot := chartFrame(c.title, r.size)
+
+	maxValue := 1.0
+	for _, s := range c.series {
+		for _, v := range s.buckets {
+			if v > maxValue {
+				maxValue = v
+			}
+		}
+	}
+
+	for i, s := range c.series {
+		n := len(s.buckets)
+		if n < 2 {
+			continue
+		}
+		step := plot.Size.Width / float32(n-1)
+		for j := 1; j < n; j++ {
+			line := canvas.NewLine(s.color)
+			line.StrokeWidth = 2
+			line.Position1 = fyne.NewPos(plot.Pos.X+step*float32(j-1), plot.bottom()-plot.Size.Height*float32(s.buckets[j-1]/maxValue))
+			line.Position2 = fyne.NewPos(plot.Pos.X+step*float32(j), plot.bottom()-plot.Size.Height*float32(s.buckets[j]/maxValue))
+			objects = append(objects, line)
+		}
+
+		legend := canvas.NewText(fmt.Sprintf("%s: %.0f", s.name, s.buckets[n-1]), s.color)
+		legend.TextSize = theme.CaptionTextSize()
+		legend.Move(fyne.NewPos(plot.Pos.X+float32(i)*plot.Size.Width/float32(len(c.series)), r.size.Height-legend.MinSize().Height))
+		objects = append(objects, legend)
+	}
+
+	maxLabel := canvas.NewText(fmt.Sprintf("%.0f/s", maxValue), theme.Color(theme.ColorNameForeground))
+	maxLabel.TextSize = theme.CaptionTextSize()
+	maxLabel.Move(fyne.NewPos(plot.Pos.X+plot.Size.Width-maxLabel.MinSize().Width, plot.Pos.Y))
+	objects = append(objects, maxLabel)
+
+	r.objects = objects
+}
+
+// histogramChart shows how many samples fall into each labelled bin.
+type histogramChart struct {
+	widget.BaseWidget
+	mutex  sync.Mutex
+	title  string
+	labels []string
+	counts []int
+	color  color.Color
+}
+
+func newHistogramChart(title string, barColor color.Color) *histogramChart {
+	h := &histogramChart{title: title, color: barColor}
+	h.ExtendBaseWidget(h)
+	return h
+}
+
+func (h *histogramChart) SetBins(labels []string, counts []int) {
+	h.mutex.Lock()
+	h.labels = labels
+	h.counts = counts
+	h.mutex.Unlock()
+	h.Refresh()
+}
+
+func (h *histogramChart) CreateRenderer() fyne.WidgetRenderer {
+	return &histogramRenderer{chart: h}
+}
+
+type histogramRenderer struct {
+	chart   *histogramChart
+	size    fyne.Size
+	objects []fyne.CanvasObject
+}
+
+func (r *histogramRenderer) Layout(size fyne.Size) {
+	r.size = size
+	r.rebuild()
+}
+
+func (r *histogramRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(220, 140)
+}
+
+func (r *histogramRenderer) Refresh() {
+	r.rebuild()
+	canvas.Refresh(r.chart)
+}
+
+func (r *histogramRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *histogramRenderer) Destroy() {}
+
+func (r *histogramRenderer) rebuild() {
+	h := r.chart
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	objects, plot := chartFrame(h.title, r.size)
+
+	maxCount := 1
+	for _, count := range h.counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	if n := len(h.counts); n > 0 {
+		slot := plot.Size.Width / float32(n)
+		for i, count := range h.counts {
+			height := plot.Size.Height * float32(count) / float32(maxCount)
+			bar := canvas.NewRectangle(h.color)
+			bar.Move(fyne.NewPos(plot.Pos.X+slot*float32(i)+1, plot.bottom()-height))
+			bar.Resize(fyne.NewSize(slot-2, height))
+			objects = append(objects, bar)
+
+			label := canvas.NewText(h.labels[i], theme.Color(theme.ColorNameForeground))
+			label.TextSize = theme.CaptionTextSize() * 0.8
+			label.Move(fyne.NewPos(plot.Pos.X+slot*float32(i), plot.bottom()+2))
+			objects = append(objects, label)
+		}
+	}
+
+	maxLabel := canvas.NewText(fmt.Sprintf("max %d", maxCount), theme.Color(theme.ColorNameForeground))
+	maxLabel.TextSize = theme.CaptionTextSize()
+	maxLabel.Move(fyne.NewPos(plot.Pos.X+plot.Size.Width-maxLabel.MinSize().Width, plot.Pos.Y))
+	objects = append(objects, maxLabel)
+
+	r.objects = objects
+}
+
+type plotArea struct {
+	Pos  fyne.Position
+	Size fyne.Size
+}
+
+func (p plotArea) bottom() float32 {
+	return p.Pos.Y + p.Size.Height
+}
+
+// chartFrame draws the background, title and axes shared by both charts and
+// returns the area left for the data.
+func chartFrame(title string, size fyne.Size) ([]fyne.CanvasObject, plotArea) {
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	background.Resize(size)
+
+	titleText := canvas.NewText(title, theme.Color(theme.ColorNameForeground))
+	titleText.TextSize = theme.CaptionTextSize()
+	titleText.TextStyle = fyne.TextStyle{Bold: true}
+	titleText.Move(fyne.NewPos(chartPadding, 0))
+
+	top := titleText.MinSize().Height + chartPadding
+	legendHeight := theme.CaptionTextSize() + chartPadding*2
+	plot := plotArea{
+		Pos:  fyne.NewPos(chartPadding*2, top),
+		Size: fyne.NewSize(size.Width-chartPadding*4, size.Height-top-legendHeight),
+	}
+	if plot.Size.Height < 0 {
+		plot.Size.Height = 0
+	}
+	if plot.Size.Width < 0 {
+		plot.Size.Width = 0
+	}
+
+	axisColor := theme.Color(theme.ColorNameDisabled)
+	xAxis := canvas.NewLine(axisColor)
+	xAxis.Position1 = fyne.NewPos(plot.Pos.X, plot.bottom())
+	xAxis.Position2 = fyne.NewPos(plot.Pos.X+plot.Size.Width, plot.bottom())
+	yAxis := canvas.NewLine(axisColor)
+	yAxis.Position1 = plot.Pos
+	yAxis.Position2 = fyne.NewPos(plot.Pos.X, plot.bottom())
+
+	return []fyne.CanvasObject{background, titleText, xAxis, yAxis}, plot
+}
@@ -0,0 +1,206 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/bytefmt"
+	"oks/internal/events"
+)
+
+const maxDiagnostics = 500
+
+var diagnosticColumns = []struct {
+	title string
+	width float32
+}{
+	{"Time", 90},
+	{"Status", 90},
+	{"Addr", 50},
+	{"Received", 160},
+	{"Corrected", 160},
+	{"Bit", 50},
+	{"Raw (stuffed)", 260},
+}
+
+// frameDiagnostic is one row of the receive diagnostics table.
+type frameDiagnostic struct {
+	at        time.Time
+	status    string
+	address   string
+	received  string
+	corrected string
+	bit       int
+	raw       []byte
+	reason    string
+	steps     string
+}
+
+func (d frameDiagnostic) cell(column int) string {
+	switch column {
+	case 0:
+		return d.at.Format("15:04:05.000")
+	case 1:
+		return d.status
+	case 2:
+		return d.address
+	case 3:
+		return d.received
+	case 4:
+		return d.corrected
+	case 5:
+		if d.bit < 0 {
+			return ""
+		}
+		return strconv.Itoa(d.bit)
+	case 6:
+		return bytefmt.Format(d.raw, bytefmt.ModeHex)
+	}
+	return ""
+}
+
+// diagnosticsPanel lists every outcome of the receiver: good, corrected,
+// dropped and malformed frames and the stray bytes between them. It is only
+// touched from the Fyne goroutine.
+type diagnosticsPanel struct {
+	rows    []frameDiagnostic
+	table   *widget.Table
+	details *widget.Label
+	counts  *widget.Label
+}
+
+func newDiagnosticsPanel() *diagnosticsPanel {
+	d := &diagnosticsPanel{
+		details: widget.NewLabel("Select a row to see the raw bytes"),
+		counts:  widget.NewLabel(""),
+	}
+	d.details.Wrapping = fyne.TextWrapWord
+	d.details.TextStyle = fyne.TextStyle{Monospace: true}
+
+	d.table = widget.NewTableWithHeaders(
+		func() (int, int) { return len(d.rows), len(diagnosticColumns) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(d.rows[id.Row].cell(id.Col))
+		},
+	)
+	d.table.ShowHeaderColumn = false
+	d.table.CreateHeader = func() fyne.CanvasObject { return widget.NewLabel("") }
+	d.table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		if id.Row < 0 && id.Col >= 0 {
+			o.(*widget.Label).SetText(diagnosticColumns[id.Col].title)
+		}
+	}
+	for i, column := range diagnosticColumns {
+		d.table.SetColumnWidth(i, column.width)
+	}
+	d.table.OnSelected = func(id widget.TableCellID) {
+		if id.Row >= 0 && id.Row < len(d.rows) {
+			d.details.SetText(d.rows[id.Row].describe())
+		}
+	}
+	d.updateCounts()
+	return d
+}
+
+func (d frameDiagnostic) describe() string {
+	text := fmt.Sprintf("%s %s", d.at.Format("15:04:05.000"), d.status)
+	if d.address != "" {
+		text += " from " + d.address
+	}
+	if d.reason != "" {
+		text += ": " + d.reason
+	}
+	if d.received != "" {
+		text += fmt.Sprintf("\nreceived:  %s", d.received)
+	}
+	if d.corrected != "" {
+		text += fmt.Sprintf("\ncorrected: %s (data bit %d repaired)", d.corrected, d.bit)
+	}
+	if d.steps != "" {
+		text += "\n" + d.steps
+	}
+	return text + "\n" + bytefmt.Format(d.raw, bytefmt.ModeHexdump)
+}
+
+// Add records an event if it is a receive outcome and ignores anything else.
+func (d *diagnosticsPanel) Add(e events.Event) {
+	row := frameDiagnostic{at: e.Timestamp(), bit: -1}
+	switch ev := e.(type) {
+	case events.FrameReceived:
+		row.status = "ok"
+		row.address = fmt.Sprintf("0x%02X", ev.Address)
+		row.received = strconv.Quote(ev.Data)
+		row.raw = ev.Raw
+		row.steps = ev.Steps
+	case events.FrameCorrected:
+		row.status = "corrected"
+		row.address = fmt.Sprintf("0x%02X", ev.Address)
+		row.received = strconv.Quote(ev.Received)
+		row.corrected = strconv.Quote(ev.Corrected)
+		row.bit = ev.Bit
+		row.raw = ev.Raw
+		row.steps = ev.Steps
+	case events.FrameDropped:
+		row.status = "dropped"
+		row.address = fmt.Sprintf("0x%02X", ev.Address)
+		row.received = strconv.Quote(ev.Data)
+		row.reason = ev.Reason
+		row.raw = ev.Raw
+		row.steps = ev.Steps
+	case events.FrameMalformed:
+		row.status = "malformed"
+		row.reason = ev.Reason
+		row.raw = ev.Raw
+	case events.StrayBytes:
+		row.status = "stray bytes"
+		row.reason = fmt.Sprintf("%d byte(s) outside any frame", len(ev.Data))
+		row.raw = ev.Data
+	default:
+		return
+	}
+
+	d.rows = append(d.rows, row)
+	if len(d.rows) > maxDiagnostics {
+		d.rows = d.rows[len(d.rows)-maxDiagnostics:]
+	}
+	d.table.Refresh()
+	d.table.ScrollToBottom()
+	d.updateCounts()
+}
+
+func (d *diagnosticsPanel) Clear() {
+	d.rows = nil
+	d.table.UnselectAll()
+	d.table.Refresh()
+	d.details.SetText("Select a row to see the raw bytes")
+	d.updateCounts()
+}
+
+func (d *diagnosticsPanel) updateCounts() {
+	counts := map[string]int{}
+	for _, row := range d.rows {
+		counts[row.status]++
+	}
+	d.counts.SetText(fmt.Sprintf("ok: %d | corrected: %d | dropped: %d | malformed: %d | stray: %d",
+		counts["ok"], counts["corrected"], counts["dropped"], counts["malformed"], counts["stray bytes"]))
+}
+
+func (d *diagnosticsPanel) Content() fyne.CanvasObject {
+	detailsScroll := container.NewVScroll(d.details)
+	detailsScroll.SetMinSize(fyne.NewSize(100, 80))
+	return container.NewBorder(
+		container.NewBorder(nil, nil, nil, widget.NewButton("Clear", d.Clear), d.counts),
+		detailsScroll, nil, nil,
+		d.table,
+	)
+}
@@ -0,0 +1,248 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/bytefmt"
+	"oks/internal/events"
+	"oks/internal/history"
+)
+
+// historyPanes is how many past messages are put back into the sent and
+// received panes when a port's history is opened.
+const historyPanes = 200
+
+const allOption = "All"
+
+var historyColumns = []struct {
+	title string
+	width float32
+}{
+	{"Time", 160},
+	{"Direction", 80},
+	{"Status", 80},
+	{"Addr", 50},
+	{"Data", 240},
+	{"Note", 180},
+}
+
+// openHistory switches to the history file of this station on port and
+// fills the message panes with its latest messages.
+func (ui *TerminalUI) openHistory(port string) {
+	dir, err := history.DefaultDir()
+	if err != nil {
+		log.Printf("History disabled: %v", err)
+		return
+	}
+	path := history.PathFor(dir, port, ui.terminal.GetStationAddress())
+	if ui.history != nil && ui.history.GetPath() == path {
+		return
+	}
+	ui.closeHistory()
+
+	store, err := history.Open(path)
+	if err != nil {
+		log.Printf("History disabled: %v", err)
+		return
+	}
+	ui.history = store
+	ui.historyPort = port
+
+	ui.sentLog, ui.receivedLog = nil, nil
+	for _, e := range store.Entries() {
+		switch e.Status {
+		case history.StatusSent:
+			ui.sentLog = append(ui.sentLog, string(e.Data))
+		case history.StatusOK, history.StatusCorrected:
+			ui.receivedLog = append(ui.receivedLog, string(e.Data))
+		}
+	}
+	ui.sentLog = lastMessages(ui.sentLog)
+	ui.receivedLog = lastMessages(ui.receivedLog)
+	ui.renderMessages()
+}
+
+func lastMessages(messages []string) []string {
+	if len(messages) > historyPanes {
+		return messages[len(messages)-historyPanes:]
+	}
+	return messages
+}
+
+func (ui *TerminalUI) closeHistory() {
+	if ui.history == nil {
+		return
+	}
+	if err := ui.history.Close(); err != nil {
+		log.Printf("Failed to close history: %v", err)
+	}
+	ui.history = nil
+	ui.historyPort = ""
+}
+
+func (ui *TerminalUI) recordHistory(e events.Event) {
+	if ui.history == nil {
+		return
+	}
+	entry, ok := history.FromEvent(ui.historyPort, e)
+	if !ok {
+		return
+	}
+	if err := ui.history.Append(entry); err != nil {
+		log.Printf("Failed to record history: %v", err)
+	}
+}
+
+// showHistory opens the history browser with filters and exports for the
+// current port.
+func (ui *TerminalUI) showHistory() {
+	if ui.history == nil {
+		dialog.ShowInformation("History", "Open a port to see its message history.", ui.window)
+		return
+	}
+	store := ui.history
+
+	var shown []history.Entry
+	direction := widget.NewSelect([]string{allOption, history.DirectionSent, history.DirectionReceived}, nil)
+	status := widget.NewSelect([]string{allOption, history.StatusSent, history.StatusOK, history.StatusCorrected,
+		history.StatusDropped, history.StatusMalformed, history.StatusStray}, nil)
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search data, hex or notes")
+	summary := widget.NewLabel("")
+	details := widget.NewLabel("")
+	details.TextStyle = fyne.TextStyle{Monospace: true}
+	details.Wrapping = fyne.TextWrapWord
+
+	table := widget.NewTableWithHeaders(
+		func() (int, int) { return len(shown), len(historyColumns) },
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.TableCellID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(historyCell(shown[id.Row], id.Col))
+		},
+	)
+	table.ShowHeaderColumn = false
+	table.CreateHeader = func() fyne.CanvasObject { return widget.NewLabel("") }
+	table.UpdateHeader = func(id widget.TableCellID, o fyne.CanvasObject) {
+		if id.Row < 0 && id.Col >= 0 {
+			o.(*widget.Label).SetText(historyColumns[id.Col].title)
+		}
+	}
+	for i, column := range historyColumns {
+		table.SetColumnWidth(i, column.width)
+	}
+	table.OnSelected = func(id widget.TableCellID) {
+		if id.Row < 0 || id.Row >= len(shown) {
+			return
+		}
+		e := shown[id.Row]
+		text := fmt.Sprintf("%s %s %s\n%s", e.Time.Format("2006-01-02 15:04:05.000"), e.Direction, e.Status,
+			bytefmt.Format(e.Data, bytefmt.ModeHexdump))
+		if len(e.Raw) > 0 {
+			text += "\nraw:\n" + bytefmt.Format(e.Raw, bytefmt.ModeHexdump)
+		}
+		details.SetText(text)
+	}
+
+	filter := func() history.Filter {
+		f := history.Filter{Text: search.Text}
+		if direction.Selected != allOption {
+			f.Direction = direction.Selected
+		}
+		if status.Selected != allOption {
+			f.Status = status.Selected
+		}
+		return f
+	}
+	refresh := func() {
+		all := store.Entries()
+		shown = history.Search(all, filter())
+		summary.SetText(fmt.Sprintf("%d of %d messages", len(shown), len(all)))
+		table.UnselectAll()
+		table.Refresh()
+		details.SetText("")
+	}
+	direction.OnChanged = func(string) { refresh() }
+	status.OnChanged = func(string) { refresh() }
+	search.OnChanged = func(string) { refresh() }
+	direction.SetSelected(allOption)
+	status.SetSelected(allOption)
+
+	export := func(name string, write func(*bytes.Buffer, []history.Entry) error) {
+		var buf bytes.Buffer
+		if err := write(&buf, shown); err != nil {
+			ui.showErrorDialog("Export Failed", err.Error())
+			return
+		}
+		ui.saveData(name, buf.Bytes())
+	}
+	exportCSV := widget.NewButton("Export CSV...", func() {
+		export("history.csv", func(buf *bytes.Buffer, entries []history.Entry) error { return history.WriteCSV(buf, entries) })
+	})
+	exportJSON := widget.NewButton("Export JSON...", func() {
+		export("history.json", func(buf *bytes.Buffer, entries []history.Entry) error { return history.WriteJSON(buf, entries) })
+	})
+	clear := widget.NewButton("Clear History", func() {
+		dialog.ShowConfirm("Clear History", "Delete every message recorded for "+ui.historyPort+"?", func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := store.Clear(); err != nil {
+				ui.showErrorDialog("Clear Failed", err.Error())
+			}
+			refresh()
+		}, ui.window)
+	})
+
+	filters := container.NewBorder(nil, nil,
+		container.NewHBox(widget.NewLabel("Direction:"), direction, widget.NewLabel("Status:"), status),
+		nil, search)
+	buttons := container.NewBorder(nil, nil, summary, container.NewHBox(exportCSV, exportJSON, clear))
+	detailsScroll := container.NewVScroll(details)
+	detailsScroll.SetMinSize(fyne.NewSize(100, 120))
+
+	content := container.NewBorder(
+		container.NewVBox(widget.NewLabel("History of "+ui.historyPort+" ("+store.GetPath()+")"), filters),
+		container.NewVBox(detailsScroll, buttons),
+		nil, nil,
+		table,
+	)
+	d := dialog.NewCustom("Message History", "Close", content, ui.window)
+	d.Resize(fyne.NewSize(900, 600))
+	d.Show()
+}
+
+func historyCell(e history.Entry, column int) string {
+	switch column {
+	case 0:
+		return e.Time.Format("2006-01-02 15:04:05")
+	case 1:
+		return e.Direction
+	case 2:
+		return e.Status
+	case 3:
+		if e.Status == history.StatusMalformed || e.Status == history.StatusStray {
+			return ""
+		}
+		return fmt.Sprintf("0x%02X", e.Address)
+	case 4:
+		if len(e.Data) == 0 {
+			return bytefmt.Format(e.Raw, bytefmt.ModeHex)
+		}
+		return strconv.Quote(string(e.Data))
+	case 5:
+		return e.Note
+	}
+	return ""
+}
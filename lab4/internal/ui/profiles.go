@@ -0,0 +1,157 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/pipeline"
+	"oks/internal/profile"
+)
+
+// SetProfiles fills the profile switcher from a profiles file. Saving a
+// profile writes it back to path.
+func (ui *TerminalUI) SetProfiles(path string, f *profile.File) {
+	ui.profilesPath = path
+	ui.profiles = f
+	ui.profileSelect.SetOptions(f.Names())
+}
+
+// ApplyProfile configures the terminal from p and updates the settings
+// widgets to match.
+func (ui *TerminalUI) ApplyProfile(p profile.Profile) {
+	// A typed key belongs to the profile it was typed for, so it is cleared
+	// and the profile applies its own key file.
+	ui.pskEntry.SetText("")
+	ui.appliedPSK = ""
+	ui.pskEntry.SetPlaceHolder(pskPlaceHolder(p.PSKFile))
+	ui.keyError = p.Apply(ui.terminal)
+	if ui.keyError != nil {
+		ui.appendEventLog("Encryption: " + ui.keyError.Error())
+	}
+	ui.current = p
+
+	ui.portEntry.SetText(p.Transport.Port)
+	ui.byteSizeSelect.SetSelected(strconv.Itoa(p.Framing.DataBits))
+	ui.stackSelect.SetSelected(ui.terminal.GetStack().Name)
+	ui.busySlider.SetValue(p.MAC.BusyProbability)
+	ui.collisionSlider.SetValue(p.MAC.CollisionProbability)
+	ui.emulationCheckbox.SetChecked(p.MAC.Emulation)
+	ui.applyProbabilities()
+	if p.MAC.Strategy == "token" {
+		ui.macSelect.SetSelected("Token Ring")
+	} else {
+		ui.macSelect.SetSelected("CSMA/CD")
+	}
+	if p.MAC.Detection == "echo" {
+		ui.detectionSelect.SetSelected("Echo readback")
+	} else {
+		ui.detectionSelect.SetSelected("Emulated")
+	}
+	if p.Queue.Policy == "drop-oldest" {
+		ui.queuePolicy.SetSelected("Drop oldest")
+	} else {
+		ui.queuePolicy.SetSelected("Block")
+	}
+	ui.noiseCheckbox.SetChecked(p.Noise.Enabled)
+	ui.compressCheckbox.SetChecked(p.Compression == "deflate")
+
+	if p.Name != "" {
+		ui.profileSelect.SetSelected(p.Name)
+	}
+}
+
+func (ui *TerminalUI) selectProfile(name string) {
+	if ui.profiles == nil || name == ui.current.Name {
+		return
+	}
+	p, err := ui.profiles.Get(name)
+	if err != nil {
+		ui.showErrorDialog("Profile Not Found", err.Error())
+		return
+	}
+	if ui.terminal.IsConnected() {
+		ui.showErrorDialog("Port Is Open", "Close the port before switching to another profile.")
+		ui.profileSelect.SetSelected(ui.current.Name)
+		return
+	}
+	ui.ApplyProfile(p)
+	ui.appendEventLog("Profile " + name + " applied")
+}
+
+// currentProfile is the profile the settings widgets describe now. Settings
+// without a widget, such as the slot time, come from the last applied
+// profile. A typed key is never saved; profiles name a key file instead.
+func (ui *TerminalUI) currentProfile(name string) profile.Profile {
+	p := ui.current
+	p.Name = name
+	p.Transport.Port = ui.portEntry.Text
+	p.Stack = ui.stackSelect.Selected
+	p.FCS = ""
+	if bits, err := strconv.Atoi(ui.byteSizeSelect.Selected); err == nil {
+		p.Framing.DataBits = bits
+	}
+	parity, stopBits := ui.terminal.GetFraming()
+	p.Framing.Parity = string(parity)
+	p.Framing.StopBits = stopBits
+	p.Noise.Enabled = ui.noiseCheckbox.Checked
+	p.Compression = "none"
+	if ui.compressCheckbox.Checked {
+		p.Compression = "deflate"
+	}
+	p.MAC.Emulation = ui.emulationCheckbox.Checked
+	p.MAC.BusyProbability = ui.busySlider.Value
+	p.MAC.CollisionProbability = ui.collisionSlider.Value
+	p.MAC.Strategy = "csmacd"
+	if ui.macSelect.Selected == "Token Ring" {
+		p.MAC.Strategy = "token"
+	}
+	p.MAC.Detection = "emulated"
+	if ui.detectionSelect.Selected == "Echo readback" {
+		p.MAC.Detection = "echo"
+	}
+	p.Queue.Policy = "block"
+	if ui.queuePolicy.Selected == "Drop oldest" {
+		p.Queue.Policy = "drop-oldest"
+	}
+	return p
+}
+
+func (ui *TerminalUI) saveProfile() {
+	if ui.profiles == nil {
+		ui.profiles = &profile.File{}
+		ui.profilesPath = profile.DefaultPath()
+	}
+
+	name := widget.NewEntry()
+	name.SetText(ui.current.Name)
+	dialog.ShowForm("Save Profile", "Save", "Cancel",
+		[]*widget.FormItem{widget.NewFormItem("Name", name)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			p := ui.currentProfile(name.Text)
+			if err := ui.profiles.Put(p); err != nil {
+				ui.showErrorDialog("Invalid Profile", err.Error())
+				return
+			}
+			if err := ui.profiles.Save(ui.profilesPath); err != nil {
+				ui.showErrorDialog("Saving Profile Failed", err.Error())
+				return
+			}
+			ui.current = p
+			ui.profileSelect.SetOptions(ui.profiles.Names())
+			ui.profileSelect.SetSelected(p.Name)
+			ui.appendEventLog("Profile " + p.Name + " saved to " + ui.profilesPath)
+		}, ui.window)
+}
+
+func pskPlaceHolder(file string) string {
+	if file != "" {
+		return "from " + file
+	}
+	return fmt.Sprintf("none (at least %d characters)", pipeline.MinPSKLength)
+}
@@ -0,0 +1,232 @@
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/medium"
+)
+
+const (
+	stationWidth  = 170
+	stationHeight = 58
+	stationGap    = 16
+	groupHeight   = 120
+)
+
+var (
+	connectedColor    = color.NRGBA{R: 0x43, G: 0xA0, B: 0x47, A: 0x50}
+	disconnectedColor = color.NRGBA{R: 0x9E, G: 0x9E, B: 0x9E, A: 0x30}
+)
+
+// topologyStation is one terminal tab as the topology view shows it.
+type topologyStation struct {
+	name      string
+	port      string
+	address   byte
+	connected bool
+}
+
+// topologyGroup is a medium and the stations attached to it. A loopback
+// medium is a bus shared by every terminal that names it; a serial device is
+// a point-to-point link to whatever is on its other end.
+type topologyGroup struct {
+	title    string
+	detail   string
+	shared   bool
+	stations []topologyStation
+}
+
+// groupTopology groups stations by medium, in the order the media first
+// appear.
+func groupTopology(stations []topologyStation) []topologyGroup {
+	var groups []topologyGroup
+	index := map[string]int{}
+	for _, s := range stations {
+		key := s.port
+		if medium.IsLoopbackName(s.port) {
+			key = medium.Prefix + medium.NameFromPort(s.port)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			g := topologyGroup{title: "Serial device " + s.port, detail: "point-to-point link to the device on the other end"}
+			if medium.IsLoopbackName(s.port) {
+				g = topologyGroup{title: "Shared medium " + key, shared: true}
+			}
+			groups = append(groups, g)
+		}
+		groups[i].stations = append(groups[i].stations, s)
+	}
+
+	for i := range groups {
+		g := &groups[i]
+		if !g.shared {
+			continue
+		}
+		connected := 0
+		for _, s := range g.stations {
+			if s.connected {
+				connected++
+			}
+		}
+		g.detail = fmt.Sprintf("bus, %d of %d station(s) attached", connected, len(g.stations))
+		// Only ask for statistics of a medium that exists already, Shared
+		// would create it.
+		if connected > 0 {
+			delivered, collisions := medium.Shared(medium.NameFromPort(g.stations[0].port)).GetStatistics()
+			g.detail += fmt.Sprintf(", %d byte(s) delivered, %d collision(s)", delivered, collisions)
+		}
+	}
+	return groups
+}
+
+// topologyView draws every medium as a line with its stations hanging off
+// it. Open ports are green.
+type topologyView struct {
+	widget.BaseWidget
+	mutex  sync.Mutex
+	groups []topologyGroup
+}
+
+func newTopologyView() *topologyView {
+	v := &topologyView{}
+	v.ExtendBaseWidget(v)
+	return v
+}
+
+func (v *topologyView) SetStations(stations []topologyStation) {
+	groups := groupTopology(stations)
+	v.mutex.Lock()
+	v.groups = groups
+	v.mutex.Unlock()
+	v.Refresh()
+}
+
+func (v *topologyView) CreateRenderer() fyne.WidgetRenderer {
+	return &topologyRenderer{view: v}
+}
+
+type topologyRenderer struct {
+	view    *topologyView
+	size    fyne.Size
+	objects []fyne.CanvasObject
+}
+
+func (r *topologyRenderer) Layout(size fyne.Size) {
+	r.size = size
+	r.rebuild()
+}
+
+func (r *topologyRenderer) MinSize() fyne.Size {
+	r.view.mutex.Lock()
+	defer r.view.mutex.Unlock()
+
+	widest := 1
+	for _, g := range r.view.groups {
+		if len(g.stations) > widest {
+			widest = len(g.stations)
+		}
+	}
+	width := chartPadding*2 + stationGap + float32(widest)*(stationWidth+stationGap)
+	groups := len(r.view.groups)
+	if groups == 0 {
+		groups = 1
+	}
+	return fyne.NewSize(width, chartPadding*2+float32(groups)*groupHeight)
+}
+
+func (r *topologyRenderer) Refresh() {
+	r.rebuild()
+	canvas.Refresh(r.view)
+}
+
+func (r *topologyRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *topologyRenderer) Destroy() {}
+
+func (r *topologyRenderer) rebuild() {
+	v := r.view
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	foreground := theme.Color(theme.ColorNameForeground)
+	background := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	background.Resize(r.size)
+	objects := []fyne.CanvasObject{background}
+
+	if len(v.groups) == 0 {
+		empty := canvas.NewText("No terminals. Use Add Terminal to create one.", foreground)
+		empty.Move(fyne.NewPos(chartPadding, chartPadding))
+		r.objects = append(objects, empty)
+		return
+	}
+
+	for gi, g := range v.groups {
+		top := chartPadding + float32(gi)*groupHeight
+
+		title := canvas.NewText(g.title, foreground)
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		title.Move(fyne.NewPos(chartPadding, top))
+		detail := canvas.NewText(g.detail, foreground)
+		detail.TextSize = theme.CaptionTextSize()
+		detail.Move(fyne.NewPos(chartPadding, top+theme.TextSize()+2))
+		objects = append(objects, title, detail)
+
+		busY := top + theme.TextSize() + theme.CaptionTextSize() + chartPadding*3
+		busEnd := chartPadding + stationGap + float32(len(g.stations))*(stationWidth+stationGap)
+		bus := canvas.NewLine(foreground)
+		bus.StrokeWidth = 3
+		if !g.shared {
+			bus.StrokeWidth = 1
+		}
+		bus.Position1 = fyne.NewPos(chartPadding, busY)
+		bus.Position2 = fyne.NewPos(busEnd, busY)
+		objects = append(objects, bus)
+
+		for si, s := range g.stations {
+			x := chartPadding + stationGap + float32(si)*(stationWidth+stationGap)
+			y := busY + stationGap
+
+			drop := canvas.NewLine(foreground)
+			drop.Position1 = fyne.NewPos(x+stationWidth/2, busY)
+			drop.Position2 = fyne.NewPos(x+stationWidth/2, y)
+
+			fill := disconnectedColor
+			state := "closed"
+			if s.connected {
+				fill = connectedColor
+				state = "open"
+			}
+			box := canvas.NewRectangle(fill)
+			box.StrokeColor = foreground
+			box.StrokeWidth = 1
+			box.Move(fyne.NewPos(x, y))
+			box.Resize(fyne.NewSize(stationWidth, stationHeight))
+
+			name := canvas.NewText(s.name, foreground)
+			name.TextStyle = fyne.TextStyle{Bold: true}
+			name.Move(fyne.NewPos(x+chartPadding, y+chartPadding))
+			info := canvas.NewText(fmt.Sprintf("station 0x%02X, %s", s.address, state), foreground)
+			info.TextSize = theme.CaptionTextSize()
+			info.Move(fyne.NewPos(x+chartPadding, y+chartPadding+theme.TextSize()+2))
+			port := canvas.NewText(s.port, foreground)
+			port.TextSize = theme.CaptionTextSize()
+			port.TextStyle = fyne.TextStyle{Monospace: true}
+			port.Move(fyne.NewPos(x+chartPadding, y+chartPadding+theme.TextSize()+theme.CaptionTextSize()+4))
+
+			objects = append(objects, drop, box, name, info, port)
+		}
+	}
+
+	r.objects = objects
+}
@@ -1,7 +1,12 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image/color"
+	"io"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -11,7 +16,25 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
+	"oks/internal/bytefmt"
+	"oks/internal/capture"
+	"oks/internal/csmacd"
+	"oks/internal/events"
+	"oks/internal/filetransfer"
+	"oks/internal/history"
+	"oks/internal/packet"
+	"oks/internal/pipeline"
+	"oks/internal/profile"
 	"oks/internal/serialterminal"
+	"oks/internal/stack"
+	"oks/internal/txqueue"
+	"oks/internal/xmodem"
+)
+
+const (
+	seriesCollisions = "Collisions"
+	seriesBusy       = "Busy"
+	seriesSent       = "Sent"
 )
 
 type TerminalUI struct {
@@ -27,6 +50,68 @@ type TerminalUI struct {
 
 	eventLog          *widget.Entry
 	emulationCheckbox *widget.Check
+	macSelect         *widget.Select
+	stackSelect       *widget.Select
+	pskEntry          *widget.Entry
+	detectionSelect   *widget.Select
+	metricsLabel      *widget.Label
+	metricsWindow     *widget.Select
+	busySlider        *widget.Slider
+	collisionSlider   *widget.Slider
+	busyValue         *widget.Label
+	collisionValue    *widget.Label
+	activityChart     *timeSeriesChart
+	backoffChart      *histogramChart
+
+	sendButton   *widget.Button
+	cancelButton *widget.Button
+	sendProgress *widget.ProgressBarInfinite
+	sendStatus   *widget.Label
+	sendContext  context.Context
+	cancelSend   context.CancelFunc
+	pendingSends int
+	queuePolicy  *widget.Select
+
+	fileButton       *widget.Button
+	noiseCheckbox    *widget.Check
+	compressCheckbox *widget.Check
+	transferProgress *widget.ProgressBar
+	transferLabel    *widget.Label
+	protocolSelect   *widget.Select
+	receiveButton    *widget.Button
+
+	captureButton *widget.Button
+	capture       *capture.Writer
+
+	displayMode *widget.Select
+	inputMode   *widget.Select
+	sentLog     []string
+	receivedLog []string
+
+	sentBits     *bitGrid
+	receivedBits *bitGrid
+	bitDetails   *widget.Label
+	diagnostics  *diagnosticsPanel
+
+	history       *history.Store
+	historyPort   string
+	historyButton *widget.Button
+
+	profiles          *profile.File
+	profilesPath      string
+	current           profile.Profile
+	profileSelect     *widget.Select
+	saveProfileButton *widget.Button
+
+	// appliedPSK is the typed key the terminal last took, so Connect only
+	// starts a new session when the entry changed.
+	appliedPSK string
+	// keyError is the profile's unreadable key file. The port stays closed
+	// until a key is typed or another profile is applied.
+	keyError error
+
+	subscription *events.Subscription
+	done         chan struct{}
 
 	window fyne.Window
 }
@@ -44,6 +129,24 @@ func New(term *serialterminal.SerialTerminal, w fyne.Window) *TerminalUI {
 		byteSizeSelect:    widget.NewSelect([]string{"5", "6", "7", "8"}, nil),
 		eventLog:          widget.NewMultiLineEntry(),
 		emulationCheckbox: widget.NewCheck("Enable CSMA/CD Emulation", nil),
+		macSelect:         widget.NewSelect([]string{"CSMA/CD", "Token Ring"}, nil),
+		stackSelect:       widget.NewSelect(stack.Names(), nil),
+		pskEntry:          widget.NewPasswordEntry(),
+		detectionSelect:   widget.NewSelect([]string{"Emulated", "Echo readback"}, nil),
+		metricsLabel:      widget.NewLabel(""),
+		metricsWindow:     widget.NewSelect([]string{"All", "1 min", "5 min"}, nil),
+		busySlider:        widget.NewSlider(0, 1),
+		collisionSlider:   widget.NewSlider(0, 1),
+		busyValue:         widget.NewLabel(""),
+		collisionValue:    widget.NewLabel(""),
+		activityChart: newTimeSeriesChart("Channel activity (last 60 s)", 60,
+			[]string{seriesCollisions, seriesBusy, seriesSent},
+			[]color.Color{
+				color.NRGBA{R: 0xE5, G: 0x39, B: 0x35, A: 0xFF},
+				color.NRGBA{R: 0xFB, G: 0x8C, B: 0x00, A: 0xFF},
+				color.NRGBA{R: 0x43, G: 0xA0, B: 0x47, A: 0xFF},
+			}),
+		backoffChart: newHistogramChart("Backoff delay (slots)", color.NRGBA{R: 0x1E, G: 0x88, B: 0xE5, A: 0xFF}),
 	}
 
 	ui.sentMessages.Disable()
@@ -56,14 +159,16 @@ func New(term *serialterminal.SerialTerminal, w fyne.Window) *TerminalUI {
 
 	ui.sentPacketInfo.ParseMarkdown("Frame structure will appear here after sending a message")
 
+	ui.bitDetails = widget.NewLabel("Tap a bit to see where it came from")
+	ui.sentBits = newBitGrid("Last sent frame", ui.describeBit)
+	ui.receivedBits = newBitGrid("Last received frame", ui.describeBit)
+	ui.diagnostics = newDiagnosticsPanel()
+
 	ui.inputEntry.Disable()
 
-	ui.terminal.OnMessage = ui.handleMessage
-	ui.terminal.OnStatus = ui.handleStatus
-	ui.terminal.OnPacket = ui.handlePacket
-	ui.terminal.OnCollision = ui.handleCollision
-	ui.terminal.OnChannelBusy = ui.handleChannelBusy
-	ui.terminal.OnChannelState = ui.handleChannelState
+	ui.done = make(chan struct{})
+	ui.subscription = ui.terminal.Subscribe(256)
+	go ui.listen(ui.subscription)
 
 	ui.portEntry.SetText(ui.terminal.GetPortName())
 	ui.byteSizeSelect.SetSelected(strconv.Itoa(ui.terminal.GetDataBits()))
@@ -78,42 +183,303 @@ func New(term *serialterminal.SerialTerminal, w fyne.Window) *TerminalUI {
 		}
 	}
 
+	ui.stackSelect.SetSelected(ui.terminal.GetStack().Name)
+	ui.stackSelect.OnChanged = func(s string) {
+		if config, err := stack.Parse(s); err == nil {
+			ui.terminal.SetStack(config)
+			ui.appendEventLog("Protocol stack: " + config.Describe())
+		}
+	}
+
+	// Every new key forgets the replay counters, so the key is taken when
+	// it is submitted or the port is opened rather than on every keystroke.
+	ui.pskEntry.SetPlaceHolder(pskPlaceHolder(""))
+	ui.pskEntry.OnSubmitted = func(string) { ui.applyPSK() }
+
 	ui.emulationCheckbox.SetChecked(true)
 	ui.emulationCheckbox.OnChanged = func(checked bool) {
 		ui.terminal.SetCSMAEmulation(checked)
+		ui.terminal.SetTokenEmulation(checked)
 		if checked {
-			ui.terminal.SetCSMAProbabilities(0.25, 0.75)
+			ui.applyProbabilities()
+		}
+	}
+
+	busyProb, collisionProb := ui.terminal.GetCSMAProbabilities()
+	ui.busySlider.Step = 0.05
+	ui.busySlider.SetValue(busyProb)
+	ui.busySlider.OnChanged = func(float64) { ui.applyProbabilities() }
+	ui.collisionSlider.Step = 0.05
+	ui.collisionSlider.SetValue(collisionProb)
+	ui.collisionSlider.OnChanged = func(float64) { ui.applyProbabilities() }
+	ui.applyProbabilities()
+
+	go ui.runCharts()
+
+	ui.macSelect.SetSelected("CSMA/CD")
+	ui.macSelect.OnChanged = func(s string) {
+		if s == "Token Ring" {
+			ui.terminal.SetMACMode(serialterminal.MACTokenRing)
+		} else {
+			ui.terminal.SetMACMode(serialterminal.MACCSMACD)
 		}
+		ui.appendEventLog("MAC switched to " + s)
 	}
 
+	ui.detectionSelect.SetSelected("Emulated")
+	ui.detectionSelect.OnChanged = func(s string) {
+		if s == "Echo readback" {
+			ui.terminal.SetCSMADetectionMode(csmacd.DetectionEcho)
+		} else {
+			ui.terminal.SetCSMADetectionMode(csmacd.DetectionEmulated)
+		}
+		ui.appendEventLog("Collision detection switched to " + s)
+	}
+
+	ui.metricsWindow.SetSelected("All")
+	ui.metricsWindow.OnChanged = func(s string) {
+		switch s {
+		case "1 min":
+			ui.terminal.SetMetricsWindow(time.Minute)
+		case "5 min":
+			ui.terminal.SetMetricsWindow(5 * time.Minute)
+		default:
+			ui.terminal.SetMetricsWindow(0)
+		}
+		ui.refreshMetrics()
+	}
+	ui.refreshMetrics()
+
 	ui.eventLog.Disable()
 	ui.eventLog.SetMinRowsVisible(6)
 	ui.eventLog.Wrapping = fyne.TextWrapWord
 
 	ui.openButton = widget.NewButton("Open Port", ui.togglePort)
 
+	ui.sendButton = widget.NewButton("Send Message", ui.sendData)
+	ui.cancelButton = widget.NewButton("Cancel", ui.cancelSending)
+	ui.cancelButton.Disable()
+	ui.sendProgress = widget.NewProgressBarInfinite()
+	ui.sendProgress.Stop()
+	ui.sendProgress.Hide()
+	ui.sendStatus = widget.NewLabel("")
+	ui.inputEntry.OnSubmitted = func(string) { ui.sendData() }
+
+	ui.queuePolicy = widget.NewSelect([]string{"Block", "Drop oldest"}, func(s string) {
+		if s == "Drop oldest" {
+			ui.terminal.SetQueuePolicy(txqueue.PolicyDropOldest)
+		} else {
+			ui.terminal.SetQueuePolicy(txqueue.PolicyBlock)
+		}
+	})
+	ui.queuePolicy.SetSelected("Block")
+
+	ui.fileButton = widget.NewButton("Send File...", ui.chooseFile)
+	ui.noiseCheckbox = widget.NewCheck("Simulate bit errors", ui.terminal.SetNoiseEnabled)
+	ui.noiseCheckbox.SetChecked(true)
+	ui.compressCheckbox = widget.NewCheck("Compress payloads", ui.terminal.SetCompression)
+	ui.transferProgress = widget.NewProgressBar()
+	ui.transferProgress.Hide()
+	ui.transferLabel = widget.NewLabel("")
+	ui.protocolSelect = widget.NewSelect([]string{"Framed", "XMODEM", "XMODEM-CRC", "XMODEM-1K", "YMODEM"}, nil)
+	ui.protocolSelect.SetSelected("Framed")
+	ui.receiveButton = widget.NewButton("Receive File", ui.receiveRaw)
+	ui.captureButton = widget.NewButton("Start Capture...", ui.toggleCapture)
+	ui.historyButton = widget.NewButton("History...", ui.showHistory)
+
+	ui.current = profile.Default()
+	ui.current.Transport.Port = ui.terminal.GetPortName()
+	ui.profileSelect = widget.NewSelect(nil, ui.selectProfile)
+	ui.profileSelect.PlaceHolder = "(no profile)"
+	ui.saveProfileButton = widget.NewButton("Save Profile...", ui.saveProfile)
+
+	ui.displayMode = widget.NewSelect(bytefmt.ModeNames(), func(string) { ui.renderMessages() })
+	ui.displayMode.SetSelected(bytefmt.ModeText.String())
+	ui.inputMode = widget.NewSelect(bytefmt.InputModeNames(), func(name string) {
+		switch name {
+		case bytefmt.InputHex.String():
+			ui.inputEntry.SetPlaceHolder("0E 41 42 or 0x0e:0x41")
+		case bytefmt.InputEscaped.String():
+			ui.inputEntry.SetPlaceHolder(`text with \x0e, \n or \016`)
+		default:
+			ui.inputEntry.SetPlaceHolder("")
+		}
+	})
+	ui.inputMode.SetSelected(bytefmt.InputText.String())
+
 	return ui
 }
 
-func (ui *TerminalUI) handleCollision() {
-	ui.appendEventLogWithStats("Collision detected!")
+func (ui *TerminalUI) applyProbabilities() {
+	ui.busyValue.SetText(fmt.Sprintf("%.2f", ui.busySlider.Value))
+	ui.collisionValue.SetText(fmt.Sprintf("%.2f", ui.collisionSlider.Value))
+	ui.terminal.SetCSMAProbabilities(ui.busySlider.Value, ui.collisionSlider.Value)
+}
+
+func (ui *TerminalUI) runCharts() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fyne.Do(func() {
+				ui.activityChart.Advance()
+				ui.refreshBackoffChart()
+			})
+		case <-ui.done:
+			return
+		}
+	}
+}
+
+// Close stops the UI's background work and releases its port, capture and
+// history. The UI must not be used afterwards.
+func (ui *TerminalUI) Close() {
+	close(ui.done)
+	ui.subscription.Close()
+	if ui.terminal.IsConnected() {
+		if err := ui.terminal.Disconnect(); err != nil {
+			log.Printf("Failed to close %s: %v", ui.terminal.GetPortName(), err)
+		}
+	}
+	if ui.capture != nil {
+		ui.terminal.SetCapture(nil)
+		ui.capture.Close()
+		ui.capture = nil
+	}
+	ui.closeHistory()
+}
+
+func (ui *TerminalUI) GetTerminal() *serialterminal.SerialTerminal {
+	return ui.terminal
+}
+
+func (ui *TerminalUI) GetProfileName() string {
+	return ui.current.Name
+}
+
+// refreshBackoffChart bins backoff delays by slot count on a log2 scale, the
+// same way the backoff window grows.
+func (ui *TerminalUI) refreshBackoffChart() {
+	slotTime := ui.terminal.GetCSMASlotTime()
+	labels := []string{"0", "1"}
+	for k := 1; k < 10; k++ {
+		labels = append(labels, strconv.Itoa(1<<k)+"+")
+	}
+	counts := make([]int, len(labels))
+
+	for _, delay := range ui.terminal.GetBackoffSamples() {
+		slots := 0
+		if slotTime > 0 {
+			slots = int(delay / slotTime)
+		}
+		bin := 0
+		for slots > 0 && bin < len(counts)-1 {
+			slots >>= 1
+			bin++
+		}
+		counts[bin]++
+	}
+
+	ui.backoffChart.SetBins(labels, counts)
+}
+
+func (ui *TerminalUI) listen(sub *events.Subscription) {
+	for e := range sub.Events() {
+		fyne.Do(func() { ui.handleEvent(e) })
+	}
 }
 
-func (ui *TerminalUI) handleChannelBusy() {
-	ui.appendEventLogWithStats("Channel busy detected")
+func (ui *TerminalUI) handleEvent(e events.Event) {
+	at := e.Timestamp()
+	ui.diagnostics.Add(e)
+	ui.recordHistory(e)
+
+	switch ev := e.(type) {
+	case events.FrameSent:
+		ui.sentLog = lastMessages(append(ui.sentLog, ev.Data))
+		ui.renderMessages()
+		ui.sentPacketInfo.ParseMarkdown(ev.Info)
+		ui.showTrace(ui.sentBits, "Last sent frame", ev.Trace)
+		ui.activityChart.Add(seriesSent)
+		ui.appendEventLogWithStats(at, fmt.Sprintf("Message sent after %d attempt(s): %s", ev.Attempts, ev.Data))
+	case events.FrameReceived:
+		ui.receivedLog = lastMessages(append(ui.receivedLog, ev.Data))
+		ui.renderMessages()
+		ui.showTrace(ui.receivedBits, "Last received frame", ev.Trace)
+		ui.appendEventLogWithStats(at, "Message received: "+ev.Data)
+	case events.FrameCorrected:
+		ui.receivedLog = lastMessages(append(ui.receivedLog, ev.Corrected))
+		ui.renderMessages()
+		ui.showTrace(ui.receivedBits, "Last received frame (corrected)", ev.Trace)
+		ui.appendEventLogWithStats(at, fmt.Sprintf("Message received with corrected error: %s (was %s)", ev.Corrected, ev.Received))
+	case events.FrameDropped:
+		ui.showTrace(ui.receivedBits, "Last received frame (dropped)", ev.Trace)
+		ui.appendEventLogWithStats(at, fmt.Sprintf("Frame dropped: %s", ev.Reason))
+	case events.FrameMalformed:
+		ui.appendEventLog(fmt.Sprintf("[%s] Malformed frame (%d bytes): %s", at.Format("15:04:05"), len(ev.Raw), ev.Reason))
+	case events.StrayBytes:
+		ui.appendEventLog(fmt.Sprintf("[%s] Discarded %d stray byte(s)", at.Format("15:04:05"), len(ev.Data)))
+	case events.Collision:
+		ui.activityChart.Add(seriesCollisions)
+		ui.appendEventLogWithStats(at, fmt.Sprintf("Collision detected! (attempt %d)", ev.Attempt))
+		ui.showSendProgress(fmt.Sprintf("Collision, attempt %d", ev.Attempt))
+	case events.ChannelBusy:
+		ui.activityChart.Add(seriesBusy)
+		ui.appendEventLogWithStats(at, "Channel busy detected")
+		ui.showSendProgress("Channel busy, deferring...")
+	case events.Backoff:
+		ui.appendEventLogWithStats(at, fmt.Sprintf("Backing off for %v (attempt %d)", ev.Delay, ev.Attempt))
+		ui.showSendProgress(fmt.Sprintf("Backing off %v (attempt %d)", ev.Delay, ev.Attempt))
+	case events.TokenArrived:
+		ui.appendEventLogWithTokenStats(at, fmt.Sprintf("Token arrived at station 0x%02X", ev.Station))
+	case events.TokenDeparted:
+		ui.appendEventLogWithTokenStats(at, fmt.Sprintf("Token left station 0x%02X", ev.Station))
+	case events.TokenLost:
+		ui.appendEventLogWithTokenStats(at, fmt.Sprintf("Token lost, regenerated by monitor 0x%02X", ev.Monitor))
+	case events.TransferProgress:
+		ui.showTransfer(ev)
+	case events.FileReceived:
+		ui.receiveFile(ev)
+	case events.LinkStateChanged:
+		if ev.State == events.LinkUp {
+			ui.openHistory(ev.Port)
+		}
+		ui.handleStatus(ev.Status)
+	}
 }
 
-func (ui *TerminalUI) handleChannelState(state string) {
-	ui.appendEventLogWithStats("Channel state changed: " + state)
+// showTrace puts a frame into one of the inspector grids. Frames without a
+// trace, such as dropped frames with broken flags, leave the grid as it was.
+func (ui *TerminalUI) showTrace(grid *bitGrid, title string, trace *packet.FrameTrace) {
+	if trace == nil {
+		return
+	}
+	stuffed, flipped, padding := trace.Counts()
+	grid.SetTrace(fmt.Sprintf("%s: %d bits, %d stuffed, %d flipped, %d padding", title, len(trace.Bits), stuffed, flipped, padding), trace)
 }
 
-func (ui *TerminalUI) appendEventLogWithStats(entry string) {
-	timestamp := time.Now().Format("15:04:05")
+func (ui *TerminalUI) describeBit(trace *packet.FrameTrace, bit int) {
+	ui.bitDetails.SetText(trace.Describe(bit))
+}
+
+func (ui *TerminalUI) appendEventLogWithTokenStats(at time.Time, entry string) {
+	arrivals, departures, lost := ui.terminal.GetTokenStatistics()
+	text := fmt.Sprintf("[%s] %s | Arrivals=%d Departures=%d Lost=%d", at.Format("15:04:05"), entry, arrivals, departures, lost)
+	ui.appendEventLog(text)
+}
+
+func (ui *TerminalUI) appendEventLogWithStats(at time.Time, entry string) {
 	collisions, busy, total := ui.terminal.GetCSMAStatistics()
-	text := fmt.Sprintf("[%s] %s | Collisions=%d Busy=%d Total=%d", timestamp, entry, collisions, busy, total)
+	text := fmt.Sprintf("[%s] %s | Collisions=%d Busy=%d Total=%d", at.Format("15:04:05"), entry, collisions, busy, total)
 	ui.appendEventLog(text)
 }
 
+func (ui *TerminalUI) refreshMetrics() {
+	ui.metricsLabel.SetText(ui.terminal.GetMetrics().String())
+}
+
 func (ui *TerminalUI) appendEventLog(entry string) {
 	currentText := ui.eventLog.Text
 	if currentText != "" {
@@ -121,27 +487,7 @@ func (ui *TerminalUI) appendEventLog(entry string) {
 	}
 	ui.eventLog.SetText(currentText + entry)
 	ui.eventLog.CursorRow = len(strings.Split(ui.eventLog.Text, "\n"))
-}
-
-func (ui *TerminalUI) handleMessage(msg string) {
-	if len(msg) > 3 && msg[:3] == "TX:" {
-		message := msg[3:]
-		ui.sentMessages.SetText(ui.sentMessages.Text + "\n" + message)
-		ui.appendEventLogWithStats("Message sent: " + message)
-	} else if len(msg) > 3 && msg[:3] == "RX:" {
-		message := msg[3:]
-		ui.receivedMessages.SetText(ui.receivedMessages.Text + "\n" + message)
-		ui.appendEventLogWithStats("Message received: " + message)
-	} else {
-		ui.receivedMessages.SetText(ui.receivedMessages.Text + "\n" + msg)
-		ui.appendEventLogWithStats("Message received: " + msg)
-	}
-}
-
-func (ui *TerminalUI) handlePacket(packetInfo string) {
-	if ui.terminal.GetPortName() == ui.portEntry.Text {
-		ui.sentPacketInfo.ParseMarkdown(packetInfo)
-	}
+	ui.refreshMetrics()
 }
 
 func (ui *TerminalUI) handleStatus(status string) {
@@ -155,8 +501,32 @@ func (ui *TerminalUI) handleStatus(status string) {
 	}
 }
 
+// applyPSK gives the terminal the typed key if it changed since it was last
+// applied. A key too short to use turns encryption off.
+func (ui *TerminalUI) applyPSK() {
+	psk := ui.pskEntry.Text
+	if psk == ui.appliedPSK {
+		return
+	}
+	ui.appliedPSK = psk
+	if psk != "" && len(psk) < pipeline.MinPSKLength {
+		ui.appendEventLog(fmt.Sprintf("Encryption off: the key must be at least %d characters", pipeline.MinPSKLength))
+		psk = ""
+	}
+	if err := ui.terminal.SetPSK(psk); err != nil {
+		ui.appendEventLog("Encryption: " + err.Error())
+	} else if psk != "" {
+		ui.keyError = nil
+	}
+}
+
 func (ui *TerminalUI) togglePort() {
 	if !ui.terminal.IsConnected() {
+		ui.applyPSK()
+		if ui.keyError != nil {
+			ui.showErrorDialog("Key File Unreadable", ui.keyError.Error())
+			return
+		}
 		err := ui.terminal.Connect()
 		if err != nil {
 			ui.showErrorDialog("Port Opening Failed", err.Error())
@@ -169,17 +539,299 @@ func (ui *TerminalUI) togglePort() {
 	}
 }
 
+// sendData queues the message and waits for it in the background, so backoff
+// and token waits do not block the window. Cancel drops everything still
+// pending.
 func (ui *TerminalUI) sendData() {
-	msg := ui.inputEntry.Text
-	if msg == "" {
+	if ui.inputEntry.Text == "" {
 		return
 	}
+	mode, _ := bytefmt.ParseInputMode(ui.inputMode.Selected)
+	data, err := bytefmt.Parse(ui.inputEntry.Text, mode)
+	if err != nil {
+		ui.sendStatus.SetText(fmt.Sprintf("Invalid input: %v", err))
+		return
+	}
+	msg := string(data)
+
+	if ui.cancelSend == nil {
+		ui.sendContext, ui.cancelSend = context.WithCancel(context.Background())
+		ui.setSending(true)
+	}
+	ctx := ui.sendContext
 
-	err := ui.terminal.SendMessage(msg)
+	result, err := ui.terminal.EnqueueMessage(ctx, msg)
 	if err != nil {
+		ui.finishSend(msg, err)
+		return
+	}
+	ui.pendingSends++
+	ui.inputEntry.SetText("")
+	ui.sendStatus.SetText(fmt.Sprintf("Sending... (%d queued)", ui.terminal.GetQueueLength()))
+
+	go func() {
+		err := <-result
+		fyne.Do(func() {
+			ui.pendingSends--
+			ui.finishSend(msg, err)
+		})
+	}()
+}
+
+// renderMessages redraws both message panes in the selected display mode.
+func (ui *TerminalUI) renderMessages() {
+	mode, _ := bytefmt.ParseMode(ui.displayMode.Selected)
+	monospace := mode != bytefmt.ModeText
+	for _, pane := range []struct {
+		entry    *widget.Entry
+		messages []string
+	}{{ui.sentMessages, ui.sentLog}, {ui.receivedMessages, ui.receivedLog}} {
+		lines := make([]string, len(pane.messages))
+		for i, msg := range pane.messages {
+			lines[i] = bytefmt.Format([]byte(msg), mode)
+		}
+		pane.entry.TextStyle.Monospace = monospace
+		pane.entry.SetText(strings.Join(lines, "\n"))
+	}
+}
+
+// toggleCapture starts recording the port into a pcapng file chosen by the
+// user, or stops the running capture.
+func (ui *TerminalUI) toggleCapture() {
+	if ui.capture != nil {
+		ui.terminal.SetCapture(nil)
+		if err := ui.capture.Close(); err != nil {
+			ui.showErrorDialog("Capture Failed", err.Error())
+		}
+		ui.capture = nil
+		ui.captureButton.SetText("Start Capture...")
+		ui.appendEventLog("Capture stopped")
+		return
+	}
+
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			ui.showErrorDialog("Capture Failed", err.Error())
+			return
+		}
+		if writer == nil {
+			return
+		}
+
+		w, err := capture.NewWriter(writer, ui.terminal.GetPortName())
+		if err != nil {
+			writer.Close()
+			ui.showErrorDialog("Capture Failed", err.Error())
+			return
+		}
+		ui.capture = w
+		ui.terminal.SetCapture(w)
+		ui.captureButton.SetText("Stop Capture")
+		ui.appendEventLog(fmt.Sprintf("Capturing to %s", writer.URI().Name()))
+	}, ui.window)
+	save.SetFileName("capture.pcapng")
+	save.Show()
+}
+
+func (ui *TerminalUI) chooseFile() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			ui.showErrorDialog("File Opening Failed", err.Error())
+			return
+		}
+		if reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			ui.showErrorDialog("File Opening Failed", err.Error())
+			return
+		}
+		ui.sendFile(reader.URI().Name(), data)
+	}, ui.window)
+}
+
+func (ui *TerminalUI) sendFile(name string, data []byte) {
+	if ui.cancelSend == nil {
+		ui.sendContext, ui.cancelSend = context.WithCancel(context.Background())
+		ui.setSending(true)
+	}
+	ctx := ui.sendContext
+	ui.pendingSends++
+	protocol := ui.protocolSelect.Selected
+	ui.appendEventLog(fmt.Sprintf("Sending file %s (%d bytes) with %s", name, len(data), protocol))
+
+	go func() {
+		var err error
+		switch protocol {
+		case "Framed":
+			err = ui.terminal.SendFile(ctx, name, data, filetransfer.DefaultChunkSize)
+		case "YMODEM":
+			err = ui.terminal.RawSession(func(rw io.ReadWriter) error {
+				return xmodem.SendBatch(ctx, rw, []xmodem.File{{Name: name, Data: data}}, ui.xmodemOptions(protocol, true))
+			})
+		default:
+			err = ui.terminal.RawSession(func(rw io.ReadWriter) error {
+				return xmodem.Send(ctx, rw, data, ui.xmodemOptions(protocol, true))
+			})
+		}
+		fyne.Do(func() {
+			ui.pendingSends--
+			ui.finishSend(name, err)
+		})
+	}()
+}
+
+// receiveRaw waits for an XMODEM file or a YMODEM batch from a legacy
+// device. Framed transfers need no action, they are picked up on their own.
+func (ui *TerminalUI) receiveRaw() {
+	protocol := ui.protocolSelect.Selected
+	if protocol == "Framed" {
+		dialog.ShowInformation("Receive File", "Framed file transfers are received automatically.\nSelect XMODEM or YMODEM to receive from a legacy device.", ui.window)
+		return
+	}
+
+	if ui.cancelSend == nil {
+		ui.sendContext, ui.cancelSend = context.WithCancel(context.Background())
+		ui.setSending(true)
+	}
+	ctx := ui.sendContext
+	ui.pendingSends++
+	ui.appendEventLog(fmt.Sprintf("Waiting for a %s transfer...", protocol))
+
+	go func() {
+		var files []xmodem.File
+		err := ui.terminal.RawSession(func(rw io.ReadWriter) error {
+			if protocol == "YMODEM" {
+				received, err := xmodem.ReceiveBatch(ctx, rw, ui.xmodemOptions(protocol, false))
+				files = received
+				return err
+			}
+			data, err := xmodem.Receive(ctx, rw, ui.xmodemOptions(protocol, false))
+			if err == nil {
+				files = []xmodem.File{{Name: "received.bin", Data: data}}
+			}
+			return err
+		})
+		fyne.Do(func() {
+			ui.pendingSends--
+			ui.finishSend(protocol+" receive", err)
+			for _, f := range files {
+				ui.appendEventLog(fmt.Sprintf("File %s received with %s (%d bytes)", f.Name, protocol, len(f.Data)))
+				ui.saveData(f.Name, f.Data)
+			}
+		})
+	}()
+}
+
+func (ui *TerminalUI) xmodemOptions(protocol string, sending bool) xmodem.Options {
+	opts := xmodem.Options{Mode: xmodem.Mode1K}
+	switch protocol {
+	case "XMODEM":
+		opts.Mode = xmodem.ModeChecksum
+	case "XMODEM-CRC":
+		opts.Mode = xmodem.ModeCRC
+	}
+
+	started := time.Now()
+	opts.Progress = func(p xmodem.Progress) {
+		ev := events.TransferProgress{Stamp: events.Now(), Sending: sending, Name: p.Name, Done: p.Done, Total: p.Total}
+		if seconds := time.Since(started).Seconds(); seconds > 0 {
+			ev.Throughput = float64(p.Done) / seconds
+		}
+		if ev.Name == "" {
+			ev.Name = protocol
+		}
+		fyne.Do(func() { ui.showTransfer(ev) })
+	}
+	return opts
+}
+
+func (ui *TerminalUI) showTransfer(ev events.TransferProgress) {
+	verb := "Receiving"
+	if ev.Sending {
+		verb = "Sending"
+	}
+	ui.transferProgress.Show()
+	if ev.Total > 0 {
+		ui.transferProgress.SetValue(float64(ev.Done) / float64(ev.Total))
+	} else {
+		ui.transferProgress.SetValue(1)
+	}
+	ui.transferLabel.SetText(fmt.Sprintf("%s %s: %d/%d bytes, %.1f B/s", verb, ev.Name, ev.Done, ev.Total, ev.Throughput))
+}
+
+func (ui *TerminalUI) receiveFile(ev events.FileReceived) {
+	if ev.Err != nil {
+		ui.transferLabel.SetText(fmt.Sprintf("Transfer of %s failed", ev.Name))
+		ui.appendEventLog(fmt.Sprintf("File transfer from 0x%02X failed: %v", ev.Source, ev.Err))
+		ui.showErrorDialog("File Transfer Failed", ev.Err.Error())
+		return
+	}
+
+	ui.transferLabel.SetText(fmt.Sprintf("Received %s (%d bytes)", ev.Name, len(ev.Data)))
+	ui.appendEventLog(fmt.Sprintf("File %s received from 0x%02X, SHA-256 verified", ev.Name, ev.Source))
+	ui.saveData(ev.Name, ev.Data)
+}
+
+func (ui *TerminalUI) saveData(name string, data []byte) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			ui.showErrorDialog("File Saving Failed", err.Error())
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		if _, err := writer.Write(data); err != nil {
+			ui.showErrorDialog("File Saving Failed", err.Error())
+		}
+	}, ui.window)
+	save.SetFileName(name)
+	save.Show()
+}
+
+func (ui *TerminalUI) finishSend(msg string, err error) {
+	if ui.pendingSends == 0 && ui.cancelSend != nil {
+		ui.cancelSend()
+		ui.cancelSend = nil
+		ui.setSending(false)
+		ui.sendStatus.SetText("")
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		ui.sendStatus.SetText("Sending cancelled")
+		ui.appendEventLog("Sending cancelled: " + msg)
+	case err != nil:
 		ui.showErrorDialog("Message Sending Failed", err.Error())
+	}
+}
+
+func (ui *TerminalUI) cancelSending() {
+	if ui.cancelSend != nil {
+		ui.cancelSend()
+	}
+}
+
+func (ui *TerminalUI) setSending(sending bool) {
+	if sending {
+		ui.cancelButton.Enable()
+		ui.sendProgress.Show()
+		ui.sendProgress.Start()
 	} else {
-		ui.inputEntry.SetText("")
+		ui.cancelButton.Disable()
+		ui.sendProgress.Stop()
+		ui.sendProgress.Hide()
+	}
+}
+
+func (ui *TerminalUI) showSendProgress(text string) {
+	if ui.cancelSend != nil {
+		ui.sendStatus.SetText(text)
 	}
 }
 
@@ -188,32 +840,49 @@ func (ui *TerminalUI) showErrorDialog(title, message string) {
 }
 
 func (ui *TerminalUI) Layout() fyne.CanvasObject {
-	sendButton := widget.NewButton("Send Message", func() {
-		ui.sendData()
-	})
-
 	settingsGrid := container.NewGridWithColumns(2,
 		widget.NewLabel("Port:"),
 		ui.portEntry,
 		widget.NewLabel("Data Bits:"),
 		ui.byteSizeSelect,
+		widget.NewLabel("Stack:"),
+		ui.stackSelect,
+		widget.NewLabel("Pre-shared Key:"),
+		ui.pskEntry,
 	)
 	settingsBox := container.NewBorder(
-		widget.NewLabel("Port Configuration"),
+		container.NewBorder(nil, nil, widget.NewLabel("Port Configuration"), ui.saveProfileButton,
+			container.NewBorder(nil, nil, widget.NewLabel("Profile:"), nil, ui.profileSelect)),
 		nil, nil, nil,
 		settingsGrid,
 	)
 
 	csmaConfigBox := container.NewVBox(
 		widget.NewLabel("CSMA/CD Configuration"),
+		container.NewHBox(widget.NewLabel("MAC:"), ui.macSelect),
+		container.NewHBox(widget.NewLabel("Collision detection:"), ui.detectionSelect),
 		ui.emulationCheckbox,
+		container.NewBorder(nil, nil, widget.NewLabel("Busy probability:"), ui.busyValue, ui.busySlider),
+		container.NewBorder(nil, nil, widget.NewLabel("Collision probability:"), ui.collisionValue, ui.collisionSlider),
+		container.NewHBox(widget.NewLabel("Queue when full:"), ui.queuePolicy),
+		container.NewHBox(widget.NewLabel("Metrics window:"), ui.metricsWindow, widget.NewButton("Reset Metrics", func() {
+			ui.terminal.ResetMetrics()
+			ui.activityChart.Clear()
+			ui.refreshBackoffChart()
+			ui.refreshMetrics()
+		})),
+		ui.metricsLabel,
 	)
 
 	csmaLogScroll := container.NewScroll(ui.eventLog)
 	csmaLogScroll.SetMinSize(fyne.NewSize(100, 160))
-	csmaLogContainer := container.NewVBox(csmaLogScroll)
 
-	csmaPanel := container.NewHSplit(csmaConfigBox, csmaLogContainer)
+	csmaDashboard := container.NewAppTabs(
+		container.NewTabItem("Dashboard", container.NewGridWithColumns(2, ui.activityChart, ui.backoffChart)),
+		container.NewTabItem("Event Log", csmaLogScroll),
+	)
+
+	csmaPanel := container.NewHSplit(csmaConfigBox, csmaDashboard)
 	csmaPanel.SetOffset(0.3)
 
 	sentScroll := container.NewScroll(ui.sentMessages)
@@ -222,15 +891,16 @@ func (ui *TerminalUI) Layout() fyne.CanvasObject {
 	receivedScroll.SetMinSize(fyne.NewSize(100, 120))
 
 	messagesGroup := container.NewHSplit(
-		container.NewVBox(widget.NewLabel("Sent Messages"), sentScroll),
+		container.NewVBox(container.NewHBox(widget.NewLabel("Sent Messages"), widget.NewLabel("Show as:"), ui.displayMode), sentScroll),
 		container.NewVBox(widget.NewLabel("Received Messages"), receivedScroll),
 	)
 	messagesGroup.SetOffset(0.5)
 
 	messageInputPanel := container.NewVBox(
-		widget.NewLabel("Message to send:"),
+		container.NewBorder(nil, nil, widget.NewLabel("Message to send:"), container.NewHBox(widget.NewLabel("Input:"), ui.inputMode)),
 		ui.inputEntry,
-		sendButton,
+		container.NewBorder(nil, nil, container.NewHBox(ui.sendButton, ui.fileButton, ui.cancelButton), ui.sendStatus, ui.sendProgress),
+		container.NewBorder(nil, nil, container.NewHBox(ui.noiseCheckbox, ui.compressCheckbox, widget.NewLabel("File protocol:"), ui.protocolSelect, ui.receiveButton), ui.transferLabel, ui.transferProgress),
 	)
 
 	topBlock := container.NewVBox(
@@ -243,13 +913,21 @@ func (ui *TerminalUI) Layout() fyne.CanvasObject {
 	packetInfoScroll := container.NewScroll(ui.sentPacketInfo)
 	packetInfoScroll.SetMinSize(fyne.NewSize(100, 160))
 	packetInfoContainer := container.NewVBox(packetInfoScroll)
-	packetInfoGroup := container.NewVBox(
-		widget.NewLabel("Transmitted Frame Structure"),
-		packetInfoContainer,
+	inspectorScroll := container.NewScroll(container.NewVBox(
+		bitLegend(),
+		ui.sentBits,
+		ui.receivedBits,
+		ui.bitDetails,
+	))
+	inspectorScroll.SetMinSize(fyne.NewSize(100, 160))
+	packetInfoGroup := container.NewAppTabs(
+		container.NewTabItem("Transmitted Frame Structure", packetInfoContainer),
+		container.NewTabItem("Frame Inspector", inspectorScroll),
+		container.NewTabItem("Receive Diagnostics", ui.diagnostics.Content()),
 	)
 
 	topBar := container.NewHBox(
-		widget.NewLabel("Status:"), ui.statusLabel, ui.openButton,
+		widget.NewLabel("Status:"), ui.statusLabel, ui.openButton, ui.captureButton, ui.historyButton,
 	)
 
 	topArea := container.NewVBox(
@@ -0,0 +1,220 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"oks/internal/profile"
+	"oks/internal/serialterminal"
+)
+
+const defaultsOption = "(defaults)"
+
+// Workspace holds any number of terminal tabs next to a topology tab that
+// shows which terminals share a medium. Terminals are added and closed at
+// runtime, each with its own profile.
+type Workspace struct {
+	window       fyne.Window
+	profilesPath string
+	profiles     *profile.File
+
+	tabs        *container.DocTabs
+	topologyTab *container.TabItem
+	topology    *topologyView
+	terminals   map[*container.TabItem]*TerminalUI
+	count       int
+	done        chan struct{}
+}
+
+func NewWorkspace(w fyne.Window, profilesPath string, profiles *profile.File) *Workspace {
+	ws := &Workspace{
+		window:       w,
+		profilesPath: profilesPath,
+		profiles:     profiles,
+		topology:     newTopologyView(),
+		terminals:    map[*container.TabItem]*TerminalUI{},
+		done:         make(chan struct{}),
+	}
+
+	ws.topologyTab = container.NewTabItem("Topology", container.NewScroll(ws.topology))
+	ws.tabs = container.NewDocTabs(ws.topologyTab)
+	ws.tabs.CloseIntercept = ws.confirmClose
+	ws.tabs.OnClosed = ws.closed
+
+	go ws.runTopology()
+	return ws
+}
+
+// Add opens a terminal tab configured from p. Without a name the tab is
+// named after the profile, or numbered. A profile without a station address
+// joining a bus that already has terminals gets the lowest address free on
+// it, so stations on one bus can be told apart.
+func (ws *Workspace) Add(name string, p profile.Profile) *TerminalUI {
+	ws.count++
+	if p.Station.Address == nil {
+		if address, ok := ws.freeAddress(p.Transport.Port); ok {
+			p.Station.Address = &address
+		}
+	}
+	if name == "" {
+		name = p.Name
+	}
+	if name == "" {
+		name = fmt.Sprintf("Terminal %d", ws.count)
+	}
+
+	terminal := serialterminal.New(p.Transport.Port)
+	terminalUI := New(terminal, ws.window)
+	terminalUI.SetProfiles(ws.profilesPath, ws.profiles)
+	terminalUI.ApplyProfile(p)
+
+	tab := container.NewTabItem(name, terminalUI.Layout())
+	ws.terminals[tab] = terminalUI
+	ws.tabs.Append(tab)
+	ws.tabs.Select(tab)
+	ws.refreshTopology()
+	return terminalUI
+}
+
+// freeAddress returns the lowest station address no terminal on port uses,
+// or false when port has no terminals yet.
+func (ws *Workspace) freeAddress(port string) (int, bool) {
+	used := map[byte]bool{}
+	for _, terminalUI := range ws.terminals {
+		if t := terminalUI.GetTerminal(); t.GetPortName() == port {
+			used[t.GetStationAddress()] = true
+		}
+	}
+	if len(used) == 0 {
+		return 0, false
+	}
+	for address := 1; address < 0xFF; address++ {
+		if !used[byte(address)] {
+			return address, true
+		}
+	}
+	return 0, false
+}
+
+// showAdd asks for a name, a profile and a port and opens the terminal.
+func (ws *Workspace) showAdd() {
+	name := widget.NewEntry()
+	name.SetPlaceHolder(fmt.Sprintf("Terminal %d", ws.count+1))
+	port := widget.NewEntry()
+	port.SetText("loopback:bus")
+	profileSelect := widget.NewSelect(append([]string{defaultsOption}, ws.profiles.Names()...), func(s string) {
+		if p, err := ws.profiles.Get(s); err == nil {
+			port.SetText(p.Transport.Port)
+		}
+	})
+	profileSelect.SetSelected(defaultsOption)
+
+	dialog.ShowForm("Add Terminal", "Add", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Name", name),
+			widget.NewFormItem("Profile", profileSelect),
+			widget.NewFormItem("Port", port),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			p := profile.Default()
+			if chosen, err := ws.profiles.Get(profileSelect.Selected); err == nil {
+				p = chosen
+			}
+			p.Transport.Port = port.Text
+			if p.Transport.Port == "" {
+				ws.showError("Invalid Port", "The port name is empty.")
+				return
+			}
+			ws.Add(name.Text, p)
+		}, ws.window)
+}
+
+func (ws *Workspace) confirmClose(tab *container.TabItem) {
+	terminalUI, ok := ws.terminals[tab]
+	if !ok {
+		return
+	}
+	if !terminalUI.GetTerminal().IsConnected() {
+		ws.tabs.Remove(tab)
+		ws.closed(tab)
+		return
+	}
+	dialog.ShowConfirm("Close Terminal", "Close "+tab.Text+" and its port "+terminalUI.GetTerminal().GetPortName()+"?",
+		func(ok bool) {
+			if ok {
+				ws.tabs.Remove(tab)
+				ws.closed(tab)
+			}
+		}, ws.window)
+}
+
+func (ws *Workspace) closed(tab *container.TabItem) {
+	terminalUI, ok := ws.terminals[tab]
+	if !ok {
+		return
+	}
+	delete(ws.terminals, tab)
+	terminalUI.Close()
+	ws.refreshTopology()
+}
+
+func (ws *Workspace) showError(title, message string) {
+	dialog.ShowCustom(title, "OK", widget.NewLabel(message), ws.window)
+}
+
+// runTopology keeps the topology current as ports open and close.
+func (ws *Workspace) runTopology() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fyne.Do(ws.refreshTopology)
+		case <-ws.done:
+			return
+		}
+	}
+}
+
+func (ws *Workspace) refreshTopology() {
+	var stations []topologyStation
+	for _, tab := range ws.tabs.Items {
+		terminalUI, ok := ws.terminals[tab]
+		if !ok {
+			continue
+		}
+		terminal := terminalUI.GetTerminal()
+		stations = append(stations, topologyStation{
+			name:      tab.Text,
+			port:      terminal.GetPortName(),
+			address:   terminal.GetStationAddress(),
+			connected: terminal.IsConnected(),
+		})
+	}
+	ws.topology.SetStations(stations)
+}
+
+func (ws *Workspace) Content() fyne.CanvasObject {
+	toolbar := container.NewHBox(
+		widget.NewButton("Add Terminal...", ws.showAdd),
+	)
+	return container.NewBorder(toolbar, nil, nil, nil, ws.tabs)
+}
+
+// Close closes every terminal.
+func (ws *Workspace) Close() {
+	close(ws.done)
+	for tab, terminalUI := range ws.terminals {
+		delete(ws.terminals, tab)
+		terminalUI.Close()
+	}
+}
@@ -0,0 +1,515 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	SOH byte = 0x01
+	STX byte = 0x02
+	EOT byte = 0x04
+	ACK byte = 0x06
+	NAK byte = 0x15
+	CAN byte = 0x18
+	SUB byte = 0x1A
+	CRC byte = 'C'
+)
+
+const (
+	DefaultTimeout = 3 * time.Second
+	DefaultRetries = 10
+	startRetries   = 20
+)
+
+// Mode selects the block and check format the sender offers. The receiver
+// asks for CRC with 'C' and for the original checksum with NAK.
+type Mode int
+
+const (
+	ModeChecksum Mode = iota
+	ModeCRC
+	Mode1K
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeChecksum:
+		return "XMODEM"
+	case ModeCRC:
+		return "XMODEM-CRC"
+	case Mode1K:
+		return "XMODEM-1K"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	ErrCancelled    = errors.New("transfer cancelled by remote")
+	ErrTooManyTries = errors.New("too many retries")
+	ErrSequence     = errors.New("block sequence error")
+	errTimeout      = errors.New("timeout")
+)
+
+type Progress struct {
+	Name  string
+	Done  int64
+	Total int64
+}
+
+type Options struct {
+	Mode     Mode
+	Timeout  time.Duration
+	Retries  int
+	Progress func(Progress)
+}
+
+func (o Options) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
+
+func (o Options) retries() int {
+	if o.Retries <= 0 {
+		return DefaultRetries
+	}
+	return o.Retries
+}
+
+func (o Options) report(name string, done, total int64) {
+	if o.Progress != nil {
+		o.Progress(Progress{Name: name, Done: done, Total: total})
+	}
+}
+
+// CRC16 is the CRC-16/XMODEM (polynomial 0x1021, initial value 0).
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+// link reads the port on its own goroutine so every protocol read can time
+// out, whatever the port does when no data arrives.
+type link struct {
+	rw     io.ReadWriter
+	data   chan byte
+	errs   chan error
+	stop   chan struct{}
+	closed sync.Once
+}
+
+func newLink(rw io.ReadWriter) *link {
+	l := &link{rw: rw, data: make(chan byte, 4096), errs: make(chan error, 1), stop: make(chan struct{})}
+	go l.pump()
+	return l
+}
+
+func (l *link) pump() {
+	buf := make([]byte, 1024)
+	for {
+		n, err := l.rw.Read(buf)
+		for _, b := range buf[:n] {
+			select {
+			case l.data <- b:
+			case <-l.stop:
+				return
+			}
+		}
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+		if err == io.EOF {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			l.errs <- err
+			return
+		}
+	}
+}
+
+func (l *link) close() {
+	l.closed.Do(func() { close(l.stop) })
+}
+
+func (l *link) write(b []byte) error {
+	_, err := l.rw.Write(b)
+	return err
+}
+
+func (l *link) readByte(ctx context.Context, timeout time.Duration) (byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case b := <-l.data:
+		return b, nil
+	case err := <-l.errs:
+		return 0, err
+	case <-timer.C:
+		return 0, errTimeout
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (l *link) readFull(ctx context.Context, buf []byte, timeout time.Duration) error {
+	for i := range buf {
+		b, err := l.readByte(ctx, timeout)
+		if err != nil {
+			return err
+		}
+		buf[i] = b
+	}
+	return nil
+}
+
+// purge discards input until the line has been quiet for a moment, so the
+// next read starts at a block boundary.
+func (l *link) purge(ctx context.Context) {
+	for {
+		if _, err := l.readByte(ctx, 200*time.Millisecond); err != nil {
+			return
+		}
+	}
+}
+
+func (l *link) cancel() {
+	l.write([]byte{CAN, CAN, CAN})
+}
+
+// encodeBlock frames payload as a 128 or 1024 byte block filled up with pad.
+func encodeBlock(seq byte, payload []byte, crc bool, pad byte) []byte {
+	size := 128
+	header := SOH
+	if len(payload) > 128 {
+		size = 1024
+		header = STX
+	}
+
+	data := make([]byte, size)
+	copy(data, payload)
+	for i := len(payload); i < size; i++ {
+		data[i] = pad
+	}
+
+	block := append([]byte{header, seq, 255 - seq}, data...)
+	if crc {
+		sum := CRC16(data)
+		return append(block, byte(sum>>8), byte(sum))
+	}
+	return append(block, checksum(data))
+}
+
+// waitStart waits for the receiver to ask for the first block and reports
+// whether it wants CRC.
+func (l *link) waitStart(ctx context.Context, opts Options) (bool, error) {
+	cans := 0
+	for try := 0; try < startRetries; try++ {
+		b, err := l.readByte(ctx, opts.timeout())
+		switch {
+		case err == errTimeout:
+			continue
+		case err != nil:
+			return false, err
+		}
+		switch b {
+		case CRC:
+			return true, nil
+		case NAK:
+			return false, nil
+		case CAN:
+			cans++
+			if cans >= 2 {
+				return false, ErrCancelled
+			}
+		}
+	}
+	return false, fmt.Errorf("receiver never started: %w", ErrTooManyTries)
+}
+
+func (l *link) sendBlock(ctx context.Context, block []byte, opts Options) error {
+	for try := 0; try < opts.retries(); try++ {
+		if err := l.write(block); err != nil {
+			return err
+		}
+
+		cans := 0
+	response:
+		for {
+			b, err := l.readByte(ctx, opts.timeout())
+			switch {
+			case err == errTimeout:
+				break response
+			case err != nil:
+				return err
+			}
+			switch b {
+			case ACK:
+				return nil
+			case NAK:
+				break response
+			case CAN:
+				cans++
+				if cans >= 2 {
+					return ErrCancelled
+				}
+			}
+		}
+	}
+	l.cancel()
+	return fmt.Errorf("block %d: %w", block[1], ErrTooManyTries)
+}
+
+// sendData sends the blocks of one file starting at sequence number 1.
+func (l *link) sendData(ctx context.Context, name string, data []byte, crc, oneK bool, opts Options) error {
+	seq := byte(1)
+	for offset := 0; offset < len(data); {
+		if err := ctx.Err(); err != nil {
+			l.cancel()
+			return err
+		}
+
+		size := 128
+		if oneK && crc && len(data)-offset > 128 {
+			size = 1024
+		}
+		end := offset + size
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if err := l.sendBlock(ctx, encodeBlock(seq, data[offset:end], crc, SUB), opts); err != nil {
+			return err
+		}
+		offset = end
+		seq++
+		opts.report(name, int64(offset), int64(len(data)))
+	}
+	return nil
+}
+
+// sendEOT ends a file. YMODEM receivers NAK the first EOT, so a NAK is
+// answered with another EOT.
+func (l *link) sendEOT(ctx context.Context, opts Options) error {
+	for try := 0; try < opts.retries(); try++ {
+		if err := l.write([]byte{EOT}); err != nil {
+			return err
+		}
+
+	response:
+		for {
+			b, err := l.readByte(ctx, opts.timeout())
+			switch {
+			case err == errTimeout:
+				break response
+			case err != nil:
+				return err
+			}
+			switch b {
+			case ACK:
+				return nil
+			case NAK:
+				break response
+			}
+		}
+	}
+	return fmt.Errorf("end of transmission: %w", ErrTooManyTries)
+}
+
+// Send transfers data as a single XMODEM file. The mode is what the sender
+// offers; a receiver asking for the checksum variant gets 128-byte blocks.
+func Send(ctx context.Context, rw io.ReadWriter, data []byte, opts Options) error {
+	l := newLink(rw)
+	defer l.close()
+
+	crc, err := l.waitStart(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Mode == ModeChecksum {
+		crc = false
+	}
+	if err := l.sendData(ctx, "", data, crc, opts.Mode == Mode1K, opts); err != nil {
+		return err
+	}
+	return l.sendEOT(ctx, opts)
+}
+
+// blockReader receives numbered blocks, acknowledging each one.
+type blockReader struct {
+	l    *link
+	opts Options
+	crc  bool
+}
+
+type blockKind int
+
+const (
+	kindData blockKind = iota
+	kindEOT
+)
+
+// next returns the next block whose sequence number is expected. poke is
+// sent whenever the line stays quiet, to (re)start the sender.
+func (r *blockReader) next(ctx context.Context, expected byte, poke byte) (blockKind, []byte, error) {
+	failures := 0
+	cans := 0
+	for failures < r.opts.retries() {
+		header, err := r.l.readByte(ctx, r.opts.timeout())
+		if err == errTimeout {
+			failures++
+			r.l.write([]byte{poke})
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		size := 0
+		switch header {
+		case SOH:
+			size = 128
+		case STX:
+			size = 1024
+		case EOT:
+			return kindEOT, nil, nil
+		case CAN:
+			cans++
+			if cans >= 2 {
+				return 0, nil, ErrCancelled
+			}
+			continue
+		default:
+			continue
+		}
+
+		checkSize := 1
+		if r.crc {
+			checkSize = 2
+		}
+		rest := make([]byte, 2+size+checkSize)
+		if err := r.l.readFull(ctx, rest, r.opts.timeout()); err != nil {
+			if err != errTimeout {
+				return 0, nil, err
+			}
+			failures++
+			r.l.write([]byte{NAK})
+			continue
+		}
+
+		seq, inverse, data := rest[0], rest[1], rest[2:2+size]
+		if seq != 255-inverse || !r.verify(data, rest[2+size:]) {
+			failures++
+			r.l.purge(ctx)
+			r.l.write([]byte{NAK})
+			continue
+		}
+
+		if seq == expected-1 {
+			r.l.write([]byte{ACK})
+			continue
+		}
+		if seq != expected {
+			r.l.cancel()
+			return 0, nil, fmt.Errorf("%w: expected block %d, got %d", ErrSequence, expected, seq)
+		}
+		return kindData, data, nil
+	}
+
+	r.l.cancel()
+	return 0, nil, ErrTooManyTries
+}
+
+func (r *blockReader) verify(data, check []byte) bool {
+	if r.crc {
+		sum := CRC16(data)
+		return check[0] == byte(sum>>8) && check[1] == byte(sum)
+	}
+	return check[0] == checksum(data)
+}
+
+// receiveData collects the blocks of one file until EOT. size trims the
+// padding when known (YMODEM); otherwise trailing SUB bytes are removed.
+func (r *blockReader) receiveData(ctx context.Context, name string, size int64, poke byte, nakFirstEOT bool) ([]byte, error) {
+	var data bytes.Buffer
+	expected := byte(1)
+	eots := 0
+	for {
+		kind, block, err := r.next(ctx, expected, poke)
+		if err != nil {
+			return nil, err
+		}
+		if kind == kindEOT {
+			eots++
+			if nakFirstEOT && eots == 1 {
+				r.l.write([]byte{NAK})
+				poke = NAK
+				continue
+			}
+			r.l.write([]byte{ACK})
+			break
+		}
+
+		data.Write(block)
+		r.l.write([]byte{ACK})
+		expected++
+		poke = NAK
+		r.opts.report(name, int64(data.Len()), size)
+	}
+
+	out := data.Bytes()
+	if size >= 0 && int64(len(out)) > size {
+		return out[:size], nil
+	}
+	if size < 0 {
+		out = bytes.TrimRight(out, string([]byte{SUB}))
+	}
+	return out, nil
+}
+
+// Receive accepts a single XMODEM file. XMODEM does not carry the length, so
+// the SUB padding of the last block is stripped.
+func Receive(ctx context.Context, rw io.ReadWriter, opts Options) ([]byte, error) {
+	l := newLink(rw)
+	defer l.close()
+
+	r := &blockReader{l: l, opts: opts, crc: opts.Mode != ModeChecksum}
+	poke := CRC
+	if !r.crc {
+		poke = NAK
+	}
+	if err := l.write([]byte{poke}); err != nil {
+		return nil, err
+	}
+	return r.receiveData(ctx, "", -1, poke, false)
+}
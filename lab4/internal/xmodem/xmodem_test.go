@@ -0,0 +1,152 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCRC16(t *testing.T) {
+	if got := CRC16([]byte("123456789")); got != 0x31C3 {
+		t.Errorf("Expected CRC-16/XMODEM check value 0x31C3, got 0x%04X", got)
+	}
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+type result struct {
+	data  []byte
+	files []File
+	err   error
+}
+
+func pipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestXMODEMRoundTrip(t *testing.T) {
+	for _, mode := range []Mode{ModeChecksum, ModeCRC, Mode1K} {
+		t.Run(mode.String(), func(t *testing.T) {
+			sender, receiver := pipe(t)
+			data := testData(3000)
+			opts := Options{Mode: mode, Timeout: 500 * time.Millisecond}
+
+			done := make(chan result, 1)
+			go func() {
+				got, err := Receive(context.Background(), receiver, opts)
+				done <- result{data: got, err: err}
+			}()
+
+			if err := Send(context.Background(), sender, data, opts); err != nil {
+				t.Fatalf("Unexpected send error: %v", err)
+			}
+			res := <-done
+			if res.err != nil {
+				t.Fatalf("Unexpected receive error: %v", res.err)
+			}
+			if !bytes.Equal(res.data, data) {
+				t.Errorf("Expected %d bytes back, got %d", len(data), len(res.data))
+			}
+		})
+	}
+}
+
+func TestYMODEMBatch(t *testing.T) {
+	sender, receiver := pipe(t)
+	files := []File{
+		{Name: "boot/loader.bin", Data: testData(2500)},
+		{Name: "config.txt", Data: []byte("baud=9600\x1a\n")},
+		{Name: "empty", Data: nil},
+	}
+	opts := Options{Timeout: 500 * time.Millisecond}
+
+	done := make(chan result, 1)
+	go func() {
+		got, err := ReceiveBatch(context.Background(), receiver, opts)
+		done <- result{files: got, err: err}
+	}()
+
+	if err := SendBatch(context.Background(), sender, files, opts); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("Unexpected receive error: %v", res.err)
+	}
+	if len(res.files) != len(files) {
+		t.Fatalf("Expected %d files, got %d", len(files), len(res.files))
+	}
+	names := []string{"loader.bin", "config.txt", "empty"}
+	for i, f := range res.files {
+		if f.Name != names[i] || !bytes.Equal(f.Data, files[i].Data) {
+			t.Errorf("Expected %s with %d bytes, got %s with %d bytes", names[i], len(files[i].Data), f.Name, len(f.Data))
+		}
+	}
+}
+
+// corruptingConn flips a bit in one write, as line noise would.
+type corruptingConn struct {
+	io.ReadWriter
+	writes  int
+	corrupt int
+}
+
+func (c *corruptingConn) Write(b []byte) (int, error) {
+	c.writes++
+	if c.writes == c.corrupt && len(b) > 10 {
+		b = append([]byte(nil), b...)
+		b[10] ^= 0x04
+	}
+	return c.ReadWriter.Write(b)
+}
+
+func TestCorruptedBlockIsResent(t *testing.T) {
+	sender, receiver := pipe(t)
+	data := testData(500)
+	opts := Options{Mode: ModeCRC, Timeout: 500 * time.Millisecond}
+	var progress []Progress
+	sendOpts := opts
+	sendOpts.Progress = func(p Progress) { progress = append(progress, p) }
+
+	done := make(chan result, 1)
+	go func() {
+		got, err := Receive(context.Background(), receiver, opts)
+		done <- result{data: got, err: err}
+	}()
+
+	if err := Send(context.Background(), &corruptingConn{ReadWriter: sender, corrupt: 2}, data, sendOpts); err != nil {
+		t.Fatalf("Unexpected send error: %v", err)
+	}
+	res := <-done
+	if res.err != nil || !bytes.Equal(res.data, data) {
+		t.Fatalf("Expected the data intact after a resend, got %d bytes, err %v", len(res.data), res.err)
+	}
+	if len(progress) != 4 || progress[3].Done != 500 {
+		t.Errorf("Expected 4 progress reports ending at 500 bytes, got %+v", progress)
+	}
+}
+
+func TestSendCancelledByContext(t *testing.T) {
+	sender, _ := pipe(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := Send(ctx, sender, testData(10), Options{}); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+type File struct {
+	Name string
+	Data []byte
+}
+
+func encodeHeader(f File) []byte {
+	header := []byte(filepath.Base(f.Name))
+	header = append(header, 0)
+	header = append(header, strconv.Itoa(len(f.Data))...)
+	return append(header, 0)
+}
+
+// decodeHeader parses block 0. An empty name ends the batch; a missing size
+// is reported as -1.
+func decodeHeader(block []byte) (string, int64, error) {
+	name, rest, found := bytes.Cut(block, []byte{0})
+	if !found {
+		return "", 0, fmt.Errorf("%w: file name not terminated", ErrSequence)
+	}
+	if len(name) == 0 {
+		return "", 0, nil
+	}
+
+	size := int64(-1)
+	fields := bytes.Fields(bytes.TrimRight(rest, "\x00"))
+	if len(fields) > 0 {
+		if n, err := strconv.ParseInt(string(fields[0]), 10, 64); err == nil && n >= 0 {
+			size = n
+		}
+	}
+	return filepath.Base(string(name)), size, nil
+}
+
+// SendBatch transfers files with YMODEM: a header block with name and size
+// before each file, 1K CRC blocks, and an empty header to end the batch.
+func SendBatch(ctx context.Context, rw io.ReadWriter, files []File, opts Options) error {
+	l := newLink(rw)
+	defer l.close()
+
+	for _, f := range files {
+		if err := l.waitCRC(ctx, opts); err != nil {
+			return err
+		}
+		if err := l.sendBlock(ctx, encodeBlock(0, encodeHeader(f), true, 0), opts); err != nil {
+			return fmt.Errorf("header of %s: %w", f.Name, err)
+		}
+		if err := l.waitCRC(ctx, opts); err != nil {
+			return err
+		}
+		if err := l.sendData(ctx, filepath.Base(f.Name), f.Data, true, opts.Mode != ModeCRC, opts); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if err := l.sendEOT(ctx, opts); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+
+	if err := l.waitCRC(ctx, opts); err != nil {
+		return err
+	}
+	return l.sendBlock(ctx, encodeBlock(0, nil, true, 0), opts)
+}
+
+func (l *link) waitCRC(ctx context.Context, opts Options) error {
+	crc, err := l.waitStart(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if !crc {
+		l.cancel()
+		return fmt.Errorf("receiver asked for checksum mode, YMODEM needs CRC")
+	}
+	return nil
+}
+
+// ReceiveBatch accepts a YMODEM batch and returns the files in order.
+func ReceiveBatch(ctx context.Context, rw io.ReadWriter, opts Options) ([]File, error) {
+	l := newLink(rw)
+	defer l.close()
+
+	r := &blockReader{l: l, opts: opts, crc: true}
+	var files []File
+	for {
+		if err := l.write([]byte{CRC}); err != nil {
+			return files, err
+		}
+
+		kind, block, err := r.next(ctx, 0, CRC)
+		if err != nil {
+			return files, err
+		}
+		if kind == kindEOT {
+			// A repeated EOT of the previous file whose ACK got lost.
+			l.write([]byte{ACK})
+			continue
+		}
+
+		name, size, err := decodeHeader(block)
+		if err != nil {
+			l.cancel()
+			return files, err
+		}
+		l.write([]byte{ACK})
+		if name == "" {
+			return files, nil
+		}
+
+		if err := l.write([]byte{CRC}); err != nil {
+			return files, err
+		}
+		data, err := r.receiveData(ctx, name, size, CRC, true)
+		if err != nil {
+			return files, fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, File{Name: name, Data: data})
+	}
+}